@@ -0,0 +1,283 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Katalog tartibi: position bo'yicha, teng bo'lsa ID bo'yicha (eski yozuvlarda position 0)
+func compareCategories(a, b Category) int {
+	return cmp.Or(cmp.Compare(a.Position, b.Position), cmp.Compare(a.ID, b.ID))
+}
+
+func compareCategoryItems(a, b CategoryItem) int {
+	return cmp.Or(cmp.Compare(a.Position, b.Position), cmp.Compare(a.ID, b.ID))
+}
+
+func compareProducts(a, b Product) int {
+	return cmp.Or(cmp.Compare(a.Position, b.Position), cmp.Compare(a.ID, b.ID))
+}
+
+// Yangi yozuv ro'yxat oxiriga tushadi
+func nextCategoryPosition() int {
+	position := 0
+	for _, c := range categories {
+		position = max(position, c.Position)
+	}
+	return position + 1
+}
+
+func nextCategoryItemPosition(categoryID uint) int {
+	position := 0
+	for _, ci := range categoryItems {
+		if ci.CategoryID == categoryID {
+			position = max(position, ci.Position)
+		}
+	}
+	return position + 1
+}
+
+func nextProductPosition(categoryID, categoryItemID uint) int {
+	position := 0
+	for _, p := range products {
+		if p.CategoryID == categoryID && p.CategoryItemID == categoryItemID {
+			position = max(position, p.Position)
+		}
+	}
+	return position + 1
+}
+
+// ids bo'sh bo'lmasligi, takrorlanmasligi va hammasi mavjud bo'lishi kerak
+func validateReorderIDs(ids []uint, exists func(id uint) bool) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("ids bo'sh bo'lishi mumkin emas")
+	}
+	seen := make(map[uint]bool)
+	for _, id := range ids {
+		if seen[id] {
+			return fmt.Errorf("ID %d bir necha marta kiritilgan", id)
+		}
+		seen[id] = true
+		if !exists(id) {
+			return fmt.Errorf("ID %d topilmadi", id)
+		}
+	}
+	return nil
+}
+
+// Guruhning yangi tartibi: avval ids, keyin qolganlari avvalgi tartibida
+func orderedIDs(ids []uint, current []uint) []uint {
+	result := slices.Clone(ids)
+	for _, id := range current {
+		if !slices.Contains(ids, id) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func ReorderCategories(ids []uint) ([]Category, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	if err := validateReorderIDs(ids, func(id uint) bool { return findCategoryByID(id) != nil }); err != nil {
+		return nil, err
+	}
+
+	var current []uint
+	for _, c := range GetAllCategories() {
+		current = append(current, c.ID)
+	}
+	for position, id := range orderedIDs(ids, current) {
+		category := findCategoryByID(id)
+		if category.Position != position+1 {
+			category.Position = position + 1
+			category.Version++
+		}
+	}
+	saveCategories()
+	return GetAllCategories(), nil
+}
+
+func ReorderCategoryItems(req CategoryItemReorderRequest) ([]CategoryItem, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	if findCategoryByID(req.CategoryID) == nil {
+		return nil, fmt.Errorf("kategoriya topilmadi")
+	}
+	err := validateReorderIDs(req.IDs, func(id uint) bool {
+		item := findCategoryItemByID(id)
+		return item != nil && item.CategoryID == req.CategoryID
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var current []uint
+	for _, ci := range GetCategoryItemsByCategoryID(req.CategoryID) {
+		current = append(current, ci.ID)
+	}
+	for position, id := range orderedIDs(req.IDs, current) {
+		item := findCategoryItemByID(id)
+		if item.Position != position+1 {
+			item.Position = position + 1
+			item.Version++
+		}
+	}
+	saveCategoryItems()
+	return GetCategoryItemsByCategoryID(req.CategoryID), nil
+}
+
+// Mahsulotlarni ko'rsatilgan kategoriya/subkategoriyaga ko'chiradi va ids tartibida joylashtiradi
+func MoveProducts(req ProductMoveRequest) ([]Product, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	if findCategoryByID(req.CategoryID) == nil {
+		return nil, fmt.Errorf("kategoriya topilmadi")
+	}
+	if err := validateProductCategoryItem(req.CategoryID, req.CategoryItemID); err != nil {
+		return nil, err
+	}
+	if err := validateReorderIDs(req.IDs, func(id uint) bool { return findProductByID(id) != nil }); err != nil {
+		return nil, err
+	}
+
+	var current []uint
+	for _, p := range productsInGroup(req.CategoryID, req.CategoryItemID) {
+		current = append(current, p.ID)
+	}
+	for position, id := range orderedIDs(req.IDs, current) {
+		product := findProductByID(id)
+		if product.CategoryID != req.CategoryID || product.CategoryItemID != req.CategoryItemID || product.Position != position+1 {
+			product.CategoryID = req.CategoryID
+			product.CategoryItemID = req.CategoryItemID
+			product.Position = position + 1
+			product.Version++
+		}
+	}
+	saveProducts()
+	return productsInGroup(req.CategoryID, req.CategoryItemID), nil
+}
+
+func productsInGroup(categoryID, categoryItemID uint) []Product {
+	var group []Product
+	for _, p := range products {
+		if p.CategoryID == categoryID && p.CategoryItemID == categoryItemID {
+			group = append(group, p)
+		}
+	}
+	slices.SortStableFunc(group, compareProducts)
+	return group
+}
+
+// Filial foydalanuvchisi uchun katalog: kategoriya -> subkategoriya -> mahsulot, hammasi tartib bo'yicha.
+// categoryItemID berilsa faqat shu subkategoriya mahsulotlari.
+func BuildCatalog(user *User, categoryItemID *uint, now time.Time) []CatalogCategory {
+	// Ruxsat etilgan kategoriyalar (bo'sh - hammasi)
+	allowedCategories := make(map[uint]bool)
+	for _, catID := range user.CategoryID {
+		allowedCategories[catID] = true
+	}
+
+	var visible []Product
+	for _, product := range products {
+		if categoryItemID != nil && product.CategoryItemID != *categoryItemID {
+			continue
+		}
+		if !productAvailableForFilial(&product, user.FilialID) {
+			continue
+		}
+		if len(allowedCategories) > 0 && !allowedCategories[product.CategoryID] {
+			continue
+		}
+		visible = append(visible, product)
+	}
+	slices.SortStableFunc(visible, compareProducts)
+
+	catalog := []CatalogCategory{}
+	for _, category := range GetAllCategories() {
+		if category.Name == "" {
+			continue
+		}
+
+		entry := CatalogCategory{
+			ID:            category.ID,
+			Name:          category.Name,
+			ImageUrl:      category.ImageUrl,
+			Position:      category.Position,
+			Products:      []ProductSimple{},
+			Subcategories: []CatalogSubcategory{},
+		}
+		subcategoryIndex := make(map[uint]int)
+		for _, ci := range GetCategoryItemsByCategoryID(category.ID) {
+			subcategoryIndex[ci.ID] = len(entry.Subcategories)
+			entry.Subcategories = append(entry.Subcategories, CatalogSubcategory{
+				ID:       ci.ID,
+				Name:     ci.Name,
+				Position: ci.Position,
+				Products: []ProductSimple{},
+			})
+		}
+
+		count := 0
+		for _, product := range visible {
+			if product.CategoryID != category.ID {
+				continue
+			}
+			item := catalogProduct(product, user.FilialID, now)
+			if idx, ok := subcategoryIndex[product.CategoryItemID]; ok {
+				entry.Subcategories[idx].Products = append(entry.Subcategories[idx].Products, item)
+			} else {
+				entry.Products = append(entry.Products, item)
+			}
+			count++
+		}
+		if count == 0 {
+			continue
+		}
+
+		// Bo'sh subkategoriyalar ko'rsatilmaydi
+		entry.Subcategories = slices.DeleteFunc(entry.Subcategories, func(s CatalogSubcategory) bool {
+			return len(s.Products) == 0
+		})
+		entry.Ordering = CategoryOrderingStatusFor(&category, user.FilialID, now)
+		catalog = append(catalog, entry)
+	}
+	return catalog
+}
+
+func catalogProduct(product Product, filialID uint, now time.Time) ProductSimple {
+	item := ProductSimple{
+		ID:          product.ID,
+		Type:        product.Type,
+		Name:        product.Name,
+		Ingredients: product.Ingredients,
+		ImageUrl:    product.ImageUrl,
+		Position:    product.Position,
+		Unit:        unitCode(product.Type),
+		Decimals:    unitDecimals(product.Type),
+		MinQty:      product.MinQty,
+		MaxQty:      product.MaxQty,
+		Step:        product.Step,
+		Price:       product.Price,
+		Variants:    catalogVariants(&product),
+		Available:   true,
+	}
+	if categoryItem := findCategoryItemByID(product.CategoryItemID); categoryItem != nil {
+		item.CategoryItemID = categoryItem.ID
+		item.CategoryItemName = categoryItem.Name
+	}
+	if quantity, tracked := AvailableStock(product.ID, filialID); tracked {
+		item.Stock = &quantity
+		item.Available = quantity > 0
+	}
+	if stop := ActiveStop(product.ID, filialID, now); stop != nil {
+		item.Available = false
+		item.UnavailableUntil = &stop.Until
+	}
+	return item
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,6 +19,8 @@ type CategoryItem struct {
 	ID         uint   `json:"id"`
 	CategoryID uint   `json:"category_id"`
 	Name       string `json:"name"`
+	Position   int    `json:"position"`
+	Version    uint   `json:"version"`
 }
 
 var (
@@ -37,8 +44,30 @@ var (
 	nextProductID  uint = 1
 	nextOrderID    uint = 1
 
-	// Kunlik order counter
-	dailyOrderCounter = make(map[string]uint)
+	// Kunlik order counter: kalit - biznes kun (va filial), qiymat - oxirgi raqam.
+	// data/order_sequences.json ga saqlanadi, ordersMu bilan himoyalangan.
+	orderSequences = make(map[string]uint)
+	ordersMu       sync.Mutex
+
+	// Order indekslari: ID, OrderID va filial bo'yicha orders slice dagi o'rinlar.
+	// orders ga qo'shish/o'chirishda reindexOrders bilan yangilanadi, ordersMu bilan himoyalangan.
+	orderIndexByID      = make(map[uint]int)
+	orderIndexByOrderID = make(map[string]int)
+	orderIndexByFilial  = make(map[uint][]int)
+
+	// Ma'lumotnoma yozuvlari (filial, kategoriya, subkategoriya, mahsulot, user, order shablonlari,
+	// buyurtma oynalari, yetkazib berish slotlari va marshrutlari) o'zgarishi shu lock ostida.
+	// Ikkala lock kerak bo'lsa avval catalogMu, keyin ordersMu olinadi.
+	catalogMu sync.Mutex
+
+	// Order ID formati: {date} - YY-MM-DD, {filial} - filial ID, {seq} - kunlik raqam.
+	// {filial} bo'lsa raqamlash har bir filial uchun alohida boshlanadi.
+	orderIDFormat = envOrDefault("ORDER_ID_FORMAT", "{date}-{seq}")
+
+	// Biznes vaqt zonasi (default Toshkent) va biznes kun boshlanish soati.
+	// Masalan BUSINESS_DAY_CUTOFF_HOUR=4 bo'lsa 00:00-03:59 dagi tungi smena oldingi kunga yoziladi.
+	businessLocation      = loadBusinessLocation(envOrDefault("BUSINESS_TIMEZONE", "Asia/Tashkent"))
+	businessDayCutoffHour = loadCutoffHour(os.Getenv("BUSINESS_DAY_CUTOFF_HOUR"))
 )
 
 // File paths
@@ -49,12 +78,74 @@ const (
 	usersFile      = "data/users.json"
 	productsFile   = "data/products.json"
 	ordersFile     = "data/orders.json"
+	sequencesFile  = "data/order_sequences.json"
 )
 
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Serverda tzdata bo'lmasa ham Toshkent vaqti (UTC+5) ishlatiladi
+func loadBusinessLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		fmt.Printf("⚠️ Vaqt zonasi topilmadi (%s), UTC+5 ishlatiladi\n", name)
+		return time.FixedZone("UTC+5", 5*60*60)
+	}
+	return loc
+}
+
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		fmt.Printf("⚠️ Noto'g'ri %s: %s, %d ishlatiladi\n", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+func loadCutoffHour(value string) int {
+	if value == "" {
+		return 0
+	}
+	hour, err := strconv.Atoi(value)
+	if err != nil || hour < 0 || hour > 23 {
+		fmt.Printf("⚠️ Noto'g'ri BUSINESS_DAY_CUTOFF_HOUR: %s, 0 ishlatiladi\n", value)
+		return 0
+	}
+	return hour
+}
+
+// Biznes vaqt funksiyalari
+func businessNow() time.Time {
+	return time.Now().In(businessLocation)
+}
+
+// t qaysi biznes kunga tegishli (kun 00:00, businessLocation da)
+func businessDay(t time.Time) time.Time {
+	shifted := t.In(businessLocation).Add(-time.Duration(businessDayCutoffHour) * time.Hour)
+	return time.Date(shifted.Year(), shifted.Month(), shifted.Day(), 0, 0, 0, 0, businessLocation)
+}
+
+// Biznes kun aslida qachon boshlanadi (kun + cutoff soat)
+func businessDayStart(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), businessDayCutoffHour, 0, 0, 0, businessLocation)
+}
+
 // Data initialization
 func initData() {
 	fmt.Println("📂 Ma'lumotlar yuklanmoqda...")
 	os.MkdirAll(dataDir, 0755)
+	if err := validateOrderIDFormat(orderIDFormat); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
 	loadData()
 }
 
@@ -64,7 +155,17 @@ func loadData() {
 	loadUsers()
 	loadProducts()
 	loadOrders()
+	loadOrderSequences()
+	backfillNextVariantIDs()
 	loadCategoryItems()
+	loadOrderTemplates()
+	loadScheduledOrders()
+	loadOrderingWindows()
+	loadIdempotencyRecords()
+	loadStock()
+	loadStopList()
+	loadDeliverySlots()
+	loadDeliveryRoutes()
 
 	fmt.Printf("✅ Ma'lumotlar yuklandi:\n")
 	fmt.Printf("   📍 Filiallar: %d ta\n", len(filials))
@@ -78,10 +179,14 @@ func loadData() {
 func loadFilials() {
 	if data, err := ioutil.ReadFile(filialsFile); err == nil {
 		json.Unmarshal(data, &filials)
-		for _, f := range filials {
+		for i, f := range filials {
 			if f.ID >= nextFilialID {
 				nextFilialID = f.ID + 1
 			}
+			// Eski yozuvlarda version bo'lmaydi
+			if f.Version == 0 {
+				filials[i].Version = 1
+			}
 		}
 	}
 }
@@ -89,10 +194,14 @@ func loadFilials() {
 func loadCategories() {
 	if data, err := ioutil.ReadFile(categoriesFile); err == nil {
 		json.Unmarshal(data, &categories)
-		for _, c := range categories {
+		for i, c := range categories {
 			if c.ID >= nextCategoryID {
 				nextCategoryID = c.ID + 1
 			}
+			// Eski yozuvlarda version bo'lmaydi
+			if c.Version == 0 {
+				categories[i].Version = 1
+			}
 		}
 	}
 }
@@ -100,10 +209,14 @@ func loadCategories() {
 func loadUsers() {
 	if data, err := ioutil.ReadFile(usersFile); err == nil {
 		json.Unmarshal(data, &users)
-		for _, u := range users {
+		for i, u := range users {
 			if u.ID >= nextUserID {
 				nextUserID = u.ID + 1
 			}
+			// Eski yozuvlarda version bo'lmaydi
+			if u.Version == 0 {
+				users[i].Version = 1
+			}
 		}
 	}
 }
@@ -111,10 +224,14 @@ func loadUsers() {
 func loadProducts() {
 	if data, err := ioutil.ReadFile(productsFile); err == nil {
 		json.Unmarshal(data, &products)
-		for _, p := range products {
+		for i, p := range products {
 			if p.ID >= nextProductID {
 				nextProductID = p.ID + 1
 			}
+			// Eski yozuvlarda version bo'lmaydi
+			if p.Version == 0 {
+				products[i].Version = 1
+			}
 		}
 	}
 }
@@ -122,24 +239,109 @@ func loadProducts() {
 func loadOrders() {
 	if data, err := ioutil.ReadFile(ordersFile); err == nil {
 		json.Unmarshal(data, &orders)
-		for _, o := range orders {
+		reindexOrders()
+		for i, o := range orders {
 			if o.ID >= nextOrderID {
 				nextOrderID = o.ID + 1
 			}
-
-			// Kunlik counter ni qayta tiklash
-			if o.OrderID != "" {
-				parts := strings.Split(o.OrderID, "-")
-				if len(parts) == 4 {
-					dateStr := strings.Join(parts[:3], "-")
-					orderNum, _ := strconv.Atoi(parts[3])
-					if uint(orderNum) > dailyOrderCounter[dateStr] {
-						dailyOrderCounter[dateStr] = uint(orderNum)
-					}
-				}
+			// Eski yozuvlarda version bo'lmaydi
+			if o.Version == 0 {
+				orders[i].Version = 1
 			}
 		}
+		migrateOrdersFile(data)
+	}
+}
+
+// Eski orders.json da miqdorlar float32 bo'lgan (0.30000001192092896 kabi).
+// Yuklashda ular Decimal ga yaxlitlanadi; faylda shunday sonlar topilsa eski nusxa
+// saqlanib, fayl qayta yoziladi. Boshqa farqlar (yangi maydonlar va h.k.) faylni qayta yozmaydi.
+func migrateOrdersFile(raw []byte) {
+	if !hasFloatArtifacts(raw) {
+		return
+	}
+	migrated, err := json.MarshalIndent(orders, "", "  ")
+	if err != nil {
+		return
+	}
+
+	// Har bir migratsiya o'z nusxasiga ega bo'ladi - avvalgisi ustidan yozilmaydi
+	backupPath := ordersFile + ".pre-decimal"
+	if _, err := os.Stat(backupPath); err == nil {
+		backupPath += "." + time.Now().Format("20060102-150405")
+	}
+	if err := ioutil.WriteFile(backupPath, raw, 0644); err != nil {
+		log.Printf("orders.json nusxasini saqlab bo'lmadi, migratsiya o'tkazib yuborildi: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(ordersFile, migrated, 0644); err != nil {
+		log.Printf("orders.json migratsiyasida xato: %v", err)
+		return
+	}
+	log.Printf("orders.json o'nlik miqdorlarga o'tkazildi (eski nusxa: %s)", backupPath)
+}
+
+// JSON da Decimal ga sig'maydigan son bormi: 3 xonadan ko'p kasr yoki eksponentli yozuv
+func hasFloatArtifacts(raw []byte) bool {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		number, ok := token.(json.Number)
+		if !ok {
+			continue
+		}
+		text := number.String()
+		if strings.ContainsAny(text, "eE") {
+			return true
+		}
+		if _, frac, found := strings.Cut(text, "."); found && len(frac) > decimalPlaces {
+			return true
+		}
+	}
+}
+
+func loadOrderSequences() {
+	if data, err := ioutil.ReadFile(sequencesFile); err == nil {
+		json.Unmarshal(data, &orderSequences)
+	}
+
+	// Fayl yo'qolgan yoki eskirgan bo'lsa ham orderlardan tiklaymiz -
+	// hech qachon mavjud raqamdan kichik qiymatdan davom etmaymiz
+	for _, o := range orders {
+		key, seq := orderSequenceFromOrder(o)
+		if key != "" && seq > orderSequences[key] {
+			orderSequences[key] = seq
+		}
+	}
+}
+
+// Order qaysi counterga tegishli va uning raqami
+func orderSequenceFromOrder(o Order) (string, uint) {
+	if o.Sequence > 0 && o.BusinessDay != "" {
+		day, err := time.ParseInLocation("2006-01-02", o.BusinessDay, businessLocation)
+		if err == nil {
+			return orderSequenceKey(day, o.FilialID), o.Sequence
+		}
+	}
+
+	// Eski orderlar: "YY-MM-DD-N" formatidagi OrderID
+	parts := strings.Split(o.OrderID, "-")
+	if len(parts) != 4 {
+		return "", 0
+	}
+	day, err := time.ParseInLocation("06-01-02", strings.Join(parts[:3], "-"), businessLocation)
+	if err != nil {
+		return "", 0
 	}
+	orderNum, err := strconv.Atoi(parts[3])
+	if err != nil || orderNum <= 0 {
+		return "", 0
+	}
+	return orderSequenceKey(day, o.FilialID), uint(orderNum)
 }
 
 func saveData() {
@@ -175,17 +377,73 @@ func saveOrders() {
 	ioutil.WriteFile(ordersFile, data, 0644)
 }
 
+// Counter yarim yozilib qolmasligi uchun vaqtinchalik faylga yozib, keyin almashtiramiz
+func saveOrderSequences() error {
+	data, err := json.MarshalIndent(orderSequences, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFile := sequencesFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, sequencesFile)
+}
+
 // Order ID generator
-func generateOrderID() string {
-	now := time.Now()
-	dateStr := now.Format("06-01-02") // YY-MM-DD format
+func orderSequenceKey(day time.Time, filialID uint) string {
+	key := day.Format("06-01-02")
+	if strings.Contains(orderIDFormat, "{filial}") {
+		key = fmt.Sprintf("%s/%d", key, filialID)
+	}
+	return key
+}
 
-	if _, exists := dailyOrderCounter[dateStr]; !exists {
-		dailyOrderCounter[dateStr] = 0
+// {seq} bo'lmasa har bir order bir xil ID oladi va generateOrderID bo'sh raqam topa olmaydi
+func validateOrderIDFormat(format string) error {
+	if !strings.Contains(format, "{seq}") {
+		return fmt.Errorf("ORDER_ID_FORMAT da {seq} bo'lishi kerak: %q", format)
 	}
-	dailyOrderCounter[dateStr]++
+	return nil
+}
 
-	return fmt.Sprintf("%s-%d", dateStr, dailyOrderCounter[dateStr])
+func formatOrderID(day time.Time, filialID uint, seq uint) string {
+	return strings.NewReplacer(
+		"{date}", day.Format("06-01-02"),
+		"{filial}", strconv.FormatUint(uint64(filialID), 10),
+		"{seq}", strconv.FormatUint(uint64(seq), 10),
+	).Replace(orderIDFormat)
+}
+
+func orderIDExists(orderID string) bool {
+	_, ok := orderIndexByOrderID[orderID]
+	return ok
+}
+
+// Keyingi order raqamini oladi. Chaqiruvchi ordersMu ni ushlab turishi kerak.
+// Raqam orderdan oldin diskka yoziladi, restartdan keyin ham takrorlanmaydi.
+func generateOrderID(filialID uint, now time.Time) (string, string, uint, error) {
+	day := businessDay(now)
+	key := orderSequenceKey(day, filialID)
+
+	previous := orderSequences[key]
+	seq := previous
+	var orderID string
+	for {
+		seq++
+		orderID = formatOrderID(day, filialID, seq)
+		// Format o'zgartirilgan bo'lsa ham mavjud ID bilan to'qnashmasin
+		if !orderIDExists(orderID) {
+			break
+		}
+	}
+
+	orderSequences[key] = seq
+	if err := saveOrderSequences(); err != nil {
+		orderSequences[key] = previous
+		return "", "", 0, fmt.Errorf("order raqamini saqlashda xatolik: %v", err)
+	}
+	return orderID, day.Format("2006-01-02"), seq, nil
 }
 
 // Helper functions
@@ -235,22 +493,64 @@ func findProductByID(id uint) *Product {
 }
 
 func findOrderByID(id uint) *Order {
+	if i, ok := orderIndexByID[id]; ok {
+		return &orders[i]
+	}
+	return nil
+}
+
+// Slice dagi o'rinlar o'zgarganda indekslar qaytadan quriladi
+func reindexOrders() {
+	orderIndexByID = make(map[uint]int, len(orders))
+	orderIndexByOrderID = make(map[string]int, len(orders))
+	orderIndexByFilial = make(map[uint][]int)
 	for i, o := range orders {
-		if o.ID == id {
-			return &orders[i]
+		orderIndexByID[o.ID] = i
+		orderIndexByOrderID[o.OrderID] = i
+		orderIndexByFilial[o.FilialID] = append(orderIndexByFilial[o.FilialID], i)
+	}
+}
+
+func appendOrder(order Order) {
+	orders = append(orders, order)
+	i := len(orders) - 1
+	orderIndexByID[order.ID] = i
+	orderIndexByOrderID[order.OrderID] = i
+	orderIndexByFilial[order.FilialID] = append(orderIndexByFilial[order.FilialID], i)
+}
+
+// Berilgan filiallarning orderlari (slice tartibida); filialIDs bo'sh bo'lsa - hammasi
+func ordersForFilials(filialIDs []uint) []*Order {
+	var result []*Order
+	if len(filialIDs) == 0 {
+		for i := range orders {
+			result = append(result, &orders[i])
 		}
+		return result
 	}
-	return nil
+	var positions []int
+	for _, id := range slices.Compact(slices.Sorted(slices.Values(filialIDs))) {
+		positions = append(positions, orderIndexByFilial[id]...)
+	}
+	slices.Sort(positions)
+	for _, i := range positions {
+		result = append(result, &orders[i])
+	}
+	return result
 }
 
 // CRUD Operations
 
 // ============= FILIALS =============
 func CreateFilial(req AddFilialRequest) Filial {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	filial := Filial{
 		ID:       nextFilialID,
 		Name:     req.Name,
 		Location: req.Location,
+		Version:  1,
 	}
 	filials = append(filials, filial)
 	nextFilialID++
@@ -266,35 +566,55 @@ func GetFilialByID(id uint) *Filial {
 	return findFilialByID(id)
 }
 
-func UpdateFilial(id uint, req UpdateFilialRequest) *Filial {
+func UpdateFilial(id uint, req UpdateFilialRequest, ifMatch string) (*Filial, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	filial := findFilialByID(id)
 	if filial == nil {
-		return nil
+		return nil, nil
+	}
+	if err := checkVersion(ifMatch, entityETag("filial", filial.ID, filial.Version), *filial); err != nil {
+		return nil, err
 	}
 	filial.Name = req.Name
 	filial.Location = req.Location
+	filial.Version++
 	saveFilials()
-	return filial
+
+	result := *filial
+	return &result, nil
 }
 
-func DeleteFilial(id uint) bool {
+func DeleteFilial(id uint, ifMatch string) (bool, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	for i, f := range filials {
 		if f.ID == id {
+			if err := checkVersion(ifMatch, entityETag("filial", f.ID, f.Version), f); err != nil {
+				return false, err
+			}
 			filials = append(filials[:i], filials[i+1:]...)
 			saveFilials()
-			return true
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 
 // ============= CATEGORIES =============
 func CreateCategory(req AddCategoryRequest) Category {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	category := Category{
 		ID:       nextCategoryID,
 		Name:     req.Name,
 		Printer:  req.Printer,
 		ImageUrl: req.ImageUrl,
+		Position: nextCategoryPosition(),
+		Version:  1,
 	}
 	categories = append(categories, category)
 	nextCategoryID++
@@ -302,8 +622,11 @@ func CreateCategory(req AddCategoryRequest) Category {
 	return category
 }
 
+// Katalog tartibida
 func GetAllCategories() []Category {
-	return categories
+	sorted := slices.Clone(categories)
+	slices.SortStableFunc(sorted, compareCategories)
+	return sorted
 }
 
 //	func GetProductsByCategoryID(categoryID uint) []Product {
@@ -319,10 +642,16 @@ func GetCategoryByID(id uint) *Category {
 	return findCategoryByID(id)
 }
 
-func UpdateCategory(id uint, req UpdateCategoryRequest) *Category {
+func UpdateCategory(id uint, req UpdateCategoryRequest, ifMatch string) (*Category, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	category := findCategoryByID(id)
 	if category == nil {
-		return nil
+		return nil, nil
+	}
+	if err := checkVersion(ifMatch, entityETag("category", category.ID, category.Version), *category); err != nil {
+		return nil, err
 	}
 
 	// agar name kelgan bo‘lsa o‘zgartiramiz
@@ -338,21 +667,33 @@ func UpdateCategory(id uint, req UpdateCategoryRequest) *Category {
 		category.ImageUrl = *req.ImageUrl
 	}
 
+	category.Version++
 	saveCategories()
-	return category
+
+	result := *category
+	return &result, nil
 }
 
-func DeleteCategory(id uint) bool {
+func DeleteCategory(id uint, ifMatch string) (bool, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	for i, c := range categories {
 		if c.ID == id {
+			if err := checkVersion(ifMatch, entityETag("category", c.ID, c.Version), c); err != nil {
+				return false, err
+			}
 			categories = append(categories[:i], categories[i+1:]...)
 			saveCategories()
-			return true
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 func DeleteCategoryWithProducts(categoryID uint) bool {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	// 1. Kategoriyaga tegishli mahsulotlarni o'chirish
 	var remainingProducts []Product
 	for _, p := range products {
@@ -375,20 +716,53 @@ func DeleteCategoryWithProducts(categoryID uint) bool {
 }
 
 // ============= PRODUCTS =============
-func CreateProduct(req AddProductRequest) Product {
+
+// Subkategoriya mahsulot kategoriyasiga tegishli bo'lishi kerak (0 - subkategoriyasiz)
+func validateProductCategoryItem(categoryID, categoryItemID uint) error {
+	if categoryItemID == 0 {
+		return nil
+	}
+	item := findCategoryItemByID(categoryItemID)
+	if item == nil {
+		return fmt.Errorf("subkategoriya topilmadi")
+	}
+	if item.CategoryID != categoryID {
+		return fmt.Errorf("subkategoriya %s boshqa kategoriyaga tegishli", item.Name)
+	}
+	return nil
+}
+
+func CreateProduct(req AddProductRequest) (*Product, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	variants, nextVariantID, err := normalizeVariants(&Product{}, req.Type, req.Variants)
+	if err != nil {
+		return nil, err
+	}
+
 	product := Product{
-		ID:          nextProductID,
-		Name:        req.Name,
-		Type:        req.Type,
-		CategoryID:  req.CategoryID,
-		ImageUrl:    req.ImageUrl,
-		Ingredients: req.Ingredients,
-		Filials:     req.Filials,
+		ID:             nextProductID,
+		Name:           req.Name,
+		Type:           req.Type,
+		CategoryID:     req.CategoryID,
+		ImageUrl:       req.ImageUrl,
+		CategoryItemID: req.CategoryItemID,
+		Position:       nextProductPosition(req.CategoryID, req.CategoryItemID),
+		Ingredients:    req.Ingredients,
+		Filials:        req.Filials,
+		MinQty:         req.MinQty,
+		MaxQty:         req.MaxQty,
+		Step:           req.Step,
+		Price:          req.Price,
+		Variants:       variants,
+		NextVariantID:  nextVariantID,
+		Version:        1,
 	}
 	products = append(products, product)
 	nextProductID++
 	saveProducts()
-	return product
+	return &product, nil
 }
 
 func GetAllProducts() []Product {
@@ -399,40 +773,74 @@ func GetProductByID(id uint) *Product {
 	return findProductByID(id)
 }
 
-func UpdateProduct(id uint, req UpdateProductRequest) *Product {
+func UpdateProduct(id uint, req UpdateProductRequest, ifMatch string) (*Product, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	product := findProductByID(id)
 	if product == nil {
-		return nil
+		return nil, nil
+	}
+	if err := checkVersion(ifMatch, entityETag("product", product.ID, product.Version), *product); err != nil {
+		return nil, err
+	}
+	variants, nextVariantID, err := normalizeVariants(product, req.Type, req.Variants)
+	if err != nil {
+		return nil, err
 	}
 	product.Name = req.Name
 	product.Type = req.Type
+	// Boshqa kategoriya/subkategoriyaga o'tsa o'sha guruh oxiriga tushadi
+	if product.CategoryID != req.CategoryID || product.CategoryItemID != req.CategoryItemID {
+		product.Position = nextProductPosition(req.CategoryID, req.CategoryItemID)
+	}
 	product.CategoryID = req.CategoryID
+	product.CategoryItemID = req.CategoryItemID
 	product.Ingredients = req.Ingredients
 	product.ImageUrl = req.ImageUrl
 	product.Filials = req.Filials
+	product.MinQty = req.MinQty
+	product.MaxQty = req.MaxQty
+	product.Step = req.Step
+	product.Price = req.Price
+	product.Variants = variants
+	product.NextVariantID = nextVariantID
+	product.Version++
 	saveProducts()
-	return product
+
+	result := *product
+	return &result, nil
 }
 
-func DeleteProduct(id uint) bool {
+func DeleteProduct(id uint, ifMatch string) (bool, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	for i, p := range products {
 		if p.ID == id {
+			if err := checkVersion(ifMatch, entityETag("product", p.ID, p.Version), p); err != nil {
+				return false, err
+			}
 			products = append(products[:i], products[i+1:]...)
 			saveProducts()
-			return true
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 
 // ================= CATEGORY ITEMS =================
 func loadCategoryItems() {
 	if data, err := ioutil.ReadFile(categoryItemsFile); err == nil {
 		json.Unmarshal(data, &categoryItems)
-		for _, ci := range categoryItems {
+		for i, ci := range categoryItems {
 			if ci.ID >= nextCategoryItemID {
 				nextCategoryItemID = ci.ID + 1
 			}
+			// Eski yozuvlarda version bo'lmaydi
+			if ci.Version == 0 {
+				categoryItems[i].Version = 1
+			}
 		}
 	}
 }
@@ -455,6 +863,9 @@ func findCategoryItemByID(id uint) *CategoryItem {
 // --- CRUD ---
 // Create
 func CreateCategoryItem(categoryID uint, name string) *CategoryItem {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	// category mavjudligini tekshiramiz
 	if findCategoryByID(categoryID) == nil {
 		fmt.Println("❌ Bunday category mavjud emas")
@@ -465,6 +876,8 @@ func CreateCategoryItem(categoryID uint, name string) *CategoryItem {
 		ID:         nextCategoryItemID,
 		CategoryID: categoryID,
 		Name:       name,
+		Position:   nextCategoryItemPosition(categoryID),
+		Version:    1,
 	}
 	categoryItems = append(categoryItems, item)
 	nextCategoryItemID++
@@ -474,7 +887,11 @@ func CreateCategoryItem(categoryID uint, name string) *CategoryItem {
 
 // Get all
 func GetAllCategoryItems() []CategoryItem {
-	return categoryItems
+	sorted := slices.Clone(categoryItems)
+	slices.SortStableFunc(sorted, func(a, b CategoryItem) int {
+		return cmp.Or(cmp.Compare(a.CategoryID, b.CategoryID), compareCategoryItems(a, b))
+	})
+	return sorted
 }
 
 // Get by ID
@@ -490,35 +907,68 @@ func GetCategoryItemsByCategoryID(categoryID uint) []CategoryItem {
 			items = append(items, ci)
 		}
 	}
+	slices.SortStableFunc(items, compareCategoryItems)
 	return items
 }
 
 // Update
-func UpdateCategoryItem(id uint, newName string) *CategoryItem {
+func UpdateCategoryItem(id uint, newName string, ifMatch string) (*CategoryItem, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	item := findCategoryItemByID(id)
 	if item == nil {
-		return nil
+		return nil, nil
+	}
+	if err := checkVersion(ifMatch, entityETag("category-item", item.ID, item.Version), *item); err != nil {
+		return nil, err
 	}
 	item.Name = newName
+	item.Version++
 	saveCategoryItems()
-	return item
+
+	result := *item
+	return &result, nil
 }
 
 // Delete
-func DeleteCategoryItem(id uint) bool {
+func DeleteCategoryItem(id uint, ifMatch string) (bool, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	for i, ci := range categoryItems {
 		if ci.ID == id {
+			if err := checkVersion(ifMatch, entityETag("category-item", ci.ID, ci.Version), ci); err != nil {
+				return false, err
+			}
 			categoryItems = append(categoryItems[:i], categoryItems[i+1:]...)
 			saveCategoryItems()
-			return true
+
+			// Mahsulotlar subkategoriyasiz qoladi
+			productsChanged := false
+			for j := range products {
+				if products[j].CategoryItemID == id {
+					products[j].CategoryItemID = 0
+					products[j].Version++
+					productsChanged = true
+				}
+			}
+			if productsChanged {
+				saveProducts()
+			}
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 
 // ============= USERS =============
 func CreateUser(req RegisterUserRequest) User {
 	hashedPassword, _ := hashPassword(req.Password)
+
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	user := User{
 		ID:         nextUserID,
 		Name:       req.Name,
@@ -527,6 +977,7 @@ func CreateUser(req RegisterUserRequest) User {
 		Password:   hashedPassword,
 		IsAdmin:    false,
 		FilialID:   uint(req.FilialID),
+		Version:    1,
 	}
 	users = append(users, user)
 	nextUserID++
@@ -542,10 +993,16 @@ func GetUserByID(id uint) *User {
 	return findUserByID(id)
 }
 
-func UpdateUser(id uint, req UpdateUserRequest) *User {
+func UpdateUser(id uint, req UpdateUserRequest, ifMatch string) (*User, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	user := findUserByID(id)
 	if user == nil {
-		return nil
+		return nil, nil
+	}
+	if err := checkVersion(ifMatch, entityETag("user", user.ID, user.Version), *user); err != nil {
+		return nil, err
 	}
 
 	// Faqat kelgan fieldlarni yangilaymiz
@@ -565,36 +1022,176 @@ func UpdateUser(id uint, req UpdateUserRequest) *User {
 	if req.IsAdmin != nil {
 		user.IsAdmin = *req.IsAdmin
 	}
+	if req.IsDriver != nil {
+		user.IsDriver = *req.IsDriver
+	}
+	if req.IsKitchen != nil {
+		user.IsKitchen = *req.IsKitchen
+	}
 	if req.FilialID != nil {
 		user.FilialID = *req.FilialID
 	}
 
+	user.Version++
 	saveUsers() // saqlash
-	return user
+
+	result := *user
+	return &result, nil
 }
 
-func DeleteUser(id uint) bool {
+func DeleteUser(id uint, ifMatch string) (bool, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	for i, u := range users {
 		if u.ID == id {
+			if err := checkVersion(ifMatch, entityETag("user", u.ID, u.Version), u); err != nil {
+				return false, err
+			}
 			users = append(users[:i], users[i+1:]...)
 			saveUsers()
-			return true
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 
-func AssignUserFilial(userID uint, filialID uint) *User {
+func AssignUserFilial(userID uint, filialID uint, ifMatch string) (*User, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
 	user := findUserByID(userID)
 	if user == nil {
-		return nil
+		return nil, nil
+	}
+	if err := checkVersion(ifMatch, entityETag("user", user.ID, user.Version), *user); err != nil {
+		return nil, err
 	}
 	user.FilialID = filialID
+	user.Version++
 	saveUsers()
-	return user
+	result := *user
+	return &result, nil
 }
 
 // ============= ORDERS =============
+// Bir mahsulot (va variant) bir necha marta kelsa: "merge" - sonlari qo'shiladi, "reject" - xato
+var duplicateOrderLines = envOrDefault("ORDER_DUPLICATE_LINES", "merge")
+
+// Order itemlari bo'yicha barcha xatolar birga qaytariladi
+type OrderValidationError struct {
+	Items []OrderItemError
+}
+
+func (e *OrderValidationError) Error() string {
+	messages := make([]string, 0, len(e.Items))
+	for _, item := range e.Items {
+		messages = append(messages, item.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+func orderValidationError(itemErrors []OrderItemError) error {
+	if len(itemErrors) == 0 {
+		return nil
+	}
+	return &OrderValidationError{Items: itemErrors}
+}
+
+// Takroriy mahsulot qatorlarini birlashtiradi (birinchi uchragan joyida qoladi).
+// Bir mahsulotning turli variantlari alohida qator hisoblanadi.
+func MergeOrderItems(items []CreateOrderItem) ([]CreateOrderItem, []OrderItemError) {
+	var merged []CreateOrderItem
+	var itemErrors []OrderItemError
+	position := make(map[orderLineKey]int)
+
+	for i, item := range items {
+		key := lineKey(item.ProductID, item.VariantID)
+		idx, seen := position[key]
+		if !seen {
+			position[key] = len(merged)
+			merged = append(merged, item)
+			continue
+		}
+		if duplicateOrderLines == "reject" {
+			itemErrors = append(itemErrors, OrderItemError{
+				Index:     i,
+				ProductID: item.ProductID,
+				Message:   fmt.Sprintf("mahsulot ID %d orderda bir necha marta kiritilgan", item.ProductID),
+			})
+			continue
+		}
+		merged[idx].Count = merged[idx].Count.Add(item.Count)
+		merged[idx].Note = joinNotes(merged[idx].Note, item.Note)
+	}
+	return merged, itemErrors
+}
+
+// Takrorlarni birlashtirib, har bir itemni tekshiradi va barcha xatolarni qaytaradi.
+// checkWindow - buyurtma oynasi yopiq kategoriyalarni ham xato deb hisoblash.
+func ValidateOrderItems(filialID uint, items []CreateOrderItem, checkWindow bool) ([]CreateOrderItem, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("order bo'sh bo'lishi mumkin emas")
+	}
+
+	// Xatoda so'rovdagi birinchi qator raqami ko'rsatiladi
+	firstIndex := make(map[orderLineKey]int)
+	for i := len(items) - 1; i >= 0; i-- {
+		firstIndex[lineKey(items[i].ProductID, items[i].VariantID)] = i
+	}
+
+	merged, itemErrors := MergeOrderItems(items)
+	for i, item := range merged {
+		note, err := sanitizeNote(item.Note, maxItemNoteLength)
+		if err != nil {
+			itemErrors = append(itemErrors, OrderItemError{Index: firstIndex[lineKey(item.ProductID, item.VariantID)], ProductID: item.ProductID, Message: err.Error()})
+		}
+		merged[i].Note = note
+	}
+
+	now := time.Now()
+	for _, item := range merged {
+		if _, _, err := validateOrderItem(filialID, item, checkWindow, now); err != nil {
+			itemErrors = append(itemErrors, OrderItemError{Index: firstIndex[lineKey(item.ProductID, item.VariantID)], ProductID: item.ProductID, Message: err.Error()})
+		}
+	}
+	slices.SortStableFunc(itemErrors, func(a, b OrderItemError) int { return cmp.Compare(a.Index, b.Index) })
+	return merged, orderValidationError(itemErrors)
+}
+
+// Bitta order qatori: mahsulot filialda bormi, stop-listda emasmi, buyurtma oynasi ochiqmi
+// (checkWindow), variant, miqdor qoidalari va qoldiq. Order yaratish va tahrirlashda umumiy.
+func validateOrderItem(filialID uint, item CreateOrderItem, checkWindow bool, now time.Time) (*Product, *ProductVariant, error) {
+	product := findProductByID(item.ProductID)
+	if product == nil {
+		return nil, nil, fmt.Errorf("mahsulot topilmadi: ID %d", item.ProductID)
+	}
+	// Mahsulot bu filialda mavjudligini tekshirish
+	if !productAvailableForFilial(product, filialID) {
+		return nil, nil, fmt.Errorf("mahsulot %s bu filialda mavjud emas", product.Name)
+	}
+	if err := checkStopList(product, filialID, now); err != nil {
+		return nil, nil, err
+	}
+	// Kategoriya buyurtma oynasi yopiq bo'lsa qabul qilmaymiz
+	if checkWindow {
+		if err := checkProductOrderable(product, filialID, now); err != nil {
+			return nil, nil, err
+		}
+	}
+	variant, err := resolveVariant(product, item.VariantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validateQuantity(variantRules(product, variant), item.Count); err != nil {
+		return nil, nil, err
+	}
+	if err := checkStock(product, filialID, item.Count); err != nil {
+		return nil, nil, err
+	}
+	return product, variant, nil
+}
+
 func CreateOrder(userID uint, req CreateOrderRequest) (*Order, error) {
 	user := findUserByID(userID)
 	if user == nil {
@@ -610,9 +1207,16 @@ func CreateOrder(userID uint, req CreateOrderRequest) (*Order, error) {
 		return nil, fmt.Errorf("filial topilmadi")
 	}
 
+	comment, err := sanitizeNote(req.Comment, maxOrderCommentLength)
+	if err != nil {
+		return nil, err
+	}
+	slot, err := validateDelivery(req.DeliveryDate, req.DeliverySlotID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
 	order := Order{
-		ID:         nextOrderID,
-		OrderID:    generateOrderID(),
 		UserID:     userID,
 		Username:   user.Name,
 		FilialID:   user.FilialID,
@@ -620,50 +1224,76 @@ func CreateOrder(userID uint, req CreateOrderRequest) (*Order, error) {
 		Items:      []OrderItem{},
 		Total:      0,
 		Status:     "pending",
-		Created:    time.Now(),
-		Updated:    time.Now(),
+		Version:    1,
+
+		IdempotencyKey: req.IdempotencyKey,
+		Comment:        comment,
+		DeliveryDate:   req.DeliveryDate,
+	}
+	if slot != nil {
+		order.DeliverySlotID = slot.ID
+		order.DeliverySlot = slot.displayName()
 	}
 
-	for _, reqItem := range req.Items {
-		product := findProductByID(reqItem.ProductID)
-		if product == nil {
-			return nil, fmt.Errorf("mahsulot topilmadi: ID %d", reqItem.ProductID)
-		}
+	// Avval butun orderni tekshiramiz, keyin holatga tegamiz
+	items, err := ValidateOrderItems(user.FilialID, req.Items, true)
+	if err != nil {
+		return nil, err
+	}
 
-		// Mahsulot bu filialda mavjudligini tekshirish
-		productAvailable := false
-		for _, fId := range product.Filials {
-			if fId == user.FilialID {
-				productAvailable = true
-				break
-			}
-		}
+	for _, item := range items {
+		product := findProductByID(item.ProductID)
+		orderItem := newOrderItem(product, findVariant(product, item.VariantID), item.Count)
+		orderItem.Note = item.Note
+		order.Items = append(order.Items, orderItem)
+	}
+	order.Total = orderTotal(order.Items)
 
-		if !productAvailable {
-			return nil, fmt.Errorf("mahsulot %s bu filialda mavjud emas", product.Name)
-		}
+	// Raqam berish va saqlash bitta lock ostida - parallel orderlar bir xil ID olmaydi
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
 
-		if reqItem.Count <= 0 {
-			return nil, fmt.Errorf("mahsulot soni 0 dan katta bo'lishi kerak")
+	// Slot cheklovi shu lock ostida - parallel orderlar slotni oshirib yubormaydi
+	if slot != nil {
+		if err := checkSlotCapacity(slot, order.DeliveryDate, order.FilialID); err != nil {
+			return nil, err
 		}
+	}
 
-		orderItem := OrderItem{
-			ProductID: reqItem.ProductID,
-			Name:      product.Name,
-			Type:      product.Type,
-			Count:     reqItem.Count,
-		}
+	// Qoldiq tekshiruvi va band qilish shu lock ostida - parallel orderlar qoldiqdan oshib ketmaydi
+	order.ID = nextOrderID
+	stockMu.Lock()
+	defer stockMu.Unlock()
+	stockChanges := planOrderStock(&order)
+	if err := checkOrderStockChanges(stockChanges); err != nil {
+		return nil, err
+	}
 
-		order.Items = append(order.Items, orderItem)
+	now := time.Now()
+	orderID, day, seq, err := generateOrderID(user.FilialID, now)
+	if err != nil {
+		return nil, err
 	}
 
-	orders = append(orders, order)
+	order.OrderID = orderID
+	order.BusinessDay = day
+	order.Sequence = seq
+	order.Created = now
+	order.Updated = now
+
+	appendOrder(order)
 	nextOrderID++
 	saveOrders()
+	applyOrderStockChanges(&order, stockChanges)
+	publishKDSEvent(&order, "created")
 
 	return &order, nil
 }
 
+func productAvailableForFilial(product *Product, filialID uint) bool {
+	return slices.Contains(product.Filials, filialID)
+}
+
 func GetAllOrders() []Order {
 	return orders
 }
@@ -682,64 +1312,734 @@ func GetOrdersByUserID(userID uint) []Order {
 	return userOrders
 }
 
-func UpdateOrder(id uint, req UpdateOrderRequest) *Order {
+func UpdateOrder(id uint, req UpdateOrderRequest, ifMatch string) (*Order, error) {
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+
 	order := findOrderByID(id)
 	if order == nil {
-		return nil
+		return nil, nil
+	}
+	if err := checkVersion(ifMatch, entityETag("order", order.ID, order.Version), *order); err != nil {
+		return nil, err
 	}
 	order.Status = req.Status
 	order.Updated = time.Now()
+	order.Version++
 	saveOrders()
-	return order
+	syncOrderStock(order)
+	publishKDSEvent(order, "updated")
+
+	result := *order
+	return &result, nil
 }
 
-func DeleteOrder(id uint) bool {
+// Statusni faqat order hali from holatlaridan birida bo'lsa o'zgartiradi
+// (masalan, chek chiqquncha oshxona "preparing" ga o'tkazgan bo'lsa, u qaytarilmaydi)
+func SetOrderStatus(id uint, status string, from []string) {
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+
+	if order := findOrderByID(id); order != nil && slices.Contains(from, order.Status) {
+		order.Status = status
+		order.Updated = time.Now()
+		order.Version++
+		saveOrders()
+		syncOrderStock(order)
+		publishKDSEvent(order, "updated")
+	}
+}
+
+func DeleteOrder(id uint, ifMatch string) (bool, error) {
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+
 	for i, o := range orders {
 		if o.ID == id {
+			if err := checkVersion(ifMatch, entityETag("order", o.ID, o.Version), o); err != nil {
+				return false, err
+			}
+			// O'chirishdan oldin band qilingan qoldiq qaytariladi
+			released := o
+			released.Status = "cancelled"
+			syncOrderStock(&released)
 			orders = append(orders[:i], orders[i+1:]...)
+			reindexOrders()
 			saveOrders()
+			publishKDSEvent(&o, "deleted")
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func GetFilteredOrders(filter OrderFilter) []Order {
+	var filteredOrders []Order
+
+	// Filial filtri bo'lsa faqat shu filiallarning orderlari ko'riladi
+	ordersMu.Lock()
+	for _, order := range ordersForFilials(filter.FilialIDs) {
+		if orderMatchesFilter(*order, filter) {
+			filteredOrders = append(filteredOrders, *order)
+		}
+	}
+	ordersMu.Unlock()
+
+	// Eng yangi buyurtmalar birinchi
+	slices.SortStableFunc(filteredOrders, func(a, b Order) int {
+		return b.Created.Compare(a.Created)
+	})
+
+	return filteredOrders
+}
+
+func orderMatchesFilter(order Order, filter OrderFilter) bool {
+	// Filial, user va status bo'yicha filter
+	if len(filter.FilialIDs) > 0 && !slices.Contains(filter.FilialIDs, order.FilialID) {
+		return false
+	}
+	if len(filter.UserIDs) > 0 && !slices.Contains(filter.UserIDs, order.UserID) {
+		return false
+	}
+	if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, order.Status) {
+		return false
+	}
+	if len(filter.DeliveryDates) > 0 && !slices.Contains(filter.DeliveryDates, order.DeliveryDate) {
+		return false
+	}
+	if len(filter.DeliverySlotIDs) > 0 && !slices.Contains(filter.DeliverySlotIDs, order.DeliverySlotID) {
+		return false
+	}
+
+	// Sana oralig'i bo'yicha filter
+	if !filter.From.IsZero() && order.Created.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && !order.Created.Before(filter.To) {
+		return false
+	}
+
+	// Mahsulot, kategoriya, subkategoriya va printer bo'yicha: kamida bitta item mos kelishi kerak
+	if len(filter.ProductIDs) == 0 && len(filter.CategoryIDs) == 0 && len(filter.CategoryItemIDs) == 0 && len(filter.Printers) == 0 {
+		return true
+	}
+	for _, item := range order.Items {
+		if orderItemMatchesFilter(item, filter) {
 			return true
 		}
 	}
 	return false
 }
 
-func GetFilteredOrders(filialID string, status string, date string) []Order {
-	var filteredOrders []Order
+func orderItemMatchesFilter(item OrderItem, filter OrderFilter) bool {
+	if len(filter.ProductIDs) > 0 && !slices.Contains(filter.ProductIDs, item.ProductID) {
+		return false
+	}
+	if len(filter.CategoryIDs) == 0 && len(filter.CategoryItemIDs) == 0 && len(filter.Printers) == 0 {
+		return true
+	}
 
-	for _, order := range orders {
-		// Filial bo'yicha filter
-		if filialID != "" {
-			fID, err := strconv.Atoi(filialID)
-			if err == nil && order.FilialID != uint(fID) {
+	product := findProductByID(item.ProductID)
+	if product == nil {
+		return false
+	}
+	if len(filter.CategoryIDs) > 0 && !slices.Contains(filter.CategoryIDs, product.CategoryID) {
+		return false
+	}
+	if len(filter.CategoryItemIDs) > 0 && !slices.Contains(filter.CategoryItemIDs, product.CategoryItemID) {
+		return false
+	}
+	if len(filter.Printers) > 0 {
+		category := findCategoryByID(product.CategoryID)
+		if category == nil || !slices.Contains(filter.Printers, category.Printer) {
+			return false
+		}
+	}
+	return true
+}
+
+// ============= LIST QUERY (search, sort, pagination) =============
+
+// Sort kalitlari: har bir ro'yxat uchun ruxsat etilgan maydonlar
+var orderSortKeys = map[string]func(a, b Order) int{
+	"id":          func(a, b Order) int { return cmp.Compare(a.ID, b.ID) },
+	"order_id":    func(a, b Order) int { return cmp.Compare(a.ID, b.ID) },
+	"created":     func(a, b Order) int { return a.Created.Compare(b.Created) },
+	"updated":     func(a, b Order) int { return a.Updated.Compare(b.Updated) },
+	"status":      func(a, b Order) int { return strings.Compare(a.Status, b.Status) },
+	"username":    func(a, b Order) int { return compareFold(a.Username, b.Username) },
+	"filial_name": func(a, b Order) int { return compareFold(a.FilialName, b.FilialName) },
+}
+
+var userSortKeys = map[string]func(a, b User) int{
+	"id":        func(a, b User) int { return cmp.Compare(a.ID, b.ID) },
+	"name":      func(a, b User) int { return compareFold(a.Name, b.Name) },
+	"phone":     func(a, b User) int { return strings.Compare(a.Phone, b.Phone) },
+	"filial_id": func(a, b User) int { return cmp.Compare(a.FilialID, b.FilialID) },
+}
+
+var productSortKeys = map[string]func(a, b Product) int{
+	"id":          func(a, b Product) int { return cmp.Compare(a.ID, b.ID) },
+	"name":        func(a, b Product) int { return compareFold(a.Name, b.Name) },
+	"category_id": func(a, b Product) int { return cmp.Compare(a.CategoryID, b.CategoryID) },
+	"type":        func(a, b Product) int { return compareFold(a.Type, b.Type) },
+	"position":    func(a, b Product) int { return cmp.Or(cmp.Compare(a.CategoryID, b.CategoryID), compareProducts(a, b)) },
+}
+
+func compareFold(a, b string) int {
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// Qidiruv: katta-kichik harfga qaramasdan istalgan maydonda uchrasa true
+func matchesSearch(query string, fields ...string) bool {
+	if query == "" {
+		return true
+	}
+	query = strings.ToLower(query)
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// Umumiy sort + sahifalash. Asl slice o'zgarmaydi, nusxa bilan ishlaymiz.
+func sortAndPaginate[T any](items []T, params ListParams, sortKeys map[string]func(a, b T) int) ([]T, Pagination, error) {
+	compare, ok := sortKeys[params.Sort]
+	if !ok {
+		return nil, Pagination{}, fmt.Errorf("noto'g'ri sort maydoni: %s", params.Sort)
+	}
+
+	sorted := slices.Clone(items)
+	slices.SortStableFunc(sorted, func(a, b T) int {
+		if params.Desc {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+
+	pagination := Pagination{
+		Page:  params.Page,
+		Limit: params.Limit,
+		Total: len(sorted),
+		Sort:  params.Sort,
+		Order: "asc",
+	}
+	if params.Desc {
+		pagination.Order = "desc"
+	}
+
+	// Limit berilmagan bo'lsa hammasi bitta sahifada qaytadi
+	if params.Limit <= 0 {
+		pagination.Page = 1
+		pagination.Limit = len(sorted)
+		pagination.TotalPages = 1
+		return sorted, pagination, nil
+	}
+
+	pagination.TotalPages = (len(sorted) + params.Limit - 1) / params.Limit
+	start := (params.Page - 1) * params.Limit
+	if start >= len(sorted) {
+		return []T{}, pagination, nil
+	}
+	end := min(start+params.Limit, len(sorted))
+	return sorted[start:end], pagination, nil
+}
+
+func QueryOrders(list []Order, params ListParams) ([]Order, Pagination, error) {
+	var matched []Order
+	for _, order := range list {
+		fields := []string{order.OrderID, order.Username, order.FilialName}
+		for _, item := range order.Items {
+			fields = append(fields, item.Name, item.VariantName, item.Note)
+		}
+		fields = append(fields, order.Comment)
+		if matchesSearch(params.Search, fields...) {
+			matched = append(matched, order)
+		}
+	}
+	return sortAndPaginate(matched, params, orderSortKeys)
+}
+
+func QueryUsers(list []User, params ListParams) ([]User, Pagination, error) {
+	var matched []User
+	for _, user := range list {
+		if matchesSearch(params.Search, user.Name, user.Phone) {
+			matched = append(matched, user)
+		}
+	}
+	return sortAndPaginate(matched, params, userSortKeys)
+}
+
+func QueryProducts(list []Product, params ListParams) ([]Product, Pagination, error) {
+	var matched []Product
+	for _, product := range list {
+		categoryName := ""
+		if category := findCategoryByID(product.CategoryID); category != nil {
+			categoryName = category.Name
+		}
+		if matchesSearch(params.Search, product.Name, product.Ingredients, categoryName) {
+			matched = append(matched, product)
+		}
+	}
+	return sortAndPaginate(matched, params, productSortKeys)
+}
+
+// Orderlardagi mahsulotlarni subkategoriya bo'yicha yig'adi. Turli birliklar qo'shilmaydi,
+// shuning uchun har bir subkategoriya ichida mahsulotlar kesimida beriladi.
+func BuildSubcategoryReport(filteredOrders []Order, filter OrderFilter) []SubcategoryReport {
+	type reportKey struct{ categoryID, categoryItemID uint }
+	reports := make(map[reportKey]*SubcategoryReport)
+	orderSeen := make(map[reportKey]map[uint]bool)
+
+	for _, order := range filteredOrders {
+		for _, item := range order.Items {
+			if !orderItemMatchesFilter(item, filter) {
 				continue
 			}
+			product := findProductByID(item.ProductID)
+			if product == nil {
+				continue
+			}
+
+			key := reportKey{product.CategoryID, product.CategoryItemID}
+			report := reports[key]
+			if report == nil {
+				report = &SubcategoryReport{
+					CategoryItemID: product.CategoryItemID,
+					Name:           "Subkategoriyasiz",
+					CategoryID:     product.CategoryID,
+					Products:       []ProductQuantityRow{},
+				}
+				if categoryItem := findCategoryItemByID(product.CategoryItemID); categoryItem != nil {
+					report.Name = categoryItem.Name
+				}
+				if category := findCategoryByID(product.CategoryID); category != nil {
+					report.CategoryName = category.Name
+				}
+				reports[key] = report
+				orderSeen[key] = make(map[uint]bool)
+			}
+
+			if !orderSeen[key][order.ID] {
+				orderSeen[key][order.ID] = true
+				report.OrderCount++
+			}
+
+			idx := slices.IndexFunc(report.Products, func(row ProductQuantityRow) bool { return row.ProductID == item.ProductID })
+			if idx < 0 {
+				report.Products = append(report.Products, ProductQuantityRow{ProductID: item.ProductID, Name: item.Name, Type: item.Type})
+				idx = len(report.Products) - 1
+			}
+			report.Products[idx].Count = report.Products[idx].Count.Add(item.Count)
 		}
+	}
 
-		// Status bo'yicha filter
-		if status != "" && order.Status != status {
-			continue
+	result := make([]SubcategoryReport, 0, len(reports))
+	for _, report := range reports {
+		slices.SortFunc(report.Products, func(a, b ProductQuantityRow) int { return cmp.Compare(a.ProductID, b.ProductID) })
+		result = append(result, *report)
+	}
+	slices.SortFunc(result, func(a, b SubcategoryReport) int {
+		return cmp.Or(cmp.Compare(a.CategoryID, b.CategoryID), cmp.Compare(a.CategoryItemID, b.CategoryItemID))
+	})
+	return result
+}
+
+// ============= ORDER AMEND / CANCEL (filial tomonidan) =============
+
+// Filial orderni yaratilgandan keyin shuncha vaqt ichida o'zgartira oladi (0 - cheklanmagan)
+var orderEditWindow = time.Duration(envInt("ORDER_EDIT_WINDOW_MINUTES", 15)) * time.Minute
+
+// Oshxona hali tayyorlashni boshlamagan statuslar
+var branchEditableStatuses = []string{"pending", "confirmed", "sent_to_printer", "print_error"}
+
+const maxChangeReasonLength = 500
+
+func CheckOrderEditable(order *Order, isAdmin bool) error {
+	if !slices.Contains(branchEditableStatuses, order.Status) {
+		return fmt.Errorf("order \"%s\" holatida, uni o'zgartirib bo'lmaydi", order.Status)
+	}
+	if !isAdmin && orderEditWindow > 0 && time.Since(order.Created) > orderEditWindow {
+		return fmt.Errorf("order o'zgartirish muddati (%d daqiqa) o'tib ketgan", int(orderEditWindow.Minutes()))
+	}
+	return nil
+}
+
+func AmendOrder(id uint, actor *User, req AmendOrderRequest, ifMatch string) (*Order, *OrderChange, error) {
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+
+	order := findOrderByID(id)
+	if order == nil {
+		return nil, nil, fmt.Errorf("order topilmadi")
+	}
+	if err := checkVersion(ifMatch, entityETag("order", order.ID, order.Version), *order); err != nil {
+		return nil, nil, err
+	}
+	if err := CheckOrderEditable(order, actor.IsAdmin); err != nil {
+		return nil, nil, err
+	}
+
+	items := slices.Clone(order.Items)
+	var diff []OrderItemChange
+
+	for _, reqItem := range req.Items {
+		if reqItem.Count < 0 {
+			return nil, nil, fmt.Errorf("mahsulot soni manfiy bo'lishi mumkin emas")
+		}
+		var note string
+		if reqItem.Note != nil {
+			sanitized, err := sanitizeNote(*reqItem.Note, maxItemNoteLength)
+			if err != nil {
+				return nil, nil, err
+			}
+			note = sanitized
 		}
 
-		// Sana bo'yicha filter
-		if date != "" {
-			orderDate := order.Created.Format("2006-01-02")
-			if orderDate != date {
+		// Orderda bor mahsulot: sonini o'zgartirish yoki olib tashlash
+		idx := slices.IndexFunc(items, func(item OrderItem) bool {
+			return lineKey(item.ProductID, item.VariantID) == lineKey(reqItem.ProductID, reqItem.VariantID)
+		})
+		if idx >= 0 {
+			existing := items[idx]
+			// Izoh berilmasa avvalgisi saqlanadi, bo'sh izoh esa uni o'chiradi
+			if reqItem.Note == nil {
+				note = existing.Note
+			}
+			if existing.Count == reqItem.Count && existing.Note == note {
 				continue
 			}
+			if reqItem.Count > 0 {
+				if product := findProductByID(existing.ProductID); product != nil {
+					if err := validateQuantity(variantRules(product, findVariant(product, existing.VariantID)), reqItem.Count); err != nil {
+						return nil, nil, err
+					}
+					// Ko'paytirish ham yangi buyurtma: stop-list va buyurtma oynasi tekshiriladi
+					if reqItem.Count > existing.Count {
+						if err := checkStopList(product, order.FilialID, time.Now()); err != nil {
+							return nil, nil, err
+						}
+						if err := checkProductOrderable(product, order.FilialID, time.Now()); err != nil {
+							return nil, nil, err
+						}
+					}
+				}
+			}
+			diff = append(diff, OrderItemChange{
+				ProductID:   existing.ProductID,
+				VariantID:   existing.VariantID,
+				Name:        existing.Name,
+				VariantName: existing.VariantName,
+				Type:        existing.Type,
+				Note:        note,
+				OldCount:    existing.Count,
+				NewCount:    reqItem.Count,
+			})
+			if reqItem.Count == 0 {
+				items = slices.Delete(items, idx, idx+1)
+			} else {
+				items[idx].Count = reqItem.Count
+				items[idx].Note = note
+				items[idx].Subtotal = reqItem.Count.Mul(items[idx].Price)
+			}
+			continue
 		}
 
-		filteredOrders = append(filteredOrders, order)
+		if reqItem.Count == 0 {
+			continue
+		}
+
+		// Yangi mahsulot qo'shish: yangi orderdagi kabi stop-list, buyurtma oynasi va qoldiq tekshiriladi
+		newItem := CreateOrderItem{ProductID: reqItem.ProductID, VariantID: reqItem.VariantID, Count: reqItem.Count, Note: note}
+		product, variant, err := validateOrderItem(order.FilialID, newItem, true, time.Now())
+		if err != nil {
+			return nil, nil, err
+		}
+		item := newOrderItem(product, variant, reqItem.Count)
+		item.Note = note
+		items = append(items, item)
+		diff = append(diff, OrderItemChange{
+			ProductID:   item.ProductID,
+			VariantID:   item.VariantID,
+			Name:        item.Name,
+			VariantName: item.VariantName,
+			Type:        item.Type,
+			Note:        item.Note,
+			NewCount:    item.Count,
+		})
 	}
 
-	// Eng yangi buyurtmalar birinchi
-	for i := 0; i < len(filteredOrders)-1; i++ {
-		for j := 0; j < len(filteredOrders)-i-1; j++ {
-			if filteredOrders[j].Created.Before(filteredOrders[j+1].Created) {
-				filteredOrders[j], filteredOrders[j+1] = filteredOrders[j+1], filteredOrders[j]
+	if len(diff) == 0 {
+		return nil, nil, fmt.Errorf("hech narsa o'zgarmadi")
+	}
+
+	if len(items) == 0 {
+		return nil, nil, fmt.Errorf("barcha mahsulotlarni olib tashlab bo'lmaydi, orderni bekor qiling")
+	}
+
+	// Ko'paytirilgan miqdorlar omborda tekshirilib shu zahoti band qilinadi
+	amended := *order
+	amended.Items = items
+	if err := reserveOrderStock(&amended); err != nil {
+		return nil, nil, err
+	}
+
+	change := OrderChange{
+		Type:     "changed",
+		UserID:   actor.ID,
+		Username: actor.Name,
+		Items:    diff,
+		Created:  time.Now(),
+	}
+	order.Items = items
+	order.Total = orderTotal(items)
+	order.Changes = append(order.Changes, change)
+	order.Updated = change.Created
+	order.Version++
+	saveOrders()
+	syncOrderStock(order)
+	publishKDSEvent(order, "updated")
+
+	result := *order
+	return &result, &change, nil
+}
+
+func CancelOrder(id uint, actor *User, reason string, ifMatch string) (*Order, *OrderChange, error) {
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+
+	order := findOrderByID(id)
+	if order == nil {
+		return nil, nil, fmt.Errorf("order topilmadi")
+	}
+	if err := checkVersion(ifMatch, entityETag("order", order.ID, order.Version), *order); err != nil {
+		return nil, nil, err
+	}
+	if err := CheckOrderEditable(order, actor.IsAdmin); err != nil {
+		return nil, nil, err
+	}
+
+	reason = strings.TrimSpace(reason)
+	if len([]rune(reason)) > maxChangeReasonLength {
+		return nil, nil, fmt.Errorf("sabab %d belgidan oshmasligi kerak", maxChangeReasonLength)
+	}
+
+	var diff []OrderItemChange
+	for _, item := range order.Items {
+		diff = append(diff, OrderItemChange{
+			ProductID:   item.ProductID,
+			VariantID:   item.VariantID,
+			Name:        item.Name,
+			VariantName: item.VariantName,
+			Type:        item.Type,
+			OldCount:    item.Count,
+		})
+	}
+
+	change := OrderChange{
+		Type:     "cancelled",
+		UserID:   actor.ID,
+		Username: actor.Name,
+		Reason:   reason,
+		Items:    diff,
+		Created:  time.Now(),
+	}
+	order.Status = "cancelled"
+	order.Changes = append(order.Changes, change)
+	order.Updated = change.Created
+	order.Version++
+	saveOrders()
+	syncOrderStock(order)
+	publishKDSEvent(order, "cancelled")
+
+	result := *order
+	return &result, &change, nil
+}
+
+// ============= REORDER / ORDER TEMPLATES =============
+var (
+	orderTemplates      []OrderTemplate
+	nextOrderTemplateID uint = 1
+)
+
+const orderTemplatesFile = "data/order_templates.json"
+
+func loadOrderTemplates() {
+	if data, err := ioutil.ReadFile(orderTemplatesFile); err == nil {
+		json.Unmarshal(data, &orderTemplates)
+		for _, t := range orderTemplates {
+			if t.ID >= nextOrderTemplateID {
+				nextOrderTemplateID = t.ID + 1
 			}
 		}
 	}
+}
 
-	return filteredOrders
+func saveOrderTemplates() {
+	data, _ := json.MarshalIndent(orderTemplates, "", "  ")
+	ioutil.WriteFile(orderTemplatesFile, data, 0644)
+}
+
+func findOrderTemplateByID(id uint) *OrderTemplate {
+	for i, t := range orderTemplates {
+		if t.ID == id {
+			return &orderTemplates[i]
+		}
+	}
+	return nil
+}
+
+// Filialga hozir buyurtma qilib bo'lmaydigan mahsulotlarni olib tashlaydi.
+// Qaytaradi: qolgan itemlar va tashlab ketilgan mahsulot nomlari.
+func FilterAvailableItems(filialID uint, items []CreateOrderItem) ([]CreateOrderItem, []string) {
+	var available []CreateOrderItem
+	var skipped []string
+	for _, item := range items {
+		product := findProductByID(item.ProductID)
+		if product == nil {
+			skipped = append(skipped, fmt.Sprintf("ID %d", item.ProductID))
+			continue
+		}
+		if !productAvailableForFilial(product, filialID) {
+			skipped = append(skipped, product.Name)
+			continue
+		}
+		// Variant o'chirilgan yoki mahsulotga variantlar qo'shilgan
+		if variant, err := resolveVariant(product, item.VariantID); err != nil || validateQuantity(variantRules(product, variant), item.Count) != nil {
+			skipped = append(skipped, product.Name)
+			continue
+		}
+		if checkStock(product, filialID, item.Count) != nil || checkStopList(product, filialID, time.Now()) != nil {
+			skipped = append(skipped, product.Name)
+			continue
+		}
+		available = append(available, item)
+	}
+	return available, skipped
+}
+
+// Oldingi order mahsulotlaridan yangi order so'rovi
+func ReorderItems(order *Order) []CreateOrderItem {
+	var items []CreateOrderItem
+	for _, item := range order.Items {
+		items = append(items, CreateOrderItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Count:     item.Count,
+			Note:      item.Note,
+		})
+	}
+	return items
+}
+
+func validateOrderTemplate(req OrderTemplateRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("shablon nomi majburiy")
+	}
+	if len(req.Items) == 0 {
+		return fmt.Errorf("shablon bo'sh bo'lishi mumkin emas")
+	}
+	if err := sanitizeItemNotes(req.Items); err != nil {
+		return err
+	}
+	for _, item := range req.Items {
+		product := findProductByID(item.ProductID)
+		if product == nil {
+			return fmt.Errorf("mahsulot topilmadi: ID %d", item.ProductID)
+		}
+		variant, err := resolveVariant(product, item.VariantID)
+		if err != nil {
+			return err
+		}
+		if err := validateQuantity(variantRules(product, variant), item.Count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func CreateOrderTemplate(user *User, req OrderTemplateRequest) (*OrderTemplate, error) {
+	if user.FilialID == 0 {
+		return nil, fmt.Errorf("sizga filial belgilanmagan")
+	}
+	if err := validateOrderTemplate(req); err != nil {
+		return nil, err
+	}
+
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	now := time.Now()
+	template := OrderTemplate{
+		ID:       nextOrderTemplateID,
+		Name:     strings.TrimSpace(req.Name),
+		UserID:   user.ID,
+		FilialID: user.FilialID,
+		Items:    req.Items,
+		Created:  now,
+		Updated:  now,
+		Version:  1,
+	}
+	orderTemplates = append(orderTemplates, template)
+	nextOrderTemplateID++
+	saveOrderTemplates()
+	return &template, nil
+}
+
+// Admin hammasini, user esa o'z filiali shablonlarini ko'radi
+func GetOrderTemplatesForUser(user *User) []OrderTemplate {
+	result := []OrderTemplate{}
+	for _, t := range orderTemplates {
+		if user.IsAdmin || t.FilialID == user.FilialID {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func GetOrderTemplateByID(id uint) *OrderTemplate {
+	return findOrderTemplateByID(id)
+}
+
+func UpdateOrderTemplate(id uint, req OrderTemplateRequest, ifMatch string) (*OrderTemplate, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	template := findOrderTemplateByID(id)
+	if template == nil {
+		return nil, nil
+	}
+	if err := checkVersion(ifMatch, entityETag("order-template", template.ID, template.Version), *template); err != nil {
+		return nil, err
+	}
+	if err := validateOrderTemplate(req); err != nil {
+		return nil, err
+	}
+	template.Name = strings.TrimSpace(req.Name)
+	template.Items = req.Items
+	template.Updated = time.Now()
+	template.Version++
+	saveOrderTemplates()
+
+	result := *template
+	return &result, nil
+}
+
+func DeleteOrderTemplate(id uint, ifMatch string) (bool, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	for i, t := range orderTemplates {
+		if t.ID == id {
+			if err := checkVersion(ifMatch, entityETag("order-template", t.ID, t.Version), t); err != nil {
+				return false, err
+			}
+			orderTemplates = append(orderTemplates[:i], orderTemplates[i+1:]...)
+			saveOrderTemplates()
+			return true, nil
+		}
+	}
+	return false, nil
 }
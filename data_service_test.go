@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test uchun bo'sh ma'lumotlar: ikki filial, har birida bittadan user va bitta mahsulot
+func setupOrderTestData(t *testing.T, format string) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldFormat := orderIDFormat
+	t.Cleanup(func() { orderIDFormat = oldFormat })
+	orderIDFormat = format
+
+	filials = []Filial{{ID: 1, Name: "F1"}, {ID: 2, Name: "F2"}}
+	users = []User{{ID: 1, Name: "u1", FilialID: 1}, {ID: 2, Name: "u2", FilialID: 2}}
+	products = []Product{{ID: 1, Name: "Non", Type: "dona", Filials: []uint{1, 2}}}
+	orders = nil
+	nextOrderID = 1
+	orderSequences = make(map[string]uint)
+	reindexOrders()
+}
+
+func createOrdersConcurrently(t *testing.T, n int, userIDs []uint) []*Order {
+	created := make([]*Order, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			created[i], errs[i] = CreateOrder(userIDs[i%len(userIDs)], CreateOrderRequest{
+				Items: []CreateOrderItem{{ProductID: 1, Count: NewDecimal(1)}},
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("order %d: %v", i, err)
+		}
+	}
+	return created
+}
+
+func readOrderSequences(t *testing.T) map[string]uint {
+	data, err := os.ReadFile(sequencesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := make(map[string]uint)
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	return saved
+}
+
+func TestCreateOrderConcurrentIDs(t *testing.T) {
+	const n = 50
+
+	t.Run("global", func(t *testing.T) {
+		setupOrderTestData(t, "{date}-{seq}")
+		created := createOrdersConcurrently(t, n, []uint{1, 2})
+
+		seen := make(map[string]bool)
+		for _, o := range created {
+			if seen[o.OrderID] {
+				t.Fatalf("takroriy order ID: %s", o.OrderID)
+			}
+			seen[o.OrderID] = true
+		}
+
+		key := orderSequenceKey(businessDay(time.Now()), 0)
+		if got := readOrderSequences(t)[key]; got != n {
+			t.Fatalf("saqlangan raqam %s = %d, kutilgan %d", key, got, n)
+		}
+	})
+
+	t.Run("per filial", func(t *testing.T) {
+		setupOrderTestData(t, "{filial}-{date}-{seq}")
+		created := createOrdersConcurrently(t, n, []uint{1, 2})
+
+		seen := make(map[string]bool)
+		perFilial := make(map[uint]uint)
+		for _, o := range created {
+			if seen[o.OrderID] {
+				t.Fatalf("takroriy order ID: %s", o.OrderID)
+			}
+			seen[o.OrderID] = true
+			perFilial[o.FilialID]++
+		}
+
+		saved := readOrderSequences(t)
+		day := businessDay(time.Now())
+		for _, filialID := range []uint{1, 2} {
+			key := orderSequenceKey(day, filialID)
+			if saved[key] != perFilial[filialID] || perFilial[filialID] != n/2 {
+				t.Fatalf("saqlangan raqam %s = %d, kutilgan %d", key, saved[key], n/2)
+			}
+		}
+	})
+}
+
+func TestValidateOrderIDFormat(t *testing.T) {
+	if err := validateOrderIDFormat("{date}-{filial}"); err == nil {
+		t.Fatal("{seq} siz format qabul qilindi")
+	}
+	if err := validateOrderIDFormat("{date}-{seq}"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateOrdersFile(t *testing.T) {
+	setupOrderTestData(t, "{date}-{seq}")
+
+	// Faqat yangi maydonlar farqi (masalan, version yo'q) - fayl qayta yozilmaydi
+	plain := []byte(`[{"id": 1, "order_id": "A-1", "items": [{"product_id": 1, "count": 1.5}]}]`)
+	if err := os.WriteFile(ordersFile, plain, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loadOrders()
+	if data, _ := os.ReadFile(ordersFile); string(data) != string(plain) {
+		t.Fatalf("float bo'lmagan fayl qayta yozildi: %s", data)
+	}
+	if _, err := os.Stat(ordersFile + ".pre-decimal"); !os.IsNotExist(err) {
+		t.Fatal("keraksiz nusxa yaratildi")
+	}
+
+	// float32 qoldiqlari - nusxa saqlanib, yaxlitlangan qiymat yoziladi
+	legacy := []byte(`[{"id": 1, "order_id": "A-1", "items": [{"product_id": 1, "count": 0.30000001192092896}]}]`)
+	if err := os.WriteFile(ordersFile, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+	orders = nil
+	loadOrders()
+	if backup, err := os.ReadFile(ordersFile + ".pre-decimal"); err != nil || string(backup) != string(legacy) {
+		t.Fatalf("eski nusxa saqlanmadi: %v", err)
+	}
+	var saved []Order
+	data, _ := os.ReadFile(ordersFile)
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Items[0].Count != 300 {
+		t.Fatalf("migratsiya natijasi noto'g'ri: %s", data)
+	}
+}
+
+// Format o'zgartirilgandan keyin yangi raqam eski orderning ID siga to'g'ri kelsa o'tkazib yuboriladi
+func TestGenerateOrderIDSkipsExisting(t *testing.T) {
+	setupOrderTestData(t, "{date}-{seq}")
+	day := businessDay(time.Now())
+	taken := formatOrderID(day, 0, 1)
+	orders = []Order{{ID: 1, OrderID: taken, FilialID: 1}}
+	nextOrderID = 2
+	reindexOrders()
+
+	created := createOrdersConcurrently(t, 1, []uint{1})
+	if want := formatOrderID(day, 0, 2); created[0].OrderID != want {
+		t.Fatalf("order ID %s, kutilgan %s", created[0].OrderID, want)
+	}
+	if !orderIDExists(created[0].OrderID) {
+		t.Fatal("yangi order ID indeksga qo'shilmadi")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Miqdor va pul uchun fixed-point o'nlik son: qiymat * 1000 int64 da saqlanadi.
+// float32 dagi 0.30000001 kabi xatoliklar bo'lmaydi, JSON da aniq "0.3" chiqadi.
+type Decimal int64
+
+const (
+	decimalPlaces = 3
+	decimalScale  = 1000
+)
+
+func NewDecimal(units int64) Decimal {
+	return Decimal(units * decimalScale)
+}
+
+// float dan o'tkazish (eski ma'lumotlar uchun) - 3 xonagacha yaxlitlanadi
+func DecimalFromFloat(f float64) Decimal {
+	return Decimal(math.Round(f * decimalScale))
+}
+
+// "1.25", "-3", "0.3000000119" - 3 xonadan ortig'i yaxlitlanadi
+func ParseDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("bo'sh son")
+	}
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return 0, fmt.Errorf("noto'g'ri son: %s", s)
+		}
+		// int64 ga o'tkazishda toshib ketmasligi uchun oddiy yozuvdagi chegara bilan bir xil
+		if math.Abs(f) >= math.MaxInt64/decimalScale {
+			return 0, fmt.Errorf("son juda katta: %s", s)
+		}
+		return DecimalFromFloat(f), nil
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, fmt.Errorf("noto'g'ri son")
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+	for _, part := range []string{intPart, fracPart} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, fmt.Errorf("noto'g'ri son: %s", s)
+			}
+		}
+	}
+
+	whole, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil || whole > math.MaxInt64/decimalScale-1 {
+		return 0, fmt.Errorf("son juda katta: %s", s)
+	}
+
+	// Kasr qismi: birinchi 3 xona + yaxlitlash uchun 4-xona
+	var frac int64
+	for i := 0; i < decimalPlaces; i++ {
+		frac *= 10
+		if i < len(fracPart) {
+			frac += int64(fracPart[i] - '0')
+		}
+	}
+	if len(fracPart) > decimalPlaces && fracPart[decimalPlaces] >= '5' {
+		frac++
+	}
+
+	value := whole*decimalScale + frac
+	if negative {
+		value = -value
+	}
+	return Decimal(value), nil
+}
+
+func (d Decimal) Float64() float64 {
+	return float64(d) / decimalScale
+}
+
+func (d Decimal) IsZero() bool {
+	return d == 0
+}
+
+func (d Decimal) Add(other Decimal) Decimal {
+	return d + other
+}
+
+func (d Decimal) Sub(other Decimal) Decimal {
+	return d - other
+}
+
+// Ko'paytirish (masalan miqdor * narx), natija 3 xonaga yaxlitlanadi
+func (d Decimal) Mul(other Decimal) Decimal {
+	product := int64(d) * int64(other)
+	half := int64(decimalScale / 2)
+	if product < 0 {
+		half = -half
+	}
+	return Decimal((product + half) / decimalScale)
+}
+
+// d ni places xonagacha yaxlitlaydi (0 - butun son)
+func (d Decimal) Round(places int) Decimal {
+	if places >= decimalPlaces {
+		return d
+	}
+	unit := int64(math.Pow10(decimalPlaces - places))
+	half := unit / 2
+	if d < 0 {
+		half = -half
+	}
+	return Decimal((int64(d) + half) / unit * unit)
+}
+
+// d step ga karralimi (step > 0)
+func (d Decimal) IsMultipleOf(step Decimal) bool {
+	return step > 0 && int64(d)%int64(step) == 0
+}
+
+// Ortiqcha nollarsiz: 3 -> "3", 1.500 -> "1.5"
+func (d Decimal) String() string {
+	value := int64(d)
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	whole := value / decimalScale
+	frac := value % decimalScale
+	if frac == 0 {
+		return sign + strconv.FormatInt(whole, 10)
+	}
+	fracText := strings.TrimRight(fmt.Sprintf("%03d", frac), "0")
+	return fmt.Sprintf("%s%d.%s", sign, whole, fracText)
+}
+
+// JSON da oddiy son sifatida, aniq qiymat bilan: 0.3, 12, 1.125
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Son (1.5) yoki satr ("1.5") qabul qilinadi
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+	text := string(bytes.Trim(data, `"`))
+	if text == "" {
+		*d = 0
+		return nil
+	}
+	value, err := ParseDecimal(text)
+	if err != nil {
+		return err
+	}
+	*d = value
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Decimal
+		wantErr bool
+	}{
+		{in: "1", want: 1000},
+		{in: "1.25", want: 1250},
+		{in: " 0.3 ", want: 300},
+		{in: "+2.5", want: 2500},
+		{in: ".5", want: 500},
+		{in: "3.", want: 3000},
+		// 4-xona bo'yicha yaxlitlash: 5 va undan kattasi yuqoriga
+		{in: "1.0004", want: 1000},
+		{in: "1.0005", want: 1001},
+		{in: "1.00049999", want: 1000},
+		{in: "0.3000000119", want: 300},
+		{in: "0.9995", want: 1000},
+		// Manfiy sonlar noldan uzoqqa yaxlitlanadi
+		{in: "-1.25", want: -1250},
+		{in: "-0.0005", want: -1},
+		{in: "-0.0004", want: 0},
+		{in: "-2.9996", want: -3000},
+		// Eksponentli yozuv
+		{in: "1e3", want: 1000000},
+		{in: "1.5E-1", want: 150},
+		{in: "-2.5e0", want: -2500},
+		{in: "3e-4", want: 0},
+		{in: "5e-4", want: 1},
+		// Chegara: butun qism math.MaxInt64/1000 - 1 gacha
+		{in: "9223372036854774.999", want: 9223372036854774999},
+		{in: "9223372036854775", wantErr: true},
+		{in: "99999999999999999999", wantErr: true},
+		{in: "1e16", wantErr: true},
+		{in: "-1e300", wantErr: true},
+		// Noto'g'ri kiritish
+		{in: "", wantErr: true},
+		{in: "   ", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: ".", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: "--1", wantErr: true},
+		{in: "1,5", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1e", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "Inf", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDecimal(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDecimal(%q) = %v, xato kutilgan edi", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDecimal(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDecimal(%q) = %d, kutilgan %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecimalUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Decimal
+		wantErr bool
+	}{
+		{in: `1.5`, want: 1500},
+		{in: `"1.5"`, want: 1500},
+		{in: `" 2 "`, want: 2000},
+		{in: `-0.25`, want: -250},
+		{in: `"-0.25"`, want: -250},
+		{in: `1e2`, want: 100000},
+		{in: `"1e2"`, want: 100000},
+		{in: `0.30000001192092896`, want: 300},
+		{in: `""`, want: 0},
+		{in: `"abc"`, wantErr: true},
+		{in: `"null"`, wantErr: true},
+		{in: `true`, wantErr: true},
+	}
+	for _, tt := range tests {
+		d := Decimal(7)
+		err := json.Unmarshal([]byte(tt.in), &d)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %v, xato kutilgan edi", tt.in, d)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.in, err)
+			continue
+		}
+		if d != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, kutilgan %d", tt.in, d, tt.want)
+		}
+	}
+
+	// null - qiymat o'zgarmaydi (ko'rsatilmagan maydon kabi)
+	var item struct {
+		Count Decimal `json:"count"`
+	}
+	item.Count = 4200
+	if err := json.Unmarshal([]byte(`{"count": null}`), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Count != 4200 {
+		t.Errorf("null dan keyin %d, kutilgan 4200", item.Count)
+	}
+}
+
+func TestDecimalMarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   Decimal
+		want string
+	}{
+		{in: 0, want: `0`},
+		{in: 3000, want: `3`},
+		{in: 1500, want: `1.5`},
+		{in: 1125, want: `1.125`},
+		{in: 5, want: `0.005`},
+		{in: -250, want: `-0.25`},
+		{in: -5, want: `-0.005`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("Marshal(%d) = %s, kutilgan %s", tt.in, data, tt.want)
+		}
+		var back Decimal
+		if err := json.Unmarshal(data, &back); err != nil || back != tt.in {
+			t.Errorf("qayta o'qish %s = %d (%v), kutilgan %d", data, back, err, tt.in)
+		}
+	}
+}
+
+func TestDecimalMul(t *testing.T) {
+	tests := []struct {
+		a, b, want Decimal
+	}{
+		{a: 2000, b: 1500, want: 3000},    // 2 * 1.5
+		{a: 1500, b: 333, want: 500},      // 0.4995 -> 0.5
+		{a: 1500, b: 332, want: 498},      // 0.498
+		{a: 1, b: 500, want: 1},           // 0.0005 -> 0.001
+		{a: 1, b: 499, want: 0},           // 0.000499 -> 0
+		{a: -1500, b: 333, want: -500},    // -0.4995 -> -0.5
+		{a: 1500, b: -333, want: -500},    // -0.4995 -> -0.5
+		{a: -1500, b: -333, want: 500},    // 0.4995 -> 0.5
+		{a: -1, b: 500, want: -1},         // -0.0005 -> -0.001
+		{a: -1, b: 499, want: 0},          // -0.000499 -> 0
+		{a: -2500, b: 4000, want: -10000}, // -2.5 * 4
+		{a: 12345, b: 1000, want: 12345},  // x * 1
+		{a: 0, b: -1500, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Mul(tt.b); got != tt.want {
+			t.Errorf("%v * %v = %v, kutilgan %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDecimalRound(t *testing.T) {
+	tests := []struct {
+		in     Decimal
+		places int
+		want   Decimal
+	}{
+		{in: 1250, places: 1, want: 1300},
+		{in: 1249, places: 1, want: 1200},
+		{in: 1245, places: 2, want: 1250},
+		{in: 1244, places: 2, want: 1240},
+		{in: 2500, places: 0, want: 3000},
+		{in: 2499, places: 0, want: 2000},
+		{in: -2500, places: 0, want: -3000},
+		{in: -2499, places: 0, want: -2000},
+		{in: -1245, places: 2, want: -1250},
+		{in: 1234, places: 3, want: 1234},
+		{in: 1234, places: 5, want: 1234},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Round(tt.places); got != tt.want {
+			t.Errorf("%v.Round(%d) = %v, kutilgan %v", tt.in, tt.places, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Yetkazib berish slotlari: filial order berishda sana va vaqt oralig'ini tanlaydi,
+// admin har bir slot uchun filial bo'yicha kunlik cheklov qo'yadi
+var (
+	deliverySlots      []DeliverySlot
+	nextDeliverySlotID uint = 1
+
+	// Necha kun oldinga yetkazib berish sanasini tanlash mumkin
+	maxDeliveryDaysAhead = envInt("DELIVERY_MAX_DAYS_AHEAD", 14)
+)
+
+const deliverySlotsFile = "data/delivery_slots.json"
+
+func loadDeliverySlots() {
+	if data, err := ioutil.ReadFile(deliverySlotsFile); err == nil {
+		json.Unmarshal(data, &deliverySlots)
+		for _, s := range deliverySlots {
+			if s.ID >= nextDeliverySlotID {
+				nextDeliverySlotID = s.ID + 1
+			}
+		}
+	}
+}
+
+func saveDeliverySlots() {
+	data, _ := json.MarshalIndent(deliverySlots, "", "  ")
+	ioutil.WriteFile(deliverySlotsFile, data, 0644)
+}
+
+func findDeliverySlotByID(id uint) *DeliverySlot {
+	for i, s := range deliverySlots {
+		if s.ID == id {
+			return &deliverySlots[i]
+		}
+	}
+	return nil
+}
+
+func compareDeliverySlots(a, b DeliverySlot) int {
+	return cmp.Or(cmp.Compare(a.StartTime, b.StartTime), cmp.Compare(a.ID, b.ID))
+}
+
+func hasActiveDeliverySlots() bool {
+	return slices.ContainsFunc(deliverySlots, func(s DeliverySlot) bool { return s.Active })
+}
+
+// Slotning filial uchun kunlik cheklovi (0 - cheklanmagan)
+func (s *DeliverySlot) capacityFor(filialID uint) int {
+	for _, limit := range s.FilialLimits {
+		if limit.FilialID == filialID {
+			return limit.Capacity
+		}
+	}
+	return s.Capacity
+}
+
+func (s *DeliverySlot) label() string {
+	return fmt.Sprintf("%s-%s", s.StartTime, s.EndTime)
+}
+
+// Orderda saqlanadigan nom: "09:00-11:00 (Ertalab)" - slot o'zgarsa yoki o'chirilsa ham qoladi
+func (s *DeliverySlot) displayName() string {
+	return fmt.Sprintf("%s (%s)", s.label(), s.Name)
+}
+
+// Shu sana va slotga filialdan berilgan faol orderlar soni (ordersMu ostida chaqiriladi)
+func countSlotOrders(date string, slotID, filialID uint) int {
+	count := 0
+	for _, o := range orders {
+		if o.DeliveryDate == date && o.DeliverySlotID == slotID && o.FilialID == filialID && o.Status != "cancelled" {
+			count++
+		}
+	}
+	return count
+}
+
+// Yetkazib berish sanasi va slotini tekshiradi. Ikkalasi ham bo'sh bo'lsa - yetkazib berish vaqti tanlanmagan.
+// Faol slotlar bo'lsa sana bilan birga slot ham tanlanishi kerak.
+func validateDelivery(date string, slotID uint, now time.Time) (*DeliverySlot, error) {
+	if date == "" && slotID == 0 {
+		return nil, nil
+	}
+	if date == "" {
+		return nil, fmt.Errorf("yetkazib berish sanasi (delivery_date) majburiy")
+	}
+	day, today, err := validateDeliveryDate(date, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if slotID == 0 {
+		if hasActiveDeliverySlots() {
+			return nil, fmt.Errorf("yetkazib berish sloti (delivery_slot_id) tanlanishi kerak")
+		}
+		return nil, nil
+	}
+	slot := findDeliverySlotByID(slotID)
+	if slot == nil || !slot.Active {
+		return nil, fmt.Errorf("yetkazib berish sloti topilmadi: ID %d", slotID)
+	}
+	if day.Equal(today) && !clockOnDay(slot.StartTime, now).After(now) {
+		return nil, fmt.Errorf("bugungi %s slot vaqti o'tib ketgan", slot.label())
+	}
+	return slot, nil
+}
+
+// Sana formati va oralig'i (bugundan maxDeliveryDaysAhead kungacha); sana va bugungi kun qaytadi
+func validateDeliveryDate(date string, now time.Time) (day, today time.Time, err error) {
+	day, err = time.ParseInLocation("2006-01-02", date, businessLocation)
+	if err != nil {
+		return day, today, fmt.Errorf("noto'g'ri delivery_date formati (YYYY-MM-DD): %s", date)
+	}
+
+	local := now.In(businessLocation)
+	today = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, businessLocation)
+	if day.Before(today) {
+		return day, today, fmt.Errorf("yetkazib berish sanasi o'tib ketgan: %s", date)
+	}
+	if day.After(today.AddDate(0, 0, maxDeliveryDaysAhead)) {
+		return day, today, fmt.Errorf("yetkazib berish sanasi %d kundan uzoq bo'lmasligi kerak", maxDeliveryDaysAhead)
+	}
+	return day, today, nil
+}
+
+// Filial marshruti uchun slot cheklovi (0 - cheklanmagan)
+func (s *DeliverySlot) routeCapacityFor(filialID uint) (*DeliveryRoute, int) {
+	route := routeForFilial(filialID)
+	if route == nil {
+		return nil, 0
+	}
+	for _, limit := range s.RouteLimits {
+		if limit.RouteID == route.ID {
+			return route, limit.Capacity
+		}
+	}
+	return route, 0
+}
+
+// Slot uchun eng tor cheklov: filial yoki uning marshruti (ordersMu ostida chaqiriladi).
+// capacity = 0 - cheklanmagan.
+func slotUsage(slot *DeliverySlot, date string, filialID uint) (capacity, booked int) {
+	capacity = slot.capacityFor(filialID)
+	booked = countSlotOrders(date, slot.ID, filialID)
+
+	route, routeCapacity := slot.routeCapacityFor(filialID)
+	if routeCapacity > 0 {
+		routeBooked := 0
+		for _, id := range route.FilialIDs {
+			routeBooked += countSlotOrders(date, slot.ID, id)
+		}
+		if capacity == 0 || routeCapacity-routeBooked < capacity-booked {
+			return routeCapacity, routeBooked
+		}
+	}
+	return capacity, booked
+}
+
+// Slotda joy qolmagan - so'rov to'g'ri, lekin hozirgi holat bilan to'qnashadi (409)
+type SlotFullError struct {
+	Date string
+	Slot string
+}
+
+func (e *SlotFullError) Error() string {
+	return fmt.Sprintf("%s %s sloti to'lgan, boshqa vaqtni tanlang", e.Date, e.Slot)
+}
+
+// Slotda filial (va marshrut) uchun joy borligini tekshiradi (ordersMu ostida chaqiriladi)
+func checkSlotCapacity(slot *DeliverySlot, date string, filialID uint) error {
+	capacity, booked := slotUsage(slot, date, filialID)
+	if capacity > 0 && booked >= capacity {
+		return &SlotFullError{Date: date, Slot: slot.label()}
+	}
+	return nil
+}
+
+// Chek va Telegram uchun: "2026-10-20 09:00-11:00 (Ertalab)"
+func deliveryLabel(order *Order) string {
+	if order.DeliveryDate == "" {
+		return ""
+	}
+	return strings.TrimSpace(order.DeliveryDate + " " + order.DeliverySlot)
+}
+
+// Filial uchun sana bo'yicha slotlar va bo'sh joylar
+func GetDeliverySlotAvailability(filialID uint, date string, now time.Time) ([]DeliverySlotAvailability, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, businessLocation)
+	if err != nil {
+		return nil, fmt.Errorf("noto'g'ri date formati (YYYY-MM-DD): %s", date)
+	}
+
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+
+	result := []DeliverySlotAvailability{}
+	for _, slot := range GetAllDeliverySlots() {
+		if !slot.Active {
+			continue
+		}
+		capacity, booked := slotUsage(&slot, date, filialID)
+		entry := DeliverySlotAvailability{
+			ID:        slot.ID,
+			Name:      slot.Name,
+			StartTime: slot.StartTime,
+			EndTime:   slot.EndTime,
+			Capacity:  capacity,
+			Booked:    booked,
+			Available: true,
+		}
+		if entry.Capacity > 0 {
+			remaining := max(entry.Capacity-entry.Booked, 0)
+			entry.Remaining = &remaining
+			entry.Available = remaining > 0
+		}
+		if !clockOnDay(slot.StartTime, day).After(now) {
+			entry.Available = false
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// Orderlarni yetkazib berish sanasi va sloti bo'yicha guruhlaydi (sana tanlanmagan orderlar kirmaydi)
+func GroupOrdersByDeliverySlot(list []Order) []DeliverySlotOrders {
+	type groupKey struct {
+		date   string
+		slotID uint
+	}
+	index := make(map[groupKey]int)
+	groups := []DeliverySlotOrders{}
+
+	for _, order := range list {
+		if order.DeliveryDate == "" {
+			continue
+		}
+		key := groupKey{order.DeliveryDate, order.DeliverySlotID}
+		idx, ok := index[key]
+		if !ok {
+			idx = len(groups)
+			index[key] = idx
+			group := DeliverySlotOrders{
+				DeliveryDate: order.DeliveryDate,
+				SlotID:       order.DeliverySlotID,
+				Label:        order.DeliverySlot,
+				Orders:       []Order{},
+			}
+			if slot := findDeliverySlotByID(order.DeliverySlotID); slot != nil {
+				group.Name = slot.Name
+				group.StartTime = slot.StartTime
+				group.EndTime = slot.EndTime
+			}
+			groups = append(groups, group)
+		}
+		groups[idx].Orders = append(groups[idx].Orders, order)
+		groups[idx].OrderCount++
+	}
+
+	// Sana, keyin slot boshlanish vaqti bo'yicha; slotsizlar kun oxirida
+	slices.SortStableFunc(groups, func(a, b DeliverySlotOrders) int {
+		return cmp.Or(
+			cmp.Compare(a.DeliveryDate, b.DeliveryDate),
+			cmp.Compare(slotlessRank(a.SlotID), slotlessRank(b.SlotID)),
+			cmp.Compare(a.StartTime, b.StartTime),
+			cmp.Compare(a.SlotID, b.SlotID),
+		)
+	})
+	for i := range groups {
+		slices.SortStableFunc(groups[i].Orders, func(a, b Order) int { return a.Created.Compare(b.Created) })
+	}
+	return groups
+}
+
+func slotlessRank(slotID uint) int {
+	if slotID == 0 {
+		return 1
+	}
+	return 0
+}
+
+// ============= CRUD =============
+func validateDeliverySlot(req DeliverySlotRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("slot nomi majburiy")
+	}
+	start, err := time.Parse("15:04", req.StartTime)
+	if err != nil {
+		return fmt.Errorf("start_time HH:MM formatida bo'lishi kerak")
+	}
+	end, err := time.Parse("15:04", req.EndTime)
+	if err != nil {
+		return fmt.Errorf("end_time HH:MM formatida bo'lishi kerak")
+	}
+	if !start.Before(end) {
+		return fmt.Errorf("start_time end_time dan oldin bo'lishi kerak")
+	}
+	if req.Capacity < 0 {
+		return fmt.Errorf("capacity manfiy bo'lishi mumkin emas")
+	}
+	seen := make(map[uint]bool)
+	for _, limit := range req.FilialLimits {
+		if findFilialByID(limit.FilialID) == nil {
+			return fmt.Errorf("filial topilmadi: ID %d", limit.FilialID)
+		}
+		if seen[limit.FilialID] {
+			return fmt.Errorf("filial ID %d bir necha marta kiritilgan", limit.FilialID)
+		}
+		seen[limit.FilialID] = true
+		if limit.Capacity < 0 {
+			return fmt.Errorf("capacity manfiy bo'lishi mumkin emas")
+		}
+	}
+	seenRoutes := make(map[uint]bool)
+	for _, limit := range req.RouteLimits {
+		if findDeliveryRouteByID(limit.RouteID) == nil {
+			return fmt.Errorf("marshrut topilmadi: ID %d", limit.RouteID)
+		}
+		if seenRoutes[limit.RouteID] {
+			return fmt.Errorf("marshrut ID %d bir necha marta kiritilgan", limit.RouteID)
+		}
+		seenRoutes[limit.RouteID] = true
+		if limit.Capacity < 0 {
+			return fmt.Errorf("capacity manfiy bo'lishi mumkin emas")
+		}
+	}
+	return nil
+}
+
+func CreateDeliverySlot(req DeliverySlotRequest) (*DeliverySlot, error) {
+	if err := validateDeliverySlot(req); err != nil {
+		return nil, err
+	}
+
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	slot := DeliverySlot{
+		ID:           nextDeliverySlotID,
+		Name:         strings.TrimSpace(req.Name),
+		StartTime:    req.StartTime,
+		EndTime:      req.EndTime,
+		Capacity:     req.Capacity,
+		FilialLimits: req.FilialLimits,
+		RouteLimits:  req.RouteLimits,
+		Active:       req.Active == nil || *req.Active,
+		Version:      1,
+	}
+	deliverySlots = append(deliverySlots, slot)
+	nextDeliverySlotID++
+	saveDeliverySlots()
+	return &slot, nil
+}
+
+func GetAllDeliverySlots() []DeliverySlot {
+	sorted := slices.Clone(deliverySlots)
+	slices.SortStableFunc(sorted, compareDeliverySlots)
+	return sorted
+}
+
+func GetDeliverySlotByID(id uint) *DeliverySlot {
+	return findDeliverySlotByID(id)
+}
+
+func UpdateDeliverySlot(id uint, req DeliverySlotRequest, ifMatch string) (*DeliverySlot, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	slot := findDeliverySlotByID(id)
+	if slot == nil {
+		return nil, nil
+	}
+	if err := checkVersion(ifMatch, entityETag("delivery-slot", slot.ID, slot.Version), *slot); err != nil {
+		return nil, err
+	}
+	if err := validateDeliverySlot(req); err != nil {
+		return nil, err
+	}
+	slot.Name = strings.TrimSpace(req.Name)
+	slot.StartTime = req.StartTime
+	slot.EndTime = req.EndTime
+	slot.Capacity = req.Capacity
+	slot.FilialLimits = req.FilialLimits
+	slot.RouteLimits = req.RouteLimits
+	if req.Active != nil {
+		slot.Active = *req.Active
+	}
+	slot.Version++
+	saveDeliverySlots()
+
+	result := *slot
+	return &result, nil
+}
+
+// Mavjud orderlarda slot nomi (DeliverySlot) saqlanib qoladi
+func DeleteDeliverySlot(id uint, ifMatch string) (bool, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	for i, s := range deliverySlots {
+		if s.ID == id {
+			if err := checkVersion(ifMatch, entityETag("delivery-slot", s.ID, s.Version), s); err != nil {
+				return false, err
+			}
+			deliverySlots = append(deliverySlots[:i], deliverySlots[i+1:]...)
+			saveDeliverySlots()
+			return true, nil
+		}
+	}
+	return false, nil
+}
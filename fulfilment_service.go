@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Qator bo'yicha jo'natish: ombor/oshxona orderni qismlab jo'natadi, yetishmagan
+// miqdor sababi bilan "kamomad" sifatida yopiladi. Order statusi qatorlar holatidan kelib chiqadi:
+// ochiq qator qolsa "partially_shipped", hammasi yopilsa "shipped".
+
+// Qator holati: "" - jo'natilmagan, "partial" - qisman, "fulfilled" - to'liq, "short" - kamomad bilan yopilgan
+func itemFulfilmentStatus(item *OrderItem) string {
+	if itemRemaining(item) > 0 {
+		if item.Fulfilled > 0 {
+			return "partial"
+		}
+		return ""
+	}
+	if item.Shortage > 0 {
+		return "short"
+	}
+	return "fulfilled"
+}
+
+// Hali jo'natilmagan va kamomad deb yopilmagan miqdor
+func itemRemaining(item *OrderItem) Decimal {
+	return item.Count.Sub(item.Fulfilled).Sub(item.Shortage)
+}
+
+// Filialga yetib borishi kutilayotgan miqdor (kamomad ayirilgan) - ombor qoldig'i va manifest uchun
+func expectedCount(item OrderItem) Decimal {
+	return item.Count.Sub(item.Shortage)
+}
+
+func fulfilmentOrderStatus(order *Order) string {
+	if order.Status == "delivered" {
+		return order.Status
+	}
+	open, touched := false, false
+	for i := range order.Items {
+		item := &order.Items[i]
+		if itemRemaining(item) > 0 {
+			open = true
+		}
+		if item.Fulfilled > 0 || item.Shortage > 0 {
+			touched = true
+		}
+	}
+	switch {
+	case !open:
+		return "shipped"
+	case touched:
+		return "partially_shipped"
+	}
+	return order.Status
+}
+
+// Jo'natmani qayd qiladi. ship_remaining=true bo'lsa so'rovda ko'rsatilmagan ochiq
+// qatorlar qolgan miqdori bilan to'liq jo'natilgan hisoblanadi.
+func RecordShipment(orderID uint, actor *User, req ShipmentRequest, ifMatch string) (*Order, *OrderShipment, error) {
+	note, err := sanitizeNote(req.Note, maxOrderCommentLength)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+
+	order := findOrderByID(orderID)
+	if order == nil {
+		return nil, nil, fmt.Errorf("order topilmadi")
+	}
+	if err := checkVersion(ifMatch, entityETag("order", order.ID, order.Version), *order); err != nil {
+		return nil, nil, err
+	}
+	if order.Status == "cancelled" {
+		return nil, nil, fmt.Errorf("order bekor qilingan")
+	}
+
+	type pending struct {
+		idx      int
+		count    Decimal
+		shortage Decimal
+		reason   string
+	}
+	var lines []pending
+	seen := make(map[orderLineKey]bool)
+	for _, line := range req.Items {
+		key := lineKey(line.ProductID, line.VariantID)
+		if seen[key] {
+			return nil, nil, fmt.Errorf("mahsulot ID %d bir necha marta kiritilgan", line.ProductID)
+		}
+		seen[key] = true
+
+		idx := -1
+		for i, item := range order.Items {
+			if lineKey(item.ProductID, item.VariantID) == key {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, nil, fmt.Errorf("mahsulot ID %d orderda yo'q", line.ProductID)
+		}
+		item := &order.Items[idx]
+		label := itemLabel(item.Name, item.VariantName)
+		remaining := itemRemaining(item)
+		if remaining <= 0 {
+			return nil, nil, fmt.Errorf("%s allaqachon yopilgan", label)
+		}
+		if line.Count < 0 || (line.Count == 0 && !line.Short) {
+			return nil, nil, fmt.Errorf("%s: jo'natilgan miqdor 0 dan katta bo'lishi kerak", label)
+		}
+		if !line.Count.IsMultipleOf(unitPrecision(item.Type)) {
+			return nil, nil, fmt.Errorf("%s: miqdor %s birligiga mos emas", label, item.Type)
+		}
+		if line.Count > remaining {
+			return nil, nil, fmt.Errorf("%s: jo'natilgan miqdor qolgan %s dan ko'p", label, formatQuantityWithUnit(remaining, item.Type))
+		}
+
+		p := pending{idx: idx, count: line.Count}
+		if line.Short && line.Count < remaining {
+			reason, err := sanitizeNote(line.Reason, maxChangeReasonLength)
+			if err != nil {
+				return nil, nil, err
+			}
+			if reason == "" {
+				return nil, nil, fmt.Errorf("%s: kamomad sababi majburiy", label)
+			}
+			p.shortage = remaining.Sub(line.Count)
+			p.reason = reason
+		}
+		lines = append(lines, p)
+	}
+	if req.ShipRemaining {
+		for i := range order.Items {
+			item := &order.Items[i]
+			if seen[lineKey(item.ProductID, item.VariantID)] || itemRemaining(item) <= 0 {
+				continue
+			}
+			lines = append(lines, pending{idx: i, count: itemRemaining(item)})
+		}
+	}
+	if len(lines) == 0 {
+		return nil, nil, fmt.Errorf("jo'natma bo'sh")
+	}
+
+	shipment := OrderShipment{
+		ID:       uint(len(order.Shipments) + 1),
+		Note:     note,
+		UserID:   actor.ID,
+		Username: actor.Name,
+		Created:  time.Now(),
+	}
+	for _, p := range lines {
+		item := &order.Items[p.idx]
+		item.Fulfilled = item.Fulfilled.Add(p.count)
+		item.Shortage = item.Shortage.Add(p.shortage)
+		if p.reason != "" {
+			item.ShortReason = p.reason
+		}
+		item.FulfilmentStatus = itemFulfilmentStatus(item)
+		shipment.Items = append(shipment.Items, ShipmentItem{
+			ProductID:   item.ProductID,
+			VariantID:   item.VariantID,
+			Name:        item.Name,
+			VariantName: item.VariantName,
+			Type:        item.Type,
+			Count:       p.count,
+			Shortage:    p.shortage,
+			Reason:      p.reason,
+		})
+	}
+
+	order.Shipments = append(order.Shipments, shipment)
+	order.Status = fulfilmentOrderStatus(order)
+	order.Updated = shipment.Created
+	order.Version++
+	saveOrders()
+	syncOrderStock(order)
+	publishKDSEvent(order, "updated")
+
+	result := *order
+	return &result, &shipment, nil
+}
+
+// Filial uchun: buyurtma qilingan va haqiqatda yetkazilgan miqdorlar.
+// Jo'natma qayd qilinmagan, lekin yetkazildi deb belgilangan orderda butun miqdor yetkazilgan hisoblanadi.
+func BuildOrderFulfilment(order *Order) OrderFulfilment {
+	result := OrderFulfilment{
+		ID:        order.ID,
+		OrderID:   order.OrderID,
+		Status:    order.Status,
+		Lines:     []FulfilmentLine{},
+		Shipments: order.Shipments,
+	}
+	if result.Shipments == nil {
+		result.Shipments = []OrderShipment{}
+	}
+	for i := range order.Items {
+		item := &order.Items[i]
+		delivered := item.Fulfilled
+		status := item.FulfilmentStatus
+		if len(order.Shipments) == 0 && order.Status == "delivered" {
+			delivered = item.Count
+			status = "fulfilled"
+		}
+		line := FulfilmentLine{
+			ProductID:    item.ProductID,
+			VariantID:    item.VariantID,
+			Name:         item.Name,
+			VariantName:  item.VariantName,
+			Type:         item.Type,
+			Ordered:      item.Count,
+			Delivered:    delivered,
+			Shortage:     item.Shortage,
+			Pending:      item.Count.Sub(delivered).Sub(item.Shortage),
+			OrderedQty:   formatQuantityWithUnit(item.Count, item.Type),
+			DeliveredQty: formatQuantityWithUnit(delivered, item.Type),
+			Status:       status,
+			Reason:       item.ShortReason,
+		}
+		if line.Shortage > 0 {
+			result.HasShortage = true
+		}
+		result.Lines = append(result.Lines, line)
+	}
+	return result
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// POST /api/orders uchun Idempotency-Key: mobil ilova timeoutdan keyin qayta yuborsa
+// yangi order yaratilmaydi, birinchi javob qaytariladi.
+type IdempotencyRecord struct {
+	Key     string `json:"key"`
+	UserID  uint   `json:"user_id"`
+	OrderID string `json:"order_id,omitempty"`
+	// So'rov tanasining hash i: bir kalit boshqa tana bilan kelsa rad etiladi
+	RequestHash string          `json:"request_hash,omitempty"`
+	StatusCode  int             `json:"status_code"`
+	Response    json.RawMessage `json:"response"`
+	Created     time.Time       `json:"created"`
+}
+
+var (
+	idempotencyRecords []IdempotencyRecord
+	idempotencyMu      sync.Mutex
+	// Hali javobi tayyor bo'lmagan kalitlar va ularning so'rov hash i (parallel qayta yuborishlar uchun)
+	idempotencyInFlight = make(map[string]string)
+
+	// Kalit shuncha vaqt saqlanadi
+	idempotencyWindow = time.Duration(envInt("IDEMPOTENCY_WINDOW_MINUTES", 24*60)) * time.Minute
+	// Bir user shuncha daqiqa ichida aynan bir xil order bersa Telegram ga ogohlantirish (0 - o'chirilgan)
+	duplicateOrderWindow = time.Duration(envInt("DUPLICATE_ORDER_WINDOW_MINUTES", 10)) * time.Minute
+)
+
+const (
+	idempotencyFile       = "data/idempotency_keys.json"
+	maxIdempotencyKeySize = 255
+)
+
+func loadIdempotencyRecords() {
+	if data, err := ioutil.ReadFile(idempotencyFile); err == nil {
+		json.Unmarshal(data, &idempotencyRecords)
+	}
+	pruneIdempotencyRecords(time.Now())
+}
+
+func saveIdempotencyRecords() {
+	data, _ := json.MarshalIndent(idempotencyRecords, "", "  ")
+	ioutil.WriteFile(idempotencyFile, data, 0644)
+}
+
+// Muddati o'tgan kalitlarni olib tashlaydi (idempotencyMu ostida chaqiriladi)
+func pruneIdempotencyRecords(now time.Time) {
+	idempotencyRecords = slices.DeleteFunc(idempotencyRecords, func(rec IdempotencyRecord) bool {
+		return now.Sub(rec.Created) > idempotencyWindow
+	})
+}
+
+// Kalit boshqa so'rov tanasi bilan qayta ishlatilgan
+var ErrIdempotencyKeyReused = errors.New("Idempotency-Key boshqa so'rov bilan ishlatilgan")
+
+func idempotencyScope(userID uint, key string) string {
+	return fmt.Sprintf("%d:%s", userID, key)
+}
+
+// So'rovni JSON ga qayta kodlab hash olamiz - bo'sh joy va maydonlar tartibi farqi ahamiyatsiz
+func idempotencyRequestHash(req interface{}) string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Kalit bo'yicha saqlangan javob; yo'q bo'lsa kalitni "bajarilmoqda" deb belgilaydi.
+// inFlight = true - shu kalit bilan so'rov hozir bajarilmoqda.
+// Kalit boshqa tana bilan kelsa ErrIdempotencyKeyReused qaytadi.
+func BeginIdempotentRequest(userID uint, key, requestHash string) (record *IdempotencyRecord, inFlight bool, err error) {
+	idempotencyMu.Lock()
+	defer idempotencyMu.Unlock()
+
+	now := time.Now()
+	for i, rec := range idempotencyRecords {
+		if rec.UserID == userID && rec.Key == key && now.Sub(rec.Created) <= idempotencyWindow {
+			// Eski yozuvlarda hash bo'lmaydi
+			if rec.RequestHash != "" && rec.RequestHash != requestHash {
+				return nil, false, ErrIdempotencyKeyReused
+			}
+			found := idempotencyRecords[i]
+			return &found, false, nil
+		}
+	}
+
+	scope := idempotencyScope(userID, key)
+	if pending, ok := idempotencyInFlight[scope]; ok {
+		if pending != requestHash {
+			return nil, false, ErrIdempotencyKeyReused
+		}
+		return nil, true, nil
+	}
+	idempotencyInFlight[scope] = requestHash
+	return nil, false, nil
+}
+
+// Yozuvlar fayli yo'qolgan bo'lsa ham kalit order bilan saqlangani uchun uni topamiz.
+// Parallel CreateOrder slice ni qayta ajratishi mumkin - nusxa qaytariladi.
+func FindOrderByIdempotencyKey(userID uint, key string) *Order {
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+
+	now := time.Now()
+	for i := len(orders) - 1; i >= 0; i-- {
+		o := &orders[i]
+		if o.UserID == userID && o.IdempotencyKey == key && now.Sub(o.Created) <= idempotencyWindow {
+			found := *o
+			return &found
+		}
+	}
+	return nil
+}
+
+// Javobni saqlaydi. 5xx javoblar saqlanmaydi (order yaratilmagan bo'lsa qayta urinish mumkin),
+// lekin order yaratilgan bo'lsa (masalan chek yuborilmadi) saqlanadi.
+func FinishIdempotentRequest(userID uint, key string, statusCode int, body []byte, orderID string) {
+	idempotencyMu.Lock()
+	defer idempotencyMu.Unlock()
+
+	scope := idempotencyScope(userID, key)
+	requestHash := idempotencyInFlight[scope]
+	delete(idempotencyInFlight, scope)
+	if statusCode >= 500 && orderID == "" {
+		return
+	}
+
+	now := time.Now()
+	pruneIdempotencyRecords(now)
+	idempotencyRecords = append(idempotencyRecords, IdempotencyRecord{
+		Key:         key,
+		UserID:      userID,
+		OrderID:     orderID,
+		RequestHash: requestHash,
+		StatusCode:  statusCode,
+		Response:    json.RawMessage(bytes.TrimSpace(body)),
+		Created:     now,
+	})
+	saveIdempotencyRecords()
+}
+
+// Javob saqlanmasdan kalitni bo'shatadi
+func AbortIdempotentRequest(userID uint, key string) {
+	idempotencyMu.Lock()
+	defer idempotencyMu.Unlock()
+	delete(idempotencyInFlight, idempotencyScope(userID, key))
+}
+
+// Javobni klientga yozish bilan birga nusxasini ham oladi
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(statusCode int) {
+	rw.statusCode = statusCode
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *recordingResponseWriter) Write(data []byte) (int, error) {
+	if rw.statusCode == 0 {
+		rw.statusCode = http.StatusOK
+	}
+	rw.body.Write(data)
+	return rw.ResponseWriter.Write(data)
+}
+
+// Bir xil mahsulot, variant va miqdorlar (tartibdan qat'i nazar)
+func sameOrderItems(a, b []OrderItem) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[orderLineKey]Decimal, len(a))
+	for _, item := range a {
+		key := lineKey(item.ProductID, item.VariantID)
+		counts[key] = counts[key].Add(item.Count)
+	}
+	for _, item := range b {
+		key := lineKey(item.ProductID, item.VariantID)
+		counts[key] = counts[key].Sub(item.Count)
+	}
+	for _, diff := range counts {
+		if !diff.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// Shu userning oxirgi N daqiqadagi aynan bir xil orderi (bekor qilinganlardan tashqari)
+func FindPossibleDuplicateOrder(order *Order) *Order {
+	if duplicateOrderWindow <= 0 {
+		return nil
+	}
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+	for i := len(orders) - 1; i >= 0; i-- {
+		other := &orders[i]
+		if other.ID == order.ID || other.UserID != order.UserID || other.Status == "cancelled" {
+			continue
+		}
+		if order.Created.Sub(other.Created) > duplicateOrderWindow || other.Created.After(order.Created) {
+			continue
+		}
+		if sameOrderItems(order.Items, other.Items) {
+			duplicate := *other
+			return &duplicate
+		}
+	}
+	return nil
+}
+
+// Takroriy order bo'lishi mumkin - orderni to'xtatmaymiz, faqat Telegram ga ogohlantiramiz.
+// Javobni kutdirmaslik uchun goroutine da chaqiriladi.
+func notifyPossibleDuplicateOrder(order Order) {
+	duplicate := FindPossibleDuplicateOrder(&order)
+	if duplicate == nil {
+		return
+	}
+	log.Printf("⚠️ Takroriy order bo'lishi mumkin: %s va %s (%s)", order.OrderID, duplicate.OrderID, order.Username)
+
+	minutes := int(order.Created.Sub(duplicate.Created).Minutes())
+	var text strings.Builder
+	text.WriteString("⚠️ *ВОЗМОЖЕН ДУБЛИКАТ ЗАКАЗА*\n\n")
+	text.WriteString(fmt.Sprintf("📋 *Новый заказ:* `%s`\n", order.OrderID))
+	text.WriteString(fmt.Sprintf("📋 *Похожий заказ:* `%s` (%d мин. назад)\n", duplicate.OrderID, minutes))
+	text.WriteString(fmt.Sprintf("👤 *Клиент:* %s\n", order.Username))
+	text.WriteString(fmt.Sprintf("🏢 *Ветвь:* %s", order.FilialName))
+	if err := sendTelegramText(text.String()); err != nil {
+		log.Printf("Telegram ga yuborishda xato: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func resetIdempotencyState(t *testing.T) {
+	idempotencyRecords = nil
+	idempotencyInFlight = make(map[string]string)
+	t.Cleanup(func() {
+		idempotencyRecords = nil
+		idempotencyInFlight = make(map[string]string)
+	})
+}
+
+// Kalit bo'yicha qidiruv parallel yaratilayotgan orderlar bilan poyga qilmasligi kerak (-race)
+func TestFindOrderByIdempotencyKeyConcurrent(t *testing.T) {
+	setupOrderTestData(t, "{date}-{seq}")
+	resetIdempotencyState(t)
+
+	first, err := CreateOrder(1, CreateOrderRequest{
+		Items:          []CreateOrderItem{{ProductID: 1, Count: NewDecimal(1)}},
+		IdempotencyKey: "retry-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 50
+	var wg sync.WaitGroup
+	found := make([]*Order, n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := CreateOrder(2, CreateOrderRequest{
+				Items: []CreateOrderItem{{ProductID: 1, Count: NewDecimal(1)}},
+			}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			found[i] = FindOrderByIdempotencyKey(1, "retry-1")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, o := range found {
+		if o == nil || o.OrderID != first.OrderID {
+			t.Fatalf("qidiruv %d: kutilgan %s, olindi %+v", i, first.OrderID, o)
+		}
+	}
+	if o := FindOrderByIdempotencyKey(2, "retry-1"); o != nil {
+		t.Fatalf("boshqa user kaliti topildi: %s", o.OrderID)
+	}
+
+	// Qaytgan qiymat nusxa: uni o'zgartirish saqlangan orderga ta'sir qilmaydi
+	found[0].Status = "cancelled"
+	if o := FindOrderByIdempotencyKey(1, "retry-1"); o.Status == "cancelled" {
+		t.Fatal("saqlangan order o'zgarib ketdi")
+	}
+}
+
+// createOrderHandler ni to'g'ridan-to'g'ri chaqiradi (authenticateJWT qo'yadigan User-ID bilan)
+func postOrderWithKey(userID, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(body))
+	r.Header.Set("User-ID", userID)
+	r.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	createOrderHandler(w, r)
+	return w
+}
+
+func orderRequestHash(t *testing.T, body string) string {
+	t.Helper()
+	var req CreateOrderRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	return idempotencyRequestHash(req)
+}
+
+const idempotencyTestBody = `{"items": [{"product_id": 1, "count": 2}]}`
+
+func TestIdempotentRequestReplay(t *testing.T) {
+	setupOrderTestData(t, "{date}-{seq}")
+	resetIdempotencyState(t)
+
+	hash := orderRequestHash(t, idempotencyTestBody)
+	if record, inFlight, err := BeginIdempotentRequest(1, "k1", hash); record != nil || inFlight || err != nil {
+		t.Fatalf("yangi kalit: %v %v %v", record, inFlight, err)
+	}
+	FinishIdempotentRequest(1, "k1", http.StatusOK, []byte(`{"success":true,"message":"saqlangan"}`), "A-1")
+
+	// Bo'sh joy va maydonlar tartibi boshqacha, lekin so'rov bir xil - saqlangan javob qaytadi
+	w := postOrderWithKey("1", "k1", `{ "items":[{"count":2,"product_id":1}] }`)
+	if w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("takrorlash: %d %s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "saqlangan") {
+		t.Fatalf("saqlangan javob qaytmadi: %s", w.Body)
+	}
+	if len(orders) != 0 {
+		t.Fatalf("takrorlashda order yaratildi: %d", len(orders))
+	}
+
+	// Kalit user bo'yicha: boshqa user uchun bu yangi kalit
+	if record, _, _ := BeginIdempotentRequest(2, "k1", hash); record != nil {
+		t.Fatal("boshqa userning javobi qaytdi")
+	}
+}
+
+func TestIdempotentRequestKeyReused(t *testing.T) {
+	setupOrderTestData(t, "{date}-{seq}")
+	resetIdempotencyState(t)
+
+	BeginIdempotentRequest(1, "k1", orderRequestHash(t, idempotencyTestBody))
+	FinishIdempotentRequest(1, "k1", http.StatusOK, []byte(`{"success":true}`), "A-1")
+
+	w := postOrderWithKey("1", "k1", `{"items": [{"product_id": 1, "count": 3}]}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("boshqa tana bilan kalit: %d %s, kutilgan 422", w.Code, w.Body)
+	}
+	if len(orders) != 0 {
+		t.Fatalf("order yaratildi: %d", len(orders))
+	}
+}
+
+func TestIdempotentRequestInFlight(t *testing.T) {
+	setupOrderTestData(t, "{date}-{seq}")
+	resetIdempotencyState(t)
+
+	// Birinchi so'rov hali tugamagan
+	if _, inFlight, err := BeginIdempotentRequest(1, "k1", orderRequestHash(t, idempotencyTestBody)); inFlight || err != nil {
+		t.Fatalf("birinchi so'rov: %v %v", inFlight, err)
+	}
+
+	w := postOrderWithKey("1", "k1", idempotencyTestBody)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("parallel qayta yuborish: %d %s, kutilgan 409", w.Code, w.Body)
+	}
+	w = postOrderWithKey("1", "k1", `{"items": [{"product_id": 1, "count": 3}]}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("bajarilayotgan kalit boshqa tana bilan: %d %s, kutilgan 422", w.Code, w.Body)
+	}
+	if len(orders) != 0 {
+		t.Fatalf("order yaratildi: %d", len(orders))
+	}
+
+	// Bekor qilingan kalit bo'shaydi
+	AbortIdempotentRequest(1, "k1")
+	if _, inFlight, _ := BeginIdempotentRequest(1, "k1", orderRequestHash(t, idempotencyTestBody)); inFlight {
+		t.Fatal("bekor qilingan kalit hali band")
+	}
+}
+
+func TestIdempotentRequestServerErrorNotStored(t *testing.T) {
+	setupOrderTestData(t, "{date}-{seq}")
+	resetIdempotencyState(t)
+	hash := orderRequestHash(t, idempotencyTestBody)
+
+	// Order yaratilmagan 5xx - saqlanmaydi, qayta urinish mumkin
+	BeginIdempotentRequest(1, "k1", hash)
+	FinishIdempotentRequest(1, "k1", http.StatusInternalServerError, []byte(`{"success":false}`), "")
+	record, inFlight, err := BeginIdempotentRequest(1, "k1", hash)
+	if record != nil || inFlight || err != nil {
+		t.Fatalf("5xx saqlandi: %v %v %v", record, inFlight, err)
+	}
+	AbortIdempotentRequest(1, "k1")
+
+	// Order yaratilgan (chek yuborilmagan) 5xx - saqlanadi, aks holda qayta urinish ikkinchi order yaratadi
+	BeginIdempotentRequest(1, "k2", hash)
+	FinishIdempotentRequest(1, "k2", http.StatusInternalServerError, []byte(`{"success":false}`), "A-1")
+	record, _, _ = BeginIdempotentRequest(1, "k2", hash)
+	if record == nil || record.StatusCode != http.StatusInternalServerError || record.OrderID != "A-1" {
+		t.Fatalf("order yaratilgan 5xx saqlanmadi: %+v", record)
+	}
+
+	// 4xx har doim saqlanadi
+	BeginIdempotentRequest(1, "k3", hash)
+	FinishIdempotentRequest(1, "k3", http.StatusBadRequest, []byte(`{"success":false}`), "")
+	if record, _, _ := BeginIdempotentRequest(1, "k3", hash); record == nil || record.StatusCode != http.StatusBadRequest {
+		t.Fatalf("4xx saqlanmadi: %+v", record)
+	}
+}
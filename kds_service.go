@@ -0,0 +1,326 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Oshxona ekranlari (KDS). Stansiya - printer (chek qaysi printerga chiqsa, qator
+// o'sha stansiya ekranida ko'rinadi); ekran kerak bo'lsa kategoriya bo'yicha toraytiriladi.
+// Qator "bump" qilinsa tayyor hisoblanadi, "recall" bilan navbatga qaytadi.
+// Birinchi bump orderni "preparing" ga, barcha stansiyalar bump qilgach "ready" ga o'tkazadi.
+
+const kitchenBumped = "bumped"
+
+// Oshxona navbatida ko'rinadigan order statuslari
+var kdsOpenStatuses = []string{"pending", "confirmed", "sent_to_printer", "print_error", "preparing"}
+
+// Stansiya filtri: printer majburiy, kategoriyalar ixtiyoriy
+type kdsStation struct {
+	Printer     uint
+	CategoryIDs []uint
+}
+
+// Qator qaysi stansiyaga tegishli (mahsulot yoki kategoriya o'chirilgan bo'lsa ok=false)
+func itemStation(item OrderItem) (printer uint, category *Category, ok bool) {
+	product := findProductByID(item.ProductID)
+	if product == nil {
+		return 0, nil, false
+	}
+	category = findCategoryByID(product.CategoryID)
+	if category == nil {
+		return 0, nil, false
+	}
+	return category.Printer, category, true
+}
+
+func (s kdsStation) matches(item OrderItem) (*Category, bool) {
+	printer, category, ok := itemStation(item)
+	if !ok || printer != s.Printer {
+		return nil, false
+	}
+	if len(s.CategoryIDs) > 0 && !slices.Contains(s.CategoryIDs, category.ID) {
+		return nil, false
+	}
+	return category, true
+}
+
+// Order qatorlari tushadigan printerlar (SSE obunachilarini filtrlash uchun)
+func orderStations(order *Order) []uint {
+	var printers []uint
+	for _, item := range order.Items {
+		if printer, _, ok := itemStation(item); ok && !slices.Contains(printers, printer) {
+			printers = append(printers, printer)
+		}
+	}
+	slices.Sort(printers)
+	return printers
+}
+
+// Bump/recall dan keyingi order statusi: hamma qator tayyor - "ready",
+// aks holda oshxona ishni boshlagan - "preparing"
+func kitchenOrderStatus(order *Order) string {
+	allBumped, anyBumped := true, false
+	for _, item := range order.Items {
+		if _, _, ok := itemStation(item); !ok {
+			continue
+		}
+		if item.KitchenStatus == kitchenBumped {
+			anyBumped = true
+		} else {
+			allBumped = false
+		}
+	}
+	switch {
+	case anyBumped && allBumped:
+		return "ready"
+	case anyBumped || order.Status == "preparing" || order.Status == "ready":
+		return "preparing"
+	}
+	return order.Status
+}
+
+func kdsOrderView(order *Order, station kdsStation, includeBumped bool) (KDSOrder, bool) {
+	view := KDSOrder{
+		ID:           order.ID,
+		OrderID:      order.OrderID,
+		FilialID:     order.FilialID,
+		FilialName:   order.FilialName,
+		Status:       order.Status,
+		Comment:      order.Comment,
+		DeliveryDate: order.DeliveryDate,
+		DeliverySlot: order.DeliverySlot,
+		Created:      order.Created,
+		Items:        []KDSItem{},
+	}
+	for _, item := range order.Items {
+		category, ok := station.matches(item)
+		if !ok {
+			continue
+		}
+		if item.KitchenStatus == kitchenBumped && !includeBumped {
+			continue
+		}
+		view.Items = append(view.Items, KDSItem{
+			ProductID:     item.ProductID,
+			VariantID:     item.VariantID,
+			Name:          item.Name,
+			VariantName:   item.VariantName,
+			CategoryID:    category.ID,
+			Category:      category.Name,
+			Count:         item.Count,
+			Type:          item.Type,
+			Quantity:      formatQuantityWithUnit(item.Count, item.Type),
+			Note:          item.Note,
+			KitchenStatus: item.KitchenStatus,
+			BumpedAt:      item.BumpedAt,
+		})
+	}
+	return view, len(view.Items) > 0
+}
+
+// Stansiya navbati: ochiq orderlarning shu stansiyadagi qatorlari, eskisi oldin.
+// includeBumped - tayyor qatorlar (va "ready" orderlar) ham ko'rsatiladi (recall uchun).
+func GetKDSQueue(station kdsStation, includeBumped bool) KDSQueue {
+	queue := KDSQueue{Printer: station.Printer, Orders: []KDSOrder{}}
+
+	// Qatorlar mahsulot kategoriyasi orqali stansiyaga bog'lanadi: katalog ham o'qiladi
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	ordersMu.Lock()
+	for i := range orders {
+		o := &orders[i]
+		if !slices.Contains(kdsOpenStatuses, o.Status) && !(includeBumped && o.Status == "ready") {
+			continue
+		}
+		if view, ok := kdsOrderView(o, station, includeBumped); ok {
+			queue.Orders = append(queue.Orders, view)
+		}
+	}
+	ordersMu.Unlock()
+
+	slices.SortStableFunc(queue.Orders, func(a, b KDSOrder) int {
+		return cmp.Or(a.Created.Compare(b.Created), cmp.Compare(a.ID, b.ID))
+	})
+	return queue
+}
+
+// Printerlar ro'yxati, ularning kategoriyalari va navbatdagi ochiq qatorlar soni
+func GetKDSStations() []KDSStationInfo {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	stations := []KDSStationInfo{}
+	stationIndex := make(map[uint]int)
+	sorted := slices.Clone(categories)
+	slices.SortStableFunc(sorted, compareCategories)
+	for _, c := range sorted {
+		idx, ok := stationIndex[c.Printer]
+		if !ok {
+			idx = len(stations)
+			stationIndex[c.Printer] = idx
+			stations = append(stations, KDSStationInfo{Printer: c.Printer, Categories: []KDSCategory{}})
+		}
+		stations[idx].Categories = append(stations[idx].Categories, KDSCategory{ID: c.ID, Name: c.Name})
+	}
+
+	ordersMu.Lock()
+	for i := range orders {
+		o := &orders[i]
+		if !slices.Contains(kdsOpenStatuses, o.Status) {
+			continue
+		}
+		counted := make(map[uint]bool)
+		for _, item := range o.Items {
+			printer, _, ok := itemStation(item)
+			if !ok || item.KitchenStatus == kitchenBumped {
+				continue
+			}
+			idx := stationIndex[printer]
+			stations[idx].OpenItems++
+			if !counted[printer] {
+				counted[printer] = true
+				stations[idx].OpenOrders++
+			}
+		}
+	}
+	ordersMu.Unlock()
+
+	slices.SortStableFunc(stations, func(a, b KDSStationInfo) int { return cmp.Compare(a.Printer, b.Printer) })
+	return stations
+}
+
+// Stansiyadagi order qatorlarini bump (bump=true) yoki recall qiladi.
+// lines bo'sh bo'lsa - orderning shu stansiyadagi barcha qatorlari.
+func SetKitchenItemsStatus(orderID uint, station kdsStation, lines []KDSLineRef, actor *User, bump bool) (*KDSOrder, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+
+	order := findOrderByID(orderID)
+	if order == nil {
+		return nil, fmt.Errorf("order topilmadi")
+	}
+	allowed := slices.Contains(kdsOpenStatuses, order.Status) || (!bump && order.Status == "ready")
+	if !allowed {
+		return nil, fmt.Errorf("order \"%s\" holatida, oshxona navbatida emas", order.Status)
+	}
+
+	var selected []int
+	for i, item := range order.Items {
+		if _, ok := station.matches(item); ok {
+			selected = append(selected, i)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("orderda bu stansiya uchun mahsulot yo'q")
+	}
+	if len(lines) > 0 {
+		var picked []int
+		for _, line := range lines {
+			key := lineKey(line.ProductID, line.VariantID)
+			idx := slices.IndexFunc(selected, func(i int) bool {
+				return lineKey(order.Items[i].ProductID, order.Items[i].VariantID) == key
+			})
+			if idx < 0 {
+				return nil, fmt.Errorf("mahsulot ID %d bu stansiyada yo'q", line.ProductID)
+			}
+			if !slices.Contains(picked, selected[idx]) {
+				picked = append(picked, selected[idx])
+			}
+		}
+		selected = picked
+	}
+
+	now := time.Now()
+	changed := false
+	for _, i := range selected {
+		item := &order.Items[i]
+		switch {
+		case bump && item.KitchenStatus != kitchenBumped:
+			item.KitchenStatus = kitchenBumped
+			item.BumpedAt = &now
+			item.BumpedBy = actor.ID
+			changed = true
+		case !bump && item.KitchenStatus == kitchenBumped:
+			item.KitchenStatus = ""
+			item.BumpedAt = nil
+			item.BumpedBy = 0
+			changed = true
+		}
+	}
+
+	if changed {
+		order.Status = kitchenOrderStatus(order)
+		order.Updated = now
+		order.Version++
+		saveOrders()
+		syncOrderStock(order)
+		eventType := "recalled"
+		if bump {
+			eventType = "bumped"
+		}
+		publishKDSEvent(order, eventType)
+	}
+
+	view, _ := kdsOrderView(order, station, true)
+	return &view, nil
+}
+
+// ============= KDS LIVE STREAM =============
+// Ekranlar SSE orqali obuna bo'ladi; order yaratilsa, o'zgarsa yoki bump/recall
+// bo'lsa hodisa yuboriladi va ekran navbatni qayta yuklaydi.
+
+type kdsSubscriber struct {
+	printer uint // 0 - barcha stansiyalar
+	events  chan KDSEvent
+}
+
+var (
+	kdsMu          sync.Mutex
+	kdsSubscribers = make(map[*kdsSubscriber]struct{})
+)
+
+func subscribeKDS(printer uint) *kdsSubscriber {
+	sub := &kdsSubscriber{printer: printer, events: make(chan KDSEvent, 16)}
+	kdsMu.Lock()
+	kdsSubscribers[sub] = struct{}{}
+	kdsMu.Unlock()
+	return sub
+}
+
+func unsubscribeKDS(sub *kdsSubscriber) {
+	kdsMu.Lock()
+	delete(kdsSubscribers, sub)
+	kdsMu.Unlock()
+}
+
+// Sekin ekran boshqalarni to'xtatmasligi uchun navbati to'lgan obunachiga hodisa tashlab yuboriladi
+// (ekran keyingi hodisada navbatni baribir to'liq qayta yuklaydi).
+func publishKDSEvent(order *Order, eventType string) {
+	event := KDSEvent{
+		Type:     eventType,
+		ID:       order.ID,
+		OrderID:  order.OrderID,
+		FilialID: order.FilialID,
+		Status:   order.Status,
+		Printers: orderStations(order),
+		Time:     time.Now(),
+	}
+
+	kdsMu.Lock()
+	defer kdsMu.Unlock()
+	for sub := range kdsSubscribers {
+		if sub.printer != 0 && !slices.Contains(event.Printers, sub.printer) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
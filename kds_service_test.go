@@ -0,0 +1,139 @@
+package main
+
+import (
+	"testing"
+)
+
+// Ikki stansiya: 1-printer (Non), 2-printer (Sut)
+func setupKDSTestData(t *testing.T) *Order {
+	setupOrderTestData(t, "{date}-{seq}")
+	oldCategories := categories
+	t.Cleanup(func() { categories = oldCategories })
+
+	categories = []Category{{ID: 1, Name: "Non", Printer: 1}, {ID: 2, Name: "Sut", Printer: 2}}
+	products = []Product{
+		{ID: 1, Name: "Non", Type: "dona", CategoryID: 1, Filials: []uint{1, 2}},
+		{ID: 2, Name: "Sut", Type: "dona", CategoryID: 2, Filials: []uint{1, 2}},
+	}
+
+	order, err := CreateOrder(1, CreateOrderRequest{
+		Items: []CreateOrderItem{
+			{ProductID: 1, Count: NewDecimal(2)},
+			{ProductID: 2, Count: NewDecimal(1)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+var kdsTestCook = &User{ID: 1, Name: "oshpaz", IsKitchen: true}
+
+func setKitchen(t *testing.T, orderID uint, printer uint, bump bool) *KDSOrder {
+	t.Helper()
+	view, err := SetKitchenItemsStatus(orderID, kdsStation{Printer: printer}, nil, kdsTestCook, bump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return view
+}
+
+func assertOrderStatus(t *testing.T, orderID uint, want string) {
+	t.Helper()
+	if got := GetOrderByID(orderID).Status; got != want {
+		t.Fatalf("order statusi %q, kutilgan %q", got, want)
+	}
+}
+
+func TestKitchenBumpAdvancesOrder(t *testing.T) {
+	order := setupKDSTestData(t)
+	assertOrderStatus(t, order.ID, "pending")
+
+	// Birinchi stansiya bump qildi - oshxona ishni boshlagan
+	view := setKitchen(t, order.ID, 1, true)
+	if len(view.Items) != 1 || view.Items[0].KitchenStatus != kitchenBumped || view.Items[0].BumpedAt == nil {
+		t.Fatalf("bump qilingan qator: %+v", view.Items)
+	}
+	assertOrderStatus(t, order.ID, "preparing")
+
+	// Bump qilingan qator navbatdan chiqadi, boshqa stansiyada order qoladi
+	if queue := GetKDSQueue(kdsStation{Printer: 1}, false); len(queue.Orders) != 0 {
+		t.Fatalf("1-stansiya navbati: %+v", queue.Orders)
+	}
+	if queue := GetKDSQueue(kdsStation{Printer: 2}, false); len(queue.Orders) != 1 {
+		t.Fatalf("2-stansiya navbati: %+v", queue.Orders)
+	}
+	stations := GetKDSStations()
+	if len(stations) != 2 || stations[0].OpenItems != 0 || stations[1].OpenItems != 1 || stations[1].OpenOrders != 1 {
+		t.Fatalf("stansiyalar: %+v", stations)
+	}
+
+	// Barcha stansiyalar bump qildi - order tayyor
+	setKitchen(t, order.ID, 2, true)
+	assertOrderStatus(t, order.ID, "ready")
+
+	// Chek natijasi tayyor orderning statusini qaytarib yozmaydi
+	SetOrderStatus(order.ID, "sent_to_printer", printableStatuses)
+	assertOrderStatus(t, order.ID, "ready")
+
+	// Tayyor order oshxona navbatida emas: qayta bump qilinmaydi
+	if _, err := SetKitchenItemsStatus(order.ID, kdsStation{Printer: 1}, nil, kdsTestCook, true); err == nil {
+		t.Fatal("tayyor order bump qilindi")
+	}
+}
+
+func TestKitchenRecallFromReady(t *testing.T) {
+	order := setupKDSTestData(t)
+	setKitchen(t, order.ID, 1, true)
+	setKitchen(t, order.ID, 2, true)
+	assertOrderStatus(t, order.ID, "ready")
+
+	// Tayyor qatorlar include_bumped bilan ko'rinadi
+	if queue := GetKDSQueue(kdsStation{Printer: 1}, true); len(queue.Orders) != 1 {
+		t.Fatalf("recall uchun navbat: %+v", queue.Orders)
+	}
+
+	// Bitta stansiya recall qildi - order yana tayyorlanmoqda
+	view := setKitchen(t, order.ID, 1, false)
+	if view.Items[0].KitchenStatus != "" || view.Items[0].BumpedAt != nil {
+		t.Fatalf("recall qilingan qator: %+v", view.Items[0])
+	}
+	assertOrderStatus(t, order.ID, "preparing")
+	if queue := GetKDSQueue(kdsStation{Printer: 1}, false); len(queue.Orders) != 1 {
+		t.Fatalf("recall dan keyin navbat: %+v", queue.Orders)
+	}
+
+	// Hammasi recall qilinsa ham "preparing" qoladi (ish boshlangan)
+	setKitchen(t, order.ID, 2, false)
+	assertOrderStatus(t, order.ID, "preparing")
+
+	// Qayta bump - yana tayyor
+	setKitchen(t, order.ID, 1, true)
+	setKitchen(t, order.ID, 2, true)
+	assertOrderStatus(t, order.ID, "ready")
+}
+
+func TestKitchenBumpSelectedLines(t *testing.T) {
+	order := setupKDSTestData(t)
+
+	// Boshqa stansiya qatori rad etiladi
+	_, err := SetKitchenItemsStatus(order.ID, kdsStation{Printer: 1}, []KDSLineRef{{ProductID: 2}}, kdsTestCook, true)
+	if err == nil {
+		t.Fatal("boshqa stansiya qatori bump qilindi")
+	}
+	assertOrderStatus(t, order.ID, "pending")
+
+	// Kategoriya bo'yicha toraytirilgan stansiyada orderning qatori yo'q
+	if _, err := SetKitchenItemsStatus(order.ID, kdsStation{Printer: 1, CategoryIDs: []uint{2}}, nil, kdsTestCook, true); err == nil {
+		t.Fatal("bo'sh stansiya uchun bump qabul qilindi")
+	}
+
+	setKitchen(t, order.ID, 1, true)
+	// Bump takrorlansa order o'zgarmaydi
+	version := GetOrderByID(order.ID).Version
+	setKitchen(t, order.ID, 1, true)
+	if got := GetOrderByID(order.ID).Version; got != version {
+		t.Fatalf("o'zgarishsiz bump versiyani oshirdi: %d -> %d", version, got)
+	}
+}
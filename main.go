@@ -33,7 +33,11 @@ func main() {
 
 	// Telegram backup service ni ishga tushirish
 	startBackupService()
-	log.Println("✅ Backup service ishga tushdi (har kuni soat 00:00)")
+	log.Printf("✅ Backup service ishga tushdi (har kuni soat %02d:00, %s)", businessDayCutoffHour, businessLocation)
+
+	// Rejalashtirilgan orderlar scheduleri
+	startSchedulerService()
+	log.Println("✅ Scheduler ishga tushdi (rejalashtirilgan orderlar)")
 
 	r := mux.NewRouter()
 
@@ -53,12 +57,38 @@ func main() {
 
 	// ================= USER ROUTES =================
 	api.HandleFunc("/products1", authenticateJWT(getProductsHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/units", authenticateJWT(getUnitsHandler)).Methods("GET", "OPTIONS")
 	// api.HandleFunc("/products", authenticateJWT(getProductsHandler)).Methods("GET", "OPTIONS")
 	api.HandleFunc("/orders", authenticateJWT(createOrderHandler)).Methods("POST", "OPTIONS")
 	api.HandleFunc("/orders", authenticateJWT(getOrdersHandler)).Methods("GET", "OPTIONS")
 	api.HandleFunc("/orders/{id:[0-9]+}", authenticateJWT(getOrderHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/orders/{id:[0-9]+}/amend", authenticateJWT(amendOrderHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/orders/{id:[0-9]+}/cancel", authenticateJWT(cancelOrderHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/orders/{id:[0-9]+}/reorder", authenticateJWT(reorderHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/orders/{id:[0-9]+}/fulfilment", authenticateJWT(getOrderFulfilmentHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/orders/{id:[0-9]+}/receipt", authenticateJWT(confirmReceiptHandler)).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/order-templates", authenticateJWT(getOrderTemplatesHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/order-templates", authenticateJWT(addOrderTemplateHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/order-templates/{id:[0-9]+}", authenticateJWT(updateOrderTemplateHandler)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/order-templates/{id:[0-9]+}", authenticateJWT(deleteOrderTemplateHandler)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/order-templates/{id:[0-9]+}/submit", authenticateJWT(submitOrderTemplateHandler)).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/scheduled-orders", authenticateJWT(getScheduledOrdersHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/scheduled-orders", authenticateJWT(addScheduledOrderHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/scheduled-orders/{id:[0-9]+}", authenticateJWT(updateScheduledOrderHandler)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/scheduled-orders/{id:[0-9]+}", authenticateJWT(deleteScheduledOrderHandler)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/scheduled-orders/{id:[0-9]+}/pause", authenticateJWT(pauseScheduledOrderHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/scheduled-orders/{id:[0-9]+}/resume", authenticateJWT(resumeScheduledOrderHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/scheduled-orders/{id:[0-9]+}/skip", authenticateJWT(skipScheduledOrderHandler)).Methods("POST", "OPTIONS")
+
+	api.HandleFunc("/delivery-slots/available", authenticateJWT(getAvailableDeliverySlotsHandler)).Methods("GET", "OPTIONS")
 
 	api.HandleFunc("/filials", authenticateJWT(getFilialsHandler)).Methods("GET", "OPTIONS")
+
+	// ================= DRIVER ROUTES =================
+	api.HandleFunc("/driver/manifests", requireDriver(getDriverManifestsHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/driver/routes/{id:[0-9]+}/stops/{filial_id:[0-9]+}/delivered", requireDriver(markStopDeliveredHandler)).Methods("POST", "OPTIONS")
 	api.HandleFunc("/categories", authenticateJWT(getCategoriesHandler)).Methods("GET", "OPTIONS")
 
 	// ================= ADMIN ROUTES =================
@@ -71,6 +101,7 @@ func main() {
 	api.HandleFunc("/categories/{id:[0-9]+}", requireAdmin(getCategoryHandler)).Methods("GET", "OPTIONS")
 	api.HandleFunc("/categories/{id:[0-9]+}", requireAdmin(updateCategoryHandler)).Methods("PUT", "OPTIONS")
 	api.HandleFunc("/categories/{id:[0-9]+}", requireAdmin(deleteCategoryHandler)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/categories/reorder", requireAdmin(reorderCategoriesHandler)).Methods("PUT", "OPTIONS")
 
 	// Products
 	api.HandleFunc("/products/all", requireAdmin(getAllProductsHandler)).Methods("GET", "OPTIONS")
@@ -78,6 +109,7 @@ func main() {
 	api.HandleFunc("/products/{id:[0-9]+}", requireAdmin(getProductHandler)).Methods("GET", "OPTIONS")
 	api.HandleFunc("/products/{id:[0-9]+}", requireAdmin(updateProductHandler)).Methods("PUT", "OPTIONS")
 	api.HandleFunc("/products/{id:[0-9]+}", requireAdmin(deleteProductHandler)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/products/reorder", requireAdmin(moveProductsHandler)).Methods("PUT", "OPTIONS")
 
 	// Users
 	api.HandleFunc("/users", requireAdmin(getUsersHandler)).Methods("GET", "OPTIONS")
@@ -90,6 +122,56 @@ func main() {
 	api.HandleFunc("/orderslist", requireAdmin(getOrdersListHandler)).Methods("GET", "OPTIONS")
 	api.HandleFunc("/orders/{id:[0-9]+}", requireAdmin(updateOrderHandler)).Methods("PUT", "OPTIONS")
 	api.HandleFunc("/orders/{id:[0-9]+}", requireAdmin(deleteOrderHandler)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/orders/{id:[0-9]+}/shipments", requireAdmin(recordShipmentHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/receipts/discrepancies", requireAdmin(getReceiptDiscrepanciesHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/reports/category-items", requireAdmin(getSubcategoryReportHandler)).Methods("GET", "OPTIONS")
+
+	// Production plan
+	api.HandleFunc("/production-plan", requireAdmin(getProductionPlanHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/production-plan/print", requireAdmin(printProductionPlanHandler)).Methods("POST", "OPTIONS")
+
+	// Ordering windows
+	api.HandleFunc("/ordering-windows", requireAdmin(getOrderingWindowsHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/ordering-windows", requireAdmin(addOrderingWindowHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/ordering-windows/{id:[0-9]+}", requireAdmin(updateOrderingWindowHandler)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/ordering-windows/{id:[0-9]+}", requireAdmin(deleteOrderingWindowHandler)).Methods("DELETE", "OPTIONS")
+
+	// Delivery slots
+	api.HandleFunc("/delivery-slots", requireAdmin(getDeliverySlotsHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/delivery-slots", requireAdmin(addDeliverySlotHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/delivery-slots/{id:[0-9]+}", requireAdmin(updateDeliverySlotHandler)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/delivery-slots/{id:[0-9]+}", requireAdmin(deleteDeliverySlotHandler)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/delivery-slots/orders", requireAdmin(getDeliverySlotOrdersHandler)).Methods("GET", "OPTIONS")
+
+	// Delivery routes
+	api.HandleFunc("/delivery-routes", requireAdmin(getDeliveryRoutesHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/delivery-routes", requireAdmin(addDeliveryRouteHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/delivery-routes/{id:[0-9]+}", requireAdmin(updateDeliveryRouteHandler)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/delivery-routes/{id:[0-9]+}", requireAdmin(deleteDeliveryRouteHandler)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/delivery-routes/{id:[0-9]+}/assign", requireAdmin(assignRouteOrdersHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/delivery-routes/{id:[0-9]+}/manifest", requireAdmin(getRouteManifestHandler)).Methods("GET", "OPTIONS")
+
+	// Kitchen display (KDS)
+	api.HandleFunc("/kds/stations", requireKitchen(getKDSStationsHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/kds/stations/{printer:[0-9]+}/queue", requireKitchen(getKDSQueueHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/kds/stations/{printer:[0-9]+}/orders/{id:[0-9]+}/bump", requireKitchen(bumpKDSItemsHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/kds/stations/{printer:[0-9]+}/orders/{id:[0-9]+}/recall", requireKitchen(recallKDSItemsHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/kds/stream-token", requireKitchen(kdsStreamTokenHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/kds/stream", requireKitchenStream(kdsStreamHandler)).Methods("GET", "OPTIONS")
+
+	// Stock
+	api.HandleFunc("/stock", requireAdmin(getStockHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/stock", requireAdmin(deleteStockHandler)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/stock/movements", requireAdmin(getStockMovementsHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/stock/restock", requireAdmin(restockHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/stock/adjust", requireAdmin(adjustStockHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/stock/threshold", requireAdmin(setStockThresholdHandler)).Methods("PUT", "OPTIONS")
+
+	// Stop-list
+	api.HandleFunc("/stop-list", requireAdmin(getStopListHandler)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/stop-list", requireAdmin(addStopListHandler)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/stop-list", requireAdmin(clearStopListHandler)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/stop-list/{id:[0-9]+}", requireAdmin(deleteStopListEntryHandler)).Methods("DELETE", "OPTIONS")
 
 	// Category Items
 	api.HandleFunc("/category-items", requireAdmin(getCategoryItemsHandler)).Methods("GET", "OPTIONS")
@@ -99,6 +181,7 @@ func main() {
 	api.HandleFunc("/category-items", requireAdmin(addCategoryItemHandler)).Methods("POST", "OPTIONS")
 	api.HandleFunc("/category-items/{id:[0-9]+}", requireAdmin(updateCategoryItemHandler)).Methods("PUT", "OPTIONS")
 	api.HandleFunc("/category-items/{id:[0-9]+}", requireAdmin(deleteCategoryItemHandler)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/category-items/reorder", requireAdmin(reorderCategoryItemsHandler)).Methods("PUT", "OPTIONS")
 
 	// ================= IMAGE UPLOAD =================
 	api.HandleFunc("/upload", authenticateJWT(uploadImageHandler)).Methods("POST", "OPTIONS")
@@ -114,13 +197,13 @@ func main() {
 // TELEGRAM BACKUP SERVICE
 //////////////////////////////////////////////////////
 
-// Backup service - har kuni soat 00:00 da ishga tushadi
+// Backup service - har kuni biznes kun tugaganda (businessLocation, cutoff soat) ishga tushadi
 func startBackupService() {
 	go func() {
 		for {
-			now := time.Now()
-			// Ertangi kunning 00:00 ini hisoblaymiz
-			next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+			now := businessNow()
+			// Keyingi biznes kun boshlanishini hisoblaymiz
+			next := businessDayStart(businessDay(now).AddDate(0, 0, 1))
 			duration := next.Sub(now)
 
 			log.Printf("⏰ Keyingi backup vaqti: %s (%.0f soatdan keyin)", next.Format("02.01.2006 15:04"), duration.Hours())
@@ -203,7 +286,7 @@ func createZipArchive(folders []string, zipPath string) error {
 // Telegram ga yuborish
 func sendBackupToTelegram() error {
 	// Vaqt belgisi
-	timestamp := time.Now().Format("2006-01-02_15-04")
+	timestamp := businessNow().Format("2006-01-02_15-04")
 	zipFileName := fmt.Sprintf("backup_%s.zip", timestamp)
 
 	// Zip fayl yaratish
@@ -238,7 +321,7 @@ func sendBackupToTelegram() error {
 	// chat_id parametri
 	_ = writer.WriteField("chat_id", CHAT_ID)
 	_ = writer.WriteField("caption", fmt.Sprintf("📅 Kunlik backup\n🕐 Vaqt: %s\n📦 Hajm: %.2f MB",
-		time.Now().Format("02.01.2006 15:04"), sizeMB))
+		businessNow().Format("02.01.2006 15:04"), sizeMB))
 
 	// Fayl qo'shish
 	part, err := writer.CreateFormFile("document", zipFileName)
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -41,6 +44,34 @@ func generateToken(userID uint, phone string, isAdmin bool) (string, error) {
 	return token.SignedString(jwtSecretKey)
 }
 
+// Faqat KDS SSE ulanishini ochish uchun token: EventSource Authorization header
+// yubora olmaydi, token esa URL da (va loglarda) qoladi - shuning uchun muddati qisqa
+const (
+	kdsStreamTokenPurpose = "kds-stream"
+	kdsStreamTokenTTL     = time.Minute
+)
+
+func generateKDSStreamToken(user *User) (*KDSStreamToken, error) {
+	now := time.Now()
+	expires := now.Add(kdsStreamTokenTTL)
+	claims := &Claims{
+		UserID:  user.ID,
+		Phone:   user.Phone,
+		IsAdmin: user.IsAdmin,
+		Purpose: kdsStreamTokenPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expires),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecretKey)
+	if err != nil {
+		return nil, err
+	}
+	return &KDSStreamToken{Token: token, ExpiresAt: expires}, nil
+}
+
 func validateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -65,7 +96,8 @@ func corsMiddleware(next http.Handler) http.Handler {
 		}
 
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, Origin")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, Origin, If-Match, If-None-Match, Idempotency-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Max-Age", "3600")
 
@@ -103,8 +135,9 @@ func authenticateJWT(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		// Maxsus maqsadli (masalan, KDS stream) token oddiy API uchun yaroqsiz
 		claims, err := validateToken(tokenString)
-		if err != nil {
+		if err != nil || claims.Purpose != "" {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusUnauthorized)
 			json.NewEncoder(w).Encode(Response{
@@ -114,14 +147,17 @@ func authenticateJWT(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		r.Header.Set("User-ID", fmt.Sprintf("%d", claims.UserID))
-		r.Header.Set("User-Phone", claims.Phone)
-		r.Header.Set("User-IsAdmin", fmt.Sprintf("%t", claims.IsAdmin))
-
+		setAuthHeaders(r, claims)
 		next(w, r)
 	}
 }
 
+func setAuthHeaders(r *http.Request, claims *Claims) {
+	r.Header.Set("User-ID", fmt.Sprintf("%d", claims.UserID))
+	r.Header.Set("User-Phone", claims.Phone)
+	r.Header.Set("User-IsAdmin", fmt.Sprintf("%t", claims.IsAdmin))
+}
+
 // Admin Authorization Middleware
 func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
 	return authenticateJWT(func(w http.ResponseWriter, r *http.Request) {
@@ -138,3 +174,164 @@ func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r)
 	})
 }
+
+// Haydovchi yoki admin. Rol tokenda emas, user yozuvidan olinadi - admin rolni
+// o'zgartirsa qayta login talab qilinmaydi.
+func requireDriver(next http.HandlerFunc) http.HandlerFunc {
+	return authenticateJWT(func(w http.ResponseWriter, r *http.Request) {
+		var userID uint
+		fmt.Sscanf(r.Header.Get("User-ID"), "%d", &userID)
+		user := findUserByID(userID)
+		if user == nil || (!user.IsDriver && !user.IsAdmin) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: "Haydovchi huquqlari kerak",
+			})
+			return
+		}
+		next(w, r)
+	})
+}
+
+// Oshxona xodimi yoki admin (requireDriver kabi rol user yozuvidan olinadi)
+func requireKitchen(next http.HandlerFunc) http.HandlerFunc {
+	return authenticateJWT(kitchenOnly(next))
+}
+
+func kitchenOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var userID uint
+		fmt.Sscanf(r.Header.Get("User-ID"), "%d", &userID)
+		user := findUserByID(userID)
+		if user == nil || (!user.IsKitchen && !user.IsAdmin) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: "Oshxona huquqlari kerak",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// KDS SSE: Authorization header yoki /kds/stream-token dan olingan ?token=.
+// Token faqat ulanish ochilayotganda tekshiriladi; qayta ulanishda ekran yangi token oladi.
+func requireKitchenStream(next http.HandlerFunc) http.HandlerFunc {
+	kitchen := kitchenOnly(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString := r.URL.Query().Get("token")
+		if tokenString == "" {
+			authenticateJWT(kitchen)(w, r)
+			return
+		}
+
+		claims, err := validateToken(tokenString)
+		if err != nil || claims.Purpose != kdsStreamTokenPurpose {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: "Noto'g'ri token",
+			})
+			return
+		}
+
+		setAuthHeaders(r, claims)
+		kitchen(w, r)
+	}
+}
+
+// ETag utilities
+// Har bir yozuv uchun ETag: "<tur>-<id>-v<version>"
+func entityETag(kind string, id uint, version uint) string {
+	return fmt.Sprintf(`"%s-%d-v%d"`, kind, id, version)
+}
+
+// Javob tanasidan (masalan, katalog) ETag hisoblash
+func contentETag(data []byte) string {
+	sum := sha1.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// If-Match / If-None-Match headerlaridagi qiymat ETag ga mos keladimi
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// If-Match mos kelmadi. Current - yozuvning hozirgi holati, client uni qayta yuklamasdan birlashtira olishi uchun.
+type VersionConflictError struct {
+	ETag    string
+	Current interface{}
+}
+
+func (e *VersionConflictError) Error() string {
+	return "Ma'lumot boshqa foydalanuvchi tomonidan o'zgartirilgan, qayta yuklang"
+}
+
+// If-Match tekshiruvi data qatlamida, yozuv bilan bir xil lock ostida chaqiriladi -
+// aks holda ikki admin bir ETag bilan tekshiruvdan o'tib, bir-birining o'zgarishini yozib yuboradi.
+// ifMatch bo'sh bo'lsa shartsiz yoziladi.
+func checkVersion(ifMatch, etag string, current interface{}) error {
+	if ifMatch == "" || etagMatches(ifMatch, etag) {
+		return nil
+	}
+	return &VersionConflictError{ETag: etag, Current: current}
+}
+
+// Xato versiya to'qnashuvi bo'lsa 412 yozadi va true qaytaradi
+func writeVersionConflict(w http.ResponseWriter, err error) bool {
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", conflict.ETag)
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(Response{
+		Success: false,
+		Message: conflict.Error(),
+		Data:    conflict.Current,
+	})
+	return true
+}
+
+// Conditional GET: javobni ETag bilan yuboradi, If-None-Match mos kelsa 304 qaytaradi
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "JSON yaratishda xatolik",
+		})
+		return
+	}
+
+	etag := contentETag(data)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -11,6 +11,7 @@ type Claims struct {
 	UserID  uint   `json:"user_id"`
 	Phone   string `json:"phone"`
 	IsAdmin bool   `json:"is_admin"`
+	Purpose string `json:"purpose,omitempty"` // "" - oddiy login token, aks holda faqat shu maqsad uchun
 	jwt.RegisteredClaims
 }
 
@@ -19,6 +20,7 @@ type Filial struct {
 	ID       uint   `json:"id"`
 	Name     string `json:"name"`
 	Location string `json:"location"`
+	Version  uint   `json:"version"`
 }
 
 type Category struct {
@@ -26,6 +28,8 @@ type Category struct {
 	Name     string `json:"name"`
 	Printer  uint   `json:"printer"`
 	ImageUrl string `json:"image_url"`
+	Position int    `json:"position"` // katalogdagi tartib (kichigi oldin)
+	Version  uint   `json:"version"`
 }
 
 type User struct {
@@ -34,40 +38,121 @@ type User struct {
 	Phone      string `json:"phone"`
 	Password   string `json:"password"`
 	IsAdmin    bool   `json:"is_admin"`
+	IsDriver   bool   `json:"is_driver,omitempty"`  // haydovchi: marshrut yuk xatini ko'radi va yetkazishni belgilaydi
+	IsKitchen  bool   `json:"is_kitchen,omitempty"` // oshxona: KDS ekranini ko'radi va qatorlarni bump/recall qiladi
 	FilialID   uint   `json:"filial_id"`
 	CategoryID []uint `json:"category_list"`
+	Version    uint   `json:"version"`
 }
 
 type Product struct {
-	ID          uint   `json:"id"`
-	Name        string `json:"name"`
-	CategoryID  uint   `json:"category_id"`
-	ImageUrl    string `json:"image_url"`
-	Type        string `json:"type"`
-	Ingredients string `json:"ingredients"`
-	Filials     []uint `json:"filials"`
+	ID             uint    `json:"id"`
+	Name           string  `json:"name"`
+	CategoryID     uint    `json:"category_id"`
+	CategoryItemID uint    `json:"category_item_id,omitempty"` // subkategoriya (CategoryItem), 0 - yo'q
+	Position       int     `json:"position"`                   // kategoriya/subkategoriya ichidagi tartib
+	ImageUrl       string  `json:"image_url"`
+	Type           string  `json:"type"`
+	Ingredients    string  `json:"ingredients"`
+	Filials        []uint  `json:"filials"`
+	MinQty         Decimal `json:"min_qty,omitempty"` // miqdor qoidalari, 0 - cheklov yo'q
+	MaxQty         Decimal `json:"max_qty,omitempty"`
+	Step           Decimal `json:"step,omitempty"`
+	Price          Decimal `json:"price,omitempty"`
+	// Variantlar (o'lcham, nachinka); bo'sh bo'lmasa order variant bo'yicha beriladi
+	Variants []ProductVariant `json:"variants,omitempty"`
+	// Keyingi variant ID si; o'chirilgan variant ID lari qayta berilmaydi
+	NextVariantID uint `json:"next_variant_id,omitempty"`
+	Version       uint `json:"version"`
+}
+
+// Mahsulot varianti. Type (birlik) bo'sh bo'lsa mahsulot birligi ishlatiladi.
+type ProductVariant struct {
+	ID     uint    `json:"id"`
+	Name   string  `json:"name"`
+	Type   string  `json:"type,omitempty"`
+	Price  Decimal `json:"price"`
+	MinQty Decimal `json:"min_qty,omitempty"`
+	MaxQty Decimal `json:"max_qty,omitempty"`
+	Step   Decimal `json:"step,omitempty"`
 }
 
 type Order struct {
-	ID         uint        `json:"id"`
-	OrderID    string      `json:"order_id"`
-	UserID     uint        `json:"user_id"`
-	Username   string      `json:"username"`
-	FilialID   uint        `json:"filial_id"`
-	FilialName string      `json:"filial_name"`
-	Items      []OrderItem `json:"items"`
-	Total      float64     `json:"total"`
-	Status     string      `json:"status"`
-	Created    time.Time   `json:"created"`
-	Updated    time.Time   `json:"updated"`
+	ID          uint          `json:"id"`
+	OrderID     string        `json:"order_id"`
+	BusinessDay string        `json:"business_day,omitempty"`
+	Sequence    uint          `json:"sequence,omitempty"`
+	UserID      uint          `json:"user_id"`
+	Username    string        `json:"username"`
+	FilialID    uint          `json:"filial_id"`
+	FilialName  string        `json:"filial_name"`
+	Items       []OrderItem   `json:"items"`
+	Total       Decimal       `json:"total"`
+	Status      string        `json:"status"`
+	Created     time.Time     `json:"created"`
+	Updated     time.Time     `json:"updated"`
+	Version     uint          `json:"version"`
+	Changes     []OrderChange `json:"changes,omitempty"`
+	// Klient yuborgan Idempotency-Key (qayta yuborishda takroriy order yaratilmasligi uchun)
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// Filialning butun order uchun izohi (oshxonaga ko'rsatma)
+	Comment string `json:"comment,omitempty"`
+	// Yetkazib berish sanasi (YYYY-MM-DD) va sloti; DeliverySlot - slot nomi order berilgan paytdagi holatda
+	DeliveryDate   string `json:"delivery_date,omitempty"`
+	DeliverySlotID uint   `json:"delivery_slot_id,omitempty"`
+	DeliverySlot   string `json:"delivery_slot,omitempty"`
+	// Yetkazib berish marshruti va haydovchi (biriktirilgandan keyin)
+	RouteID     uint       `json:"route_id,omitempty"`
+	DriverID    uint       `json:"driver_id,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	DeliveredBy uint       `json:"delivered_by,omitempty"`
+	// Qismlab jo'natishlar tarixi
+	Shipments []OrderShipment `json:"shipments,omitempty"`
+	// Filial tomonidan qabul qilish tasdig'i
+	Receipt *OrderReceipt `json:"receipt,omitempty"`
+}
+
+// Filial tomonidan qilingan o'zgarish (tahrirlash yoki bekor qilish) tarixi
+type OrderChange struct {
+	Type     string            `json:"type"` // "changed" yoki "cancelled"
+	UserID   uint              `json:"user_id"`
+	Username string            `json:"username"`
+	Reason   string            `json:"reason,omitempty"`
+	Items    []OrderItemChange `json:"items"`
+	Created  time.Time         `json:"created"`
+}
+
+type OrderItemChange struct {
+	ProductID   uint    `json:"product_id"`
+	VariantID   uint    `json:"variant_id,omitempty"`
+	Name        string  `json:"name"`
+	VariantName string  `json:"variant_name,omitempty"`
+	Type        string  `json:"type"`
+	Note        string  `json:"note,omitempty"`
+	OldCount    Decimal `json:"old_count"`
+	NewCount    Decimal `json:"new_count"`
 }
 
 type OrderItem struct {
-	ProductID uint    `json:"product_id"`
-	Name      string  `json:"name"`
-	Count     float32 `json:"count"`
-	Type      string  `json:"type"`
-	Subtotal  float64 `json:"subtotal"`
+	ProductID   uint    `json:"product_id"`
+	VariantID   uint    `json:"variant_id,omitempty"`
+	Name        string  `json:"name"`
+	VariantName string  `json:"variant_name,omitempty"`
+	Count       Decimal `json:"count"`
+	Type        string  `json:"type"`
+	Price       Decimal `json:"price"`
+	Subtotal    Decimal `json:"subtotal"`
+	Note        string  `json:"note,omitempty"` // qator bo'yicha maxsus ko'rsatma
+	// Oshxona ekrani (KDS) holati: "" - navbatda, "bumped" - stansiya tayyorladi
+	KitchenStatus string     `json:"kitchen_status,omitempty"`
+	BumpedAt      *time.Time `json:"bumped_at,omitempty"`
+	BumpedBy      uint       `json:"bumped_by,omitempty"`
+	// Jo'natish: jo'natilgan miqdor, kamomad (sababi bilan) va qator holati
+	// ("" - jo'natilmagan, "partial", "fulfilled", "short")
+	Fulfilled        Decimal `json:"fulfilled,omitempty"`
+	Shortage         Decimal `json:"shortage,omitempty"`
+	ShortReason      string  `json:"short_reason,omitempty"`
+	FulfilmentStatus string  `json:"fulfilment_status,omitempty"`
 }
 
 // Request structs
@@ -107,23 +192,37 @@ type UpdateCategoryRequest struct {
 }
 
 type AddProductRequest struct {
-	ID          uint   `json:"id"`
-	Name        string `json:"name"`
-	CategoryID  uint   `json:"category_id"`
-	ImageUrl    string `json:"image_url"`
-	Type        string `json:"type"`
-	Ingredients string `json:"ingredients"`
-	Filials     []uint `json:"filials"`
+	ID             uint    `json:"id"`
+	Name           string  `json:"name"`
+	CategoryID     uint    `json:"category_id"`
+	CategoryItemID uint    `json:"category_item_id"`
+	ImageUrl       string  `json:"image_url"`
+	Type           string  `json:"type"`
+	Ingredients    string  `json:"ingredients"`
+	Filials        []uint  `json:"filials"`
+	MinQty         Decimal `json:"min_qty"`
+	MaxQty         Decimal `json:"max_qty"`
+	Step           Decimal `json:"step"`
+	Price          Decimal `json:"price"`
+	// ID si 0 bo'lgan variantlar yangi, qolganlari mavjud variantni yangilaydi
+	Variants []ProductVariant `json:"variants"`
 }
 
 type UpdateProductRequest struct {
-	ID          uint   `json:"id"`
-	Name        string `json:"name"`
-	Type        string `json:"type"`
-	CategoryID  uint   `json:"category_id"`
-	ImageUrl    string `json:"image_url"`
-	Ingredients string `json:"ingredients"`
-	Filials     []uint `json:"filials"`
+	ID             uint    `json:"id"`
+	Name           string  `json:"name"`
+	Type           string  `json:"type"`
+	CategoryID     uint    `json:"category_id"`
+	CategoryItemID uint    `json:"category_item_id"`
+	ImageUrl       string  `json:"image_url"`
+	Ingredients    string  `json:"ingredients"`
+	Filials        []uint  `json:"filials"`
+	MinQty         Decimal `json:"min_qty"`
+	MaxQty         Decimal `json:"max_qty"`
+	Step           Decimal `json:"step"`
+	Price          Decimal `json:"price"`
+	// ID si 0 bo'lgan variantlar yangi, qolganlari mavjud variantni yangilaydi
+	Variants []ProductVariant `json:"variants"`
 }
 
 type AssignFilialRequest struct {
@@ -134,18 +233,66 @@ type UpdateUserRequest struct {
 	Name       *string `json:"name"`
 	Phone      *string `json:"phone"`
 	IsAdmin    *bool   `json:"is_admin"`
+	IsDriver   *bool   `json:"is_driver"`
+	IsKitchen  *bool   `json:"is_kitchen"`
 	FilialID   *uint   `json:"filial_id"`
 	Password   *string `json:"password"`
 	CategoryID *[]uint `json:"category_list"`
 }
 
 type CreateOrderRequest struct {
-	Items []CreateOrderItem `json:"items"`
+	Items          []CreateOrderItem `json:"items"`
+	Comment        string            `json:"comment"`
+	DeliveryDate   string            `json:"delivery_date"` // YYYY-MM-DD
+	DeliverySlotID uint              `json:"delivery_slot_id"`
+	IdempotencyKey string            `json:"-"` // Idempotency-Key headeridan
 }
 
 type CreateOrderItem struct {
 	ProductID uint    `json:"product_id"`
-	Count     float32 `json:"count"`
+	VariantID uint    `json:"variant_id,omitempty"` // variantli mahsulotlar uchun majburiy
+	Count     Decimal `json:"count"`
+	Note      string  `json:"note,omitempty"`
+}
+
+// Order itemidagi xato; Index - so'rovdagi item tartib raqami (0 dan)
+type OrderItemError struct {
+	Index     int    `json:"index"`
+	ProductID uint   `json:"product_id"`
+	Message   string `json:"message"`
+}
+
+// Order filter (GET /api/orderslist). Bo'sh slice - filter yo'q.
+// From inclusive, To exclusive; nol qiymat - chegara yo'q.
+type OrderFilter struct {
+	FilialIDs       []uint
+	UserIDs         []uint
+	ProductIDs      []uint
+	CategoryIDs     []uint
+	CategoryItemIDs []uint // subkategoriyalar
+	DeliveryDates   []string
+	DeliverySlotIDs []uint
+	Printers        []uint
+	Statuses        []string
+	From            time.Time
+	To              time.Time
+}
+
+// Order tahrirlash: count > 0 - qo'shish yoki sonini o'zgartirish, count = 0 - olib tashlash
+type AmendOrderRequest struct {
+	Items []AmendOrderItem `json:"items"`
+}
+
+// Izoh: berilmasa (null) avvalgisi saqlanadi, "" - izoh o'chiriladi
+type AmendOrderItem struct {
+	ProductID uint    `json:"product_id"`
+	VariantID uint    `json:"variant_id,omitempty"`
+	Count     Decimal `json:"count"`
+	Note      *string `json:"note,omitempty"`
+}
+
+type CancelOrderRequest struct {
+	Reason string `json:"reason"`
 }
 
 type UpdateOrderRequest struct {
@@ -154,16 +301,24 @@ type UpdateOrderRequest struct {
 
 type PrinterRequest struct {
 	Printer  uint          `json:"printer"`
+	Title    string        `json:"title,omitempty"` // "CHANGED" / "CANCELLED", oddiy chekda bo'sh
 	Category string        `json:"category"`
 	Username string        `json:"username"`
 	OrderID  string        `json:"order_id"`
 	Filial   string        `json:"filial"`
 	Items    []PrinterItem `json:"items"`
+	Comment  string        `json:"comment,omitempty"`  // order izohi
+	Delivery string        `json:"delivery,omitempty"` // yetkazib berish sanasi va sloti
 }
 type PrinterItem struct {
-	Product string  `json:"product"`
-	Count   float32 `json:"count"`
-	Type    string  `json:"type"`
+	Product     string   `json:"product"`
+	Variant     string   `json:"variant,omitempty"`
+	Count       Decimal  `json:"count"`
+	Type        string   `json:"type"`
+	Quantity    string   `json:"quantity"`            // birlik bo'yicha formatlangan miqdor, masalan "1.5 kg"
+	OldCount    *Decimal `json:"old_count,omitempty"` // faqat o'zgarish chekida
+	OldQuantity string   `json:"old_quantity,omitempty"`
+	Note        string   `json:"note,omitempty"`
 }
 
 // Response structs
@@ -179,35 +334,698 @@ type LoginResponse struct {
 }
 
 type UserProfile struct {
-	ID      uint   `json:"id"`
-	Name    string `json:"name"`
-	Phone   string `json:"phone"`
-	IsAdmin bool   `json:"is_admin"`
-	Filial  Filial `json:"filial,omitempty"`
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	Phone     string `json:"phone"`
+	IsAdmin   bool   `json:"is_admin"`
+	IsDriver  bool   `json:"is_driver"`
+	IsKitchen bool   `json:"is_kitchen"`
+	Filial    Filial `json:"filial,omitempty"`
 }
 
+// Katalog: kategoriyalar tartib bo'yicha, har birida subkategoriyasiz mahsulotlar
+// va subkategoriyalar (o'z mahsulotlari bilan)
 type GroupedProductsResponse struct {
-	Success bool                       `json:"success"`
-	Message string                     `json:"message"`
-	Data    map[string][]ProductSimple `json:"data"`
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Data    []CatalogCategory `json:"data"`
+}
+
+type CatalogCategory struct {
+	ID            uint                   `json:"id"`
+	Name          string                 `json:"name"`
+	ImageUrl      string                 `json:"image_url"`
+	Position      int                    `json:"position"`
+	Ordering      CategoryOrderingStatus `json:"ordering"`
+	Products      []ProductSimple        `json:"products"`
+	Subcategories []CatalogSubcategory   `json:"subcategories"`
+}
+
+type CatalogSubcategory struct {
+	ID       uint            `json:"id"`
+	Name     string          `json:"name"`
+	Position int             `json:"position"`
+	Products []ProductSimple `json:"products"`
 }
 
 type ProductSimple struct {
-	ID          uint   `json:"id"`
-	Ingredients string `json:"ingredients"`
-	Type        string `json:"type"`
-	Name        string `json:"name"`
-	ImageUrl    string `json:"image_url"`
+	ID               uint            `json:"id"`
+	Ingredients      string          `json:"ingredients"`
+	Type             string          `json:"type"`
+	Name             string          `json:"name"`
+	ImageUrl         string          `json:"image_url"`
+	CategoryItemID   uint            `json:"category_item_id,omitempty"`
+	CategoryItemName string          `json:"category_item_name,omitempty"`
+	Position         int             `json:"position"`
+	Unit             string          `json:"unit,omitempty"` // birlik kodi (kg, pcs, ...), noma'lum bo'lsa bo'sh
+	Decimals         int             `json:"decimals"`
+	MinQty           Decimal         `json:"min_qty,omitempty"`
+	MaxQty           Decimal         `json:"max_qty,omitempty"`
+	Step             Decimal         `json:"step,omitempty"`
+	Price            Decimal         `json:"price,omitempty"`
+	Variants         []VariantSimple `json:"variants,omitempty"`
+	Available        bool            `json:"available"`       // false - omborda qolmagan
+	Stock            *Decimal        `json:"stock,omitempty"` // faqat qoldig'i kuzatiladigan mahsulotlar uchun
+	// Stop-listda bo'lsa - qachongacha mavjud emas
+	UnavailableUntil *time.Time `json:"unavailable_until,omitempty"`
 }
 
 type ProductDetails struct {
-	ID           uint     `json:"id"`
-	Name         string   `json:"name"`
-	Ingredients  string   `json:"ingredients"`
-	CategoryID   uint     `json:"category_id"`
-	Type         string   `json:"type"`
-	CategoryName string   `json:"category_name"`
-	ImageUrl     string   `json:"image_url"`
-	Filials      []uint   `json:"filials"`
-	FilialNames  []string `json:"filial_names"`
+	ID               uint             `json:"id"`
+	Name             string           `json:"name"`
+	Ingredients      string           `json:"ingredients"`
+	CategoryID       uint             `json:"category_id"`
+	Type             string           `json:"type"`
+	CategoryName     string           `json:"category_name"`
+	ImageUrl         string           `json:"image_url"`
+	Filials          []uint           `json:"filials"`
+	FilialNames      []string         `json:"filial_names"`
+	CategoryItemID   uint             `json:"category_item_id,omitempty"`
+	CategoryItemName string           `json:"category_item_name,omitempty"`
+	Unit             string           `json:"unit,omitempty"`
+	Decimals         int              `json:"decimals"`
+	MinQty           Decimal          `json:"min_qty,omitempty"`
+	MaxQty           Decimal          `json:"max_qty,omitempty"`
+	Step             Decimal          `json:"step,omitempty"`
+	Price            Decimal          `json:"price,omitempty"`
+	Variants         []ProductVariant `json:"variants,omitempty"`
+}
+
+// Katalogdagi variant: birlik va qoidalar mahsulotnikidan to'ldirilgan
+type VariantSimple struct {
+	ID       uint    `json:"id"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Unit     string  `json:"unit,omitempty"`
+	Decimals int     `json:"decimals"`
+	Price    Decimal `json:"price"`
+	MinQty   Decimal `json:"min_qty,omitempty"`
+	MaxQty   Decimal `json:"max_qty,omitempty"`
+	Step     Decimal `json:"step,omitempty"`
+}
+
+// Pagination
+type ListParams struct {
+	Page   int
+	Limit  int
+	Sort   string
+	Desc   bool
+	Search string
+}
+
+type Pagination struct {
+	Page       int    `json:"page"`
+	Limit      int    `json:"limit"`
+	Total      int    `json:"total"`
+	TotalPages int    `json:"total_pages"`
+	Sort       string `json:"sort"`
+	Order      string `json:"order"`
+}
+
+type PaginatedResponse struct {
+	Success    bool        `json:"success"`
+	Message    string      `json:"message"`
+	Data       interface{} `json:"data"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// Order shablonlari (filial uchun saqlangan tayyor order)
+type OrderTemplate struct {
+	ID       uint              `json:"id"`
+	Name     string            `json:"name"`
+	UserID   uint              `json:"user_id"`
+	FilialID uint              `json:"filial_id"`
+	Items    []CreateOrderItem `json:"items"`
+	Created  time.Time         `json:"created"`
+	Updated  time.Time         `json:"updated"`
+	Version  uint              `json:"version"`
+}
+
+type OrderTemplateRequest struct {
+	Name  string            `json:"name"`
+	Items []CreateOrderItem `json:"items"`
+}
+
+// Rejalashtirilgan va takrorlanuvchi orderlar
+type ScheduledOrder struct {
+	ID       uint              `json:"id"`
+	Name     string            `json:"name"`
+	UserID   uint              `json:"user_id"`
+	FilialID uint              `json:"filial_id"`
+	Items    []CreateOrderItem `json:"items"`
+	Comment  string            `json:"comment,omitempty"`
+	// Faqat "once" uchun: yaratiladigan orderning yetkazib berish sanasi va sloti
+	DeliveryDate   string     `json:"delivery_date,omitempty"`
+	DeliverySlotID uint       `json:"delivery_slot_id,omitempty"`
+	Type           string     `json:"type"`                  // "once", "daily", "weekly"
+	RunAt          time.Time  `json:"run_at,omitempty"`      // faqat "once" uchun
+	TimeOfDay      string     `json:"time_of_day,omitempty"` // "HH:MM", biznes vaqt zonasida
+	Weekdays       []int      `json:"weekdays,omitempty"`    // 1 - dushanba ... 7 - yakshanba
+	SkipDates      []string   `json:"skip_dates,omitempty"`  // YYYY-MM-DD, o'tkazib yuboriladigan kunlar
+	Status         string     `json:"status"`                // "active", "paused", "completed"
+	NextRun        *time.Time `json:"next_run,omitempty"`
+	LastRun        *time.Time `json:"last_run,omitempty"`
+	LastOrderID    string     `json:"last_order_id,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	Created        time.Time  `json:"created"`
+	Updated        time.Time  `json:"updated"`
+	Version        uint       `json:"version"`
+}
+
+type ScheduledOrderRequest struct {
+	Name           string            `json:"name"`
+	Items          []CreateOrderItem `json:"items"`
+	Comment        string            `json:"comment"`
+	DeliveryDate   string            `json:"delivery_date"`
+	DeliverySlotID uint              `json:"delivery_slot_id"`
+	Type           string            `json:"type"`
+	RunAt          time.Time         `json:"run_at"`
+	TimeOfDay      string            `json:"time_of_day"`
+	Weekdays       []int             `json:"weekdays"`
+}
+
+type SkipScheduledOrderRequest struct {
+	Date string `json:"date"`
+}
+
+// Buyurtma qabul qilish oynasi (kategoriya va/yoki filial bo'yicha).
+// CategoryID = 0 yoki FilialID = 0 - barchasiga tegishli.
+type OrderingWindow struct {
+	ID         uint   `json:"id"`
+	CategoryID uint   `json:"category_id"`
+	FilialID   uint   `json:"filial_id"`
+	OpenTime   string `json:"open_time"`   // "HH:MM", biznes vaqt zonasida
+	CloseTime  string `json:"close_time"`  // "HH:MM"; open_time dan kichik bo'lsa tun orqali
+	LateAction string `json:"late_action"` // "reject" - rad etish, "defer" - ochilish vaqtiga rejalashtirish
+	Version    uint   `json:"version"`
+}
+
+type OrderingWindowRequest struct {
+	CategoryID uint   `json:"category_id"`
+	FilialID   uint   `json:"filial_id"`
+	OpenTime   string `json:"open_time"`
+	CloseTime  string `json:"close_time"`
+	LateAction string `json:"late_action"`
+}
+
+type CategoryOrderingStatus struct {
+	CategoryID   uint       `json:"category_id"`
+	CategoryName string     `json:"category_name"`
+	Orderable    bool       `json:"orderable"`
+	ClosesAt     *time.Time `json:"closes_at,omitempty"`
+	OpensAt      *time.Time `json:"opens_at,omitempty"`
+	LateAction   string     `json:"late_action,omitempty"`
+}
+
+// Ombor qoldig'i. FilialID = 0 - markaziy oshxona; filial uchun alohida yozuv bo'lsa
+// o'sha filial orderlari shu qoldiqdan yechiladi. Yozuvi yo'q mahsulot cheklanmagan.
+type StockLevel struct {
+	ProductID    uint      `json:"product_id"`
+	FilialID     uint      `json:"filial_id"`
+	Quantity     Decimal   `json:"quantity"`
+	LowThreshold Decimal   `json:"low_threshold"` // shundan kam qolsa Telegram ga ogohlantirish (0 - o'chirilgan)
+	Updated      time.Time `json:"updated"`
+	Version      uint      `json:"version"`
+}
+
+// Qoldiq harakati: kirim, tuzatish yoki order bo'yicha chiqim
+type StockMovement struct {
+	ID        uint      `json:"id"`
+	ProductID uint      `json:"product_id"`
+	FilialID  uint      `json:"filial_id"`
+	Type      string    `json:"type"`   // "restock", "adjust", "order"
+	Change    Decimal   `json:"change"` // kirim musbat, chiqim manfiy
+	Balance   Decimal   `json:"balance"`
+	Reason    string    `json:"reason,omitempty"`
+	OrderID   uint      `json:"order_id,omitempty"`
+	UserID    uint      `json:"user_id,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+type RestockRequest struct {
+	ProductID uint    `json:"product_id"`
+	FilialID  uint    `json:"filial_id"`
+	Quantity  Decimal `json:"quantity"`
+	Reason    string  `json:"reason"`
+}
+
+// Change - qoldiqqa qo'shiladigan (manfiy - ayiriladigan) miqdor, sabab majburiy
+type StockAdjustRequest struct {
+	ProductID uint    `json:"product_id"`
+	FilialID  uint    `json:"filial_id"`
+	Change    Decimal `json:"change"`
+	Reason    string  `json:"reason"`
+}
+
+type StockThresholdRequest struct {
+	ProductID    uint    `json:"product_id"`
+	FilialID     uint    `json:"filial_id"`
+	LowThreshold Decimal `json:"low_threshold"`
+}
+
+type StockLevelDetails struct {
+	StockLevel
+	ProductName string `json:"product_name"`
+	FilialName  string `json:"filial_name"`
+	Type        string `json:"type"`
+	Low         bool   `json:"low"`
+}
+
+// Stop-list: mahsulot vaqtincha (Until gacha) buyurtma qilinmaydi.
+// FilialID = 0 - barcha filiallar uchun.
+type StopListEntry struct {
+	ID        uint      `json:"id"`
+	ProductID uint      `json:"product_id"`
+	FilialID  uint      `json:"filial_id"`
+	Until     time.Time `json:"until"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy uint      `json:"created_by"`
+	Created   time.Time `json:"created"`
+	Version   uint      `json:"version"`
+}
+
+// Until bo'sh bo'lsa - joriy biznes kun oxirigacha
+type StopListRequest struct {
+	ProductID uint      `json:"product_id"`
+	FilialID  uint      `json:"filial_id"`
+	Until     time.Time `json:"until"`
+	Reason    string    `json:"reason"`
+}
+
+type StopListEntryDetails struct {
+	StopListEntry
+	ProductName string `json:"product_name"`
+	FilialName  string `json:"filial_name"`
+}
+
+// Subkategoriyalar bo'yicha order hisoboti (GET /api/reports/category-items)
+type SubcategoryReport struct {
+	CategoryItemID uint                 `json:"category_item_id"` // 0 - subkategoriyasiz
+	Name           string               `json:"name"`
+	CategoryID     uint                 `json:"category_id"`
+	CategoryName   string               `json:"category_name"`
+	OrderCount     int                  `json:"order_count"`
+	Products       []ProductQuantityRow `json:"products"`
+}
+
+type ProductQuantityRow struct {
+	ProductID uint    `json:"product_id"`
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	Count     Decimal `json:"count"`
+}
+
+// Tartiblash: ids - yangi tartib (ro'yxatda yo'qlar ulardan keyin, avvalgi tartibda qoladi)
+type ReorderRequest struct {
+	IDs []uint `json:"ids"`
+}
+
+type CategoryItemReorderRequest struct {
+	CategoryID uint   `json:"category_id"`
+	IDs        []uint `json:"ids"`
+}
+
+// Mahsulotlarni kategoriya/subkategoriyaga ko'chirish va shu guruh ichida tartiblash
+type ProductMoveRequest struct {
+	CategoryID     uint   `json:"category_id"`
+	CategoryItemID uint   `json:"category_item_id"`
+	IDs            []uint `json:"ids"`
+}
+
+// Yetkazib berish sloti (kunlik vaqt oralig'i). Capacity - har bir filial uchun shu slotga
+// kunlik orderlar soni (0 - cheklanmagan); FilialLimits da filial uchun alohida cheklov.
+type DeliverySlot struct {
+	ID           uint              `json:"id"`
+	Name         string            `json:"name"`
+	StartTime    string            `json:"start_time"` // "HH:MM", biznes vaqt zonasida
+	EndTime      string            `json:"end_time"`
+	Capacity     int               `json:"capacity"`
+	FilialLimits []SlotFilialLimit `json:"filial_limits,omitempty"`
+	RouteLimits  []SlotRouteLimit  `json:"route_limits,omitempty"` // marshrutdagi barcha filiallar uchun umumiy cheklov
+	Active       bool              `json:"active"`
+	Version      uint              `json:"version"`
+}
+
+type SlotFilialLimit struct {
+	FilialID uint `json:"filial_id"`
+	Capacity int  `json:"capacity"`
+}
+
+type SlotRouteLimit struct {
+	RouteID  uint `json:"route_id"`
+	Capacity int  `json:"capacity"`
+}
+
+type DeliverySlotRequest struct {
+	Name         string            `json:"name"`
+	StartTime    string            `json:"start_time"`
+	EndTime      string            `json:"end_time"`
+	Capacity     int               `json:"capacity"`
+	FilialLimits []SlotFilialLimit `json:"filial_limits"`
+	RouteLimits  []SlotRouteLimit  `json:"route_limits"`
+	Active       *bool             `json:"active"` // berilmasa yangi slot faol
+}
+
+// Filial uchun sana bo'yicha slot holati (GET /api/delivery-slots/available)
+type DeliverySlotAvailability struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	Capacity  int    `json:"capacity"` // 0 - cheklanmagan
+	Booked    int    `json:"booked"`
+	Remaining *int   `json:"remaining,omitempty"`
+	Available bool   `json:"available"`
+}
+
+// Yetkazib berish sloti bo'yicha guruhlangan orderlar (GET /api/delivery-slots/orders)
+type DeliverySlotOrders struct {
+	DeliveryDate string  `json:"delivery_date"`
+	SlotID       uint    `json:"slot_id"` // 0 - slotsiz
+	Label        string  `json:"label,omitempty"`
+	Name         string  `json:"name,omitempty"`
+	StartTime    string  `json:"start_time,omitempty"`
+	EndTime      string  `json:"end_time,omitempty"`
+	OrderCount   int     `json:"order_count"`
+	Orders       []Order `json:"orders"`
+}
+
+// Yetkazib berish marshruti: FilialIDs - to'xtash joylari yurish tartibida
+type DeliveryRoute struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	FilialIDs []uint `json:"filial_ids"`
+	DriverID  uint   `json:"driver_id,omitempty"` // odatiy haydovchi
+	Vehicle   string `json:"vehicle,omitempty"`
+	Version   uint   `json:"version"`
+}
+
+type DeliveryRouteRequest struct {
+	Name      string `json:"name"`
+	FilialIDs []uint `json:"filial_ids"`
+	DriverID  uint   `json:"driver_id"`
+	Vehicle   string `json:"vehicle"`
+}
+
+// Orderlarni marshrutga biriktirish. DriverID = 0 - marshrutning odatiy haydovchisi,
+// OrderIDs bo'sh - marshrut filiallarining shu kungi barcha orderlari
+type RouteAssignRequest struct {
+	Date           string `json:"date"`
+	DriverID       uint   `json:"driver_id"`
+	OrderIDs       []uint `json:"order_ids"`
+	DeliverySlotID uint   `json:"delivery_slot_id"` // sanasiz orderlar uchun ixtiyoriy slot
+}
+
+type StopDeliveredRequest struct {
+	Date string `json:"date"`
+}
+
+// Marshrut yuk xati (dispatch manifest)
+type RouteManifest struct {
+	RouteID    uint           `json:"route_id"`
+	RouteName  string         `json:"route_name"`
+	Vehicle    string         `json:"vehicle,omitempty"`
+	Date       string         `json:"date"`
+	Driver     string         `json:"driver,omitempty"`
+	OrderCount int            `json:"order_count"`
+	Stops      []ManifestStop `json:"stops"`
+	Totals     []ManifestItem `json:"totals"` // butun marshrut bo'yicha yuklanadigan mahsulotlar
+}
+
+type ManifestStop struct {
+	Position    int             `json:"position"`
+	FilialID    uint            `json:"filial_id"`
+	FilialName  string          `json:"filial_name"`
+	Location    string          `json:"location,omitempty"`
+	Orders      []ManifestOrder `json:"orders"`
+	Items       []ManifestItem  `json:"items"`
+	Delivered   bool            `json:"delivered"`
+	DeliveredAt *time.Time      `json:"delivered_at,omitempty"`
+}
+
+type ManifestOrder struct {
+	ID           uint       `json:"id"`
+	OrderID      string     `json:"order_id"`
+	Status       string     `json:"status"`
+	DeliverySlot string     `json:"delivery_slot,omitempty"`
+	Comment      string     `json:"comment,omitempty"`
+	DeliveredAt  *time.Time `json:"delivered_at,omitempty"`
+}
+
+type ManifestItem struct {
+	ProductID   uint     `json:"product_id"`
+	VariantID   uint     `json:"variant_id,omitempty"`
+	Name        string   `json:"name"`
+	VariantName string   `json:"variant_name,omitempty"`
+	Type        string   `json:"type"`
+	Count       Decimal  `json:"count"`
+	Quantity    string   `json:"quantity"`
+	Notes       []string `json:"notes,omitempty"`
+}
+
+// Ishlab chiqarish rejasi filtri (GET /api/production-plan)
+type ProductionPlanFilter struct {
+	Date            string // YYYY-MM-DD: yetkazib berish sanasi, u bo'lmasa order biznes kuni
+	DeliverySlotIDs []uint
+	FilialIDs       []uint
+	CategoryIDs     []uint
+	Printers        []uint
+}
+
+type ProductionPlan struct {
+	Date            string              `json:"date"`
+	DeliverySlotIDs []uint              `json:"delivery_slot_ids,omitempty"`
+	OrderCount      int                 `json:"order_count"`
+	Printers        []ProductionPrinter `json:"printers"`
+}
+
+type ProductionPrinter struct {
+	Printer    uint                 `json:"printer"`
+	Categories []ProductionCategory `json:"categories"`
+}
+
+type ProductionCategory struct {
+	CategoryID uint             `json:"category_id"`
+	Name       string           `json:"name"`
+	Lines      []ProductionLine `json:"lines"`
+}
+
+type ProductionLine struct {
+	ProductID   uint                  `json:"product_id"`
+	VariantID   uint                  `json:"variant_id,omitempty"`
+	Name        string                `json:"name"`
+	VariantName string                `json:"variant_name,omitempty"`
+	Type        string                `json:"type"`
+	Count       Decimal               `json:"count"`
+	Quantity    string                `json:"quantity"`
+	Filials     []ProductionFilialQty `json:"filials"` // filiallar bo'yicha taqsimot
+}
+
+type ProductionFilialQty struct {
+	FilialID   uint    `json:"filial_id"`
+	FilialName string  `json:"filial_name"`
+	Count      Decimal `json:"count"`
+	Quantity   string  `json:"quantity"`
+}
+
+// ============= KDS (oshxona ekranlari) =============
+type KDSStationInfo struct {
+	Printer    uint          `json:"printer"`
+	Categories []KDSCategory `json:"categories"`
+	OpenOrders int           `json:"open_orders"`
+	OpenItems  int           `json:"open_items"`
+}
+
+type KDSCategory struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+type KDSQueue struct {
+	Printer uint       `json:"printer"`
+	Orders  []KDSOrder `json:"orders"`
+}
+
+type KDSOrder struct {
+	ID           uint      `json:"id"`
+	OrderID      string    `json:"order_id"`
+	FilialID     uint      `json:"filial_id"`
+	FilialName   string    `json:"filial_name"`
+	Status       string    `json:"status"`
+	Comment      string    `json:"comment,omitempty"`
+	DeliveryDate string    `json:"delivery_date,omitempty"`
+	DeliverySlot string    `json:"delivery_slot,omitempty"`
+	Created      time.Time `json:"created"`
+	Items        []KDSItem `json:"items"`
+}
+
+type KDSItem struct {
+	ProductID     uint       `json:"product_id"`
+	VariantID     uint       `json:"variant_id,omitempty"`
+	Name          string     `json:"name"`
+	VariantName   string     `json:"variant_name,omitempty"`
+	CategoryID    uint       `json:"category_id"`
+	Category      string     `json:"category"`
+	Count         Decimal    `json:"count"`
+	Type          string     `json:"type"`
+	Quantity      string     `json:"quantity"`
+	Note          string     `json:"note,omitempty"`
+	KitchenStatus string     `json:"kitchen_status,omitempty"`
+	BumpedAt      *time.Time `json:"bumped_at,omitempty"`
+}
+
+// Bump/recall: items bo'sh bo'lsa stansiyadagi barcha qatorlar
+type KDSActionRequest struct {
+	Items []KDSLineRef `json:"items"`
+}
+
+type KDSLineRef struct {
+	ProductID uint `json:"product_id"`
+	VariantID uint `json:"variant_id"`
+}
+
+// SSE hodisasi (event: <type>)
+type KDSEvent struct {
+	Type     string    `json:"type"` // "created", "updated", "cancelled", "deleted", "bumped", "recalled"
+	ID       uint      `json:"id"`
+	OrderID  string    `json:"order_id"`
+	FilialID uint      `json:"filial_id"`
+	Status   string    `json:"status"`
+	Printers []uint    `json:"printers"`
+	Time     time.Time `json:"time"`
+}
+
+// EventSource uchun qisqa muddatli token: /kds/stream?token=...
+type KDSStreamToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ============= JO'NATISH (qator bo'yicha) =============
+type OrderShipment struct {
+	ID       uint           `json:"id"`
+	Items    []ShipmentItem `json:"items"`
+	Note     string         `json:"note,omitempty"`
+	UserID   uint           `json:"user_id"`
+	Username string         `json:"username"`
+	Created  time.Time      `json:"created"`
+}
+
+type ShipmentItem struct {
+	ProductID   uint    `json:"product_id"`
+	VariantID   uint    `json:"variant_id,omitempty"`
+	Name        string  `json:"name"`
+	VariantName string  `json:"variant_name,omitempty"`
+	Type        string  `json:"type"`
+	Count       Decimal `json:"count"`              // shu jo'natmada jo'natilgan
+	Shortage    Decimal `json:"shortage,omitempty"` // kamomad deb yopilgan
+	Reason      string  `json:"reason,omitempty"`
+}
+
+// POST /api/orders/{id}/shipments
+type ShipmentRequest struct {
+	Items         []ShipmentLineRequest `json:"items"`
+	ShipRemaining bool                  `json:"ship_remaining"` // qolgan ochiq qatorlar to'liq jo'natiladi
+	Note          string                `json:"note"`
+}
+
+// short=true bo'lsa qatorning count dan ortiq qolgan miqdori kamomad sifatida yopiladi (reason majburiy)
+type ShipmentLineRequest struct {
+	ProductID uint    `json:"product_id"`
+	VariantID uint    `json:"variant_id"`
+	Count     Decimal `json:"count"`
+	Short     bool    `json:"short"`
+	Reason    string  `json:"reason"`
+}
+
+// Filial ko'rinishi: buyurtma qilingan va yetkazilgan
+type OrderFulfilment struct {
+	ID          uint             `json:"id"`
+	OrderID     string           `json:"order_id"`
+	Status      string           `json:"status"`
+	HasShortage bool             `json:"has_shortage"`
+	Lines       []FulfilmentLine `json:"lines"`
+	Shipments   []OrderShipment  `json:"shipments"`
+}
+
+type FulfilmentLine struct {
+	ProductID    uint    `json:"product_id"`
+	VariantID    uint    `json:"variant_id,omitempty"`
+	Name         string  `json:"name"`
+	VariantName  string  `json:"variant_name,omitempty"`
+	Type         string  `json:"type"`
+	Ordered      Decimal `json:"ordered"`
+	Delivered    Decimal `json:"delivered"`
+	Shortage     Decimal `json:"shortage"`
+	Pending      Decimal `json:"pending"`
+	OrderedQty   string  `json:"ordered_qty"`
+	DeliveredQty string  `json:"delivered_qty"`
+	Status       string  `json:"status"`
+	Reason       string  `json:"reason,omitempty"`
+}
+
+// ============= TOVAR QABUL QILISH (filial) =============
+type OrderReceipt struct {
+	Items          []ReceiptItem `json:"items"`
+	HasDiscrepancy bool          `json:"has_discrepancy"`
+	Note           string        `json:"note,omitempty"`
+	UserID         uint          `json:"user_id"`
+	Username       string        `json:"username"`
+	Created        time.Time     `json:"created"`
+}
+
+type ReceiptItem struct {
+	ProductID   uint    `json:"product_id"`
+	VariantID   uint    `json:"variant_id,omitempty"`
+	Name        string  `json:"name"`
+	VariantName string  `json:"variant_name,omitempty"`
+	Type        string  `json:"type"`
+	Expected    Decimal `json:"expected"` // jo'natilgan
+	Received    Decimal `json:"received"` // yaroqli qabul qilingan
+	Missing     Decimal `json:"missing"`
+	Damaged     Decimal `json:"damaged"`
+	Note        string  `json:"note,omitempty"`
+	PhotoURL    string  `json:"photo_url,omitempty"` // /api/upload dan olingan manzil
+}
+
+// POST /api/orders/{id}/receipt - ko'rsatilmagan qatorlar to'liq qabul qilingan hisoblanadi
+type ReceiptRequest struct {
+	Items []ReceiptLineRequest `json:"items"`
+	Note  string               `json:"note"`
+}
+
+// Yetishmagan miqdor = jo'natilgan - received - damaged
+type ReceiptLineRequest struct {
+	ProductID uint    `json:"product_id"`
+	VariantID uint    `json:"variant_id"`
+	Received  Decimal `json:"received"`
+	Damaged   Decimal `json:"damaged"`
+	Note      string  `json:"note"`
+	PhotoURL  string  `json:"photo_url"`
+}
+
+type ReceiptDiscrepancyReport struct {
+	OrderCount int                       `json:"order_count"`
+	Lines      []ReceiptDiscrepancy      `json:"lines"`
+	Totals     []ReceiptDiscrepancyTotal `json:"totals"` // mahsulotlar bo'yicha jami
+}
+
+type ReceiptDiscrepancy struct {
+	ID         uint      `json:"id"`
+	OrderID    string    `json:"order_id"`
+	FilialID   uint      `json:"filial_id"`
+	FilialName string    `json:"filial_name"`
+	ReceivedAt time.Time `json:"received_at"`
+	ReceivedBy string    `json:"received_by"`
+	ReceiptItem
+}
+
+type ReceiptDiscrepancyTotal struct {
+	ProductID   uint    `json:"product_id"`
+	VariantID   uint    `json:"variant_id,omitempty"`
+	Name        string  `json:"name"`
+	VariantName string  `json:"variant_name,omitempty"`
+	Type        string  `json:"type"`
+	Missing     Decimal `json:"missing"`
+	Damaged     Decimal `json:"damaged"`
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Order izohi va mahsulot qatori izohi uchun maksimal uzunlik (belgilarda)
+var (
+	maxItemNoteLength     = envInt("ORDER_ITEM_NOTE_MAX", 200)
+	maxOrderCommentLength = envInt("ORDER_COMMENT_MAX", 500)
+)
+
+// Izohni tozalaydi: boshqaruv belgilari olib tashlanadi, qator o'tkazish va
+// ketma-ket bo'shliqlar bitta bo'shliqqa aylanadi (chek bir qatorda chiqadi).
+func sanitizeNote(text string, maxLength int) (string, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, text)
+	cleaned = strings.Join(strings.Fields(cleaned), " ")
+	if len([]rune(cleaned)) > maxLength {
+		return "", fmt.Errorf("izoh %d belgidan oshmasligi kerak", maxLength)
+	}
+	return cleaned, nil
+}
+
+// Birlashtirilgan qatorlar izohlari: takrorlanmasa "; " bilan qo'shiladi
+func joinNotes(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case b == "":
+		return a
+	}
+	return a + "; " + b
+}
+
+// Itemlar izohlarini joyida tozalaydi (shablon va rejalashtirilgan orderlar uchun)
+func sanitizeItemNotes(items []CreateOrderItem) error {
+	for i := range items {
+		note, err := sanitizeNote(items[i].Note, maxItemNoteLength)
+		if err != nil {
+			return err
+		}
+		items[i].Note = note
+	}
+	return nil
+}
+
+// Telegram Markdown (legacy) maxsus belgilarini ekranlash - izoh matni formatlashni buzmasin
+var markdownEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
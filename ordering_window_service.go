@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Buyurtma qabul qilish oynalari
+var (
+	orderingWindows      []OrderingWindow
+	nextOrderingWindowID uint = 1
+)
+
+const orderingWindowsFile = "data/ordering_windows.json"
+
+func loadOrderingWindows() {
+	if data, err := ioutil.ReadFile(orderingWindowsFile); err == nil {
+		json.Unmarshal(data, &orderingWindows)
+		for _, w := range orderingWindows {
+			if w.ID >= nextOrderingWindowID {
+				nextOrderingWindowID = w.ID + 1
+			}
+		}
+	}
+}
+
+func saveOrderingWindows() {
+	data, _ := json.MarshalIndent(orderingWindows, "", "  ")
+	ioutil.WriteFile(orderingWindowsFile, data, 0644)
+}
+
+func findOrderingWindowByID(id uint) *OrderingWindow {
+	for i, w := range orderingWindows {
+		if w.ID == id {
+			return &orderingWindows[i]
+		}
+	}
+	return nil
+}
+
+// Kategoriya + filial uchun eng aniq oyna: kategoriya+filial > kategoriya > filial
+func findOrderingWindow(categoryID, filialID uint) *OrderingWindow {
+	var best *OrderingWindow
+	bestScore := -1
+	for i, w := range orderingWindows {
+		if w.CategoryID != 0 && w.CategoryID != categoryID {
+			continue
+		}
+		if w.FilialID != 0 && w.FilialID != filialID {
+			continue
+		}
+		score := 0
+		if w.CategoryID != 0 {
+			score += 2
+		}
+		if w.FilialID != 0 {
+			score++
+		}
+		if score > bestScore {
+			best = &orderingWindows[i]
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// "HH:MM" ni now kunidagi vaqtga aylantiradi (biznes vaqt zonasida)
+func clockOnDay(clock string, now time.Time) time.Time {
+	t, _ := time.Parse("15:04", clock)
+	local := now.In(businessLocation)
+	return time.Date(local.Year(), local.Month(), local.Day(), t.Hour(), t.Minute(), 0, 0, businessLocation)
+}
+
+func (w *OrderingWindow) isOpen(now time.Time) bool {
+	open := clockOnDay(w.OpenTime, now)
+	closeAt := clockOnDay(w.CloseTime, now)
+	if open.Before(closeAt) {
+		return !now.Before(open) && now.Before(closeAt)
+	}
+	// Tun orqali oyna, masalan 20:00 - 06:00
+	return !now.Before(open) || now.Before(closeAt)
+}
+
+// Oyna keyingi safar qachon ochiladi
+func (w *OrderingWindow) nextOpen(now time.Time) time.Time {
+	open := clockOnDay(w.OpenTime, now)
+	if open.After(now) {
+		return open
+	}
+	return open.AddDate(0, 0, 1)
+}
+
+// Ochiq oyna qachon yopiladi
+func (w *OrderingWindow) nextClose(now time.Time) time.Time {
+	closeAt := clockOnDay(w.CloseTime, now)
+	if closeAt.After(now) {
+		return closeAt
+	}
+	return closeAt.AddDate(0, 0, 1)
+}
+
+// Kategoriya hozir buyurtma qabul qiladimi; oyna bo'lmasa doim ochiq
+func CategoryOrderingStatusFor(category *Category, filialID uint, now time.Time) CategoryOrderingStatus {
+	status := CategoryOrderingStatus{
+		CategoryID:   category.ID,
+		CategoryName: category.Name,
+		Orderable:    true,
+	}
+
+	window := findOrderingWindow(category.ID, filialID)
+	if window == nil {
+		return status
+	}
+
+	status.LateAction = window.LateAction
+	if window.isOpen(now) {
+		closesAt := window.nextClose(now)
+		status.ClosesAt = &closesAt
+	} else {
+		status.Orderable = false
+		opensAt := window.nextOpen(now)
+		status.OpensAt = &opensAt
+	}
+	return status
+}
+
+// Kechikkan itemlarni ajratadi. "reject" oynali kategoriya yopiq bo'lsa xato qaytaradi,
+// "defer" oynalilar esa ochilish vaqti bo'yicha guruhlanadi.
+func SplitLateOrderItems(filialID uint, items []CreateOrderItem, now time.Time) ([]CreateOrderItem, map[time.Time][]CreateOrderItem, error) {
+	var onTime []CreateOrderItem
+	deferred := make(map[time.Time][]CreateOrderItem)
+	var rejected []string
+
+	for _, item := range items {
+		product := findProductByID(item.ProductID)
+		if product == nil {
+			// Mahsulot xatosini CreateOrder o'zi qaytaradi
+			onTime = append(onTime, item)
+			continue
+		}
+
+		window := findOrderingWindow(product.CategoryID, filialID)
+		if window == nil || window.isOpen(now) {
+			onTime = append(onTime, item)
+			continue
+		}
+
+		if window.LateAction == "defer" {
+			opensAt := window.nextOpen(now)
+			deferred[opensAt] = append(deferred[opensAt], item)
+			continue
+		}
+
+		categoryName := fmt.Sprintf("ID %d", product.CategoryID)
+		if category := findCategoryByID(product.CategoryID); category != nil {
+			categoryName = category.Name
+		}
+		rejected = append(rejected, fmt.Sprintf("%s (%s - %s)", categoryName, window.OpenTime, window.CloseTime))
+	}
+
+	if len(rejected) > 0 {
+		return nil, nil, fmt.Errorf("buyurtma qabul qilish vaqti tugagan: %s", strings.Join(uniqueStrings(rejected), ", "))
+	}
+	return onTime, deferred, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// CreateOrder uchun: yopiq oynali mahsulotni qabul qilmaymiz
+func checkProductOrderable(product *Product, filialID uint, now time.Time) error {
+	window := findOrderingWindow(product.CategoryID, filialID)
+	if window == nil || window.isOpen(now) {
+		return nil
+	}
+	return fmt.Errorf("mahsulot %s uchun buyurtma vaqti %s - %s", product.Name, window.OpenTime, window.CloseTime)
+}
+
+// Kechiktirilgan itemlar uchun bir martalik rejalar (ochilish vaqti bo'yicha tartiblangan).
+// Kechiktirilgan orderlar asl so'rovdagi izoh va yetkazib berish vaqtini saqlaydi.
+func deferredScheduleRequests(deferred map[time.Time][]CreateOrderItem, req CreateOrderRequest) []ScheduledOrderRequest {
+	runTimes := make([]time.Time, 0, len(deferred))
+	for runAt := range deferred {
+		runTimes = append(runTimes, runAt)
+	}
+	sort.Slice(runTimes, func(i, j int) bool { return runTimes[i].Before(runTimes[j]) })
+
+	requests := make([]ScheduledOrderRequest, 0, len(runTimes))
+	for _, runAt := range runTimes {
+		requests = append(requests, ScheduledOrderRequest{
+			Name:           "Kechiktirilgan order",
+			Items:          deferred[runAt],
+			Comment:        req.Comment,
+			DeliveryDate:   req.DeliveryDate,
+			DeliverySlotID: req.DeliverySlotID,
+			Type:           "once",
+			RunAt:          runAt,
+		})
+	}
+	return requests
+}
+
+// Barcha kechiktirilgan rejalarni tekshiradi - order yoki reja yaratishdan oldin chaqiriladi
+// (masalan, yetkazib berish sanasi oyna ochilishidan oldin bo'lsa butun so'rov rad etiladi)
+func ValidateDeferredOrderItems(user *User, deferred map[time.Time][]CreateOrderItem, req CreateOrderRequest) error {
+	if user.FilialID == 0 {
+		return fmt.Errorf("sizga filial belgilanmagan")
+	}
+	for _, scheduleReq := range deferredScheduleRequests(deferred, req) {
+		if err := validateScheduledOrder(scheduleReq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Kechiktirilgan itemlar uchun ochilish vaqtiga bir martalik rejalar yaratadi.
+// Avval hammasi tekshiriladi - rejalarning bir qismi yaratilib qolmaydi.
+func DeferOrderItems(user *User, deferred map[time.Time][]CreateOrderItem, req CreateOrderRequest) ([]ScheduledOrder, error) {
+	if err := ValidateDeferredOrderItems(user, deferred, req); err != nil {
+		return nil, err
+	}
+
+	var schedules []ScheduledOrder
+	for _, scheduleReq := range deferredScheduleRequests(deferred, req) {
+		schedule, err := CreateScheduledOrder(user, scheduleReq)
+		if err != nil {
+			return schedules, err
+		}
+		schedules = append(schedules, *schedule)
+	}
+	return schedules, nil
+}
+
+func validateOrderingWindow(req OrderingWindowRequest) error {
+	if req.CategoryID != 0 && findCategoryByID(req.CategoryID) == nil {
+		return fmt.Errorf("kategoriya topilmadi")
+	}
+	if req.FilialID != 0 && findFilialByID(req.FilialID) == nil {
+		return fmt.Errorf("filial topilmadi")
+	}
+	if _, err := time.Parse("15:04", req.OpenTime); err != nil {
+		return fmt.Errorf("open_time HH:MM formatida bo'lishi kerak")
+	}
+	if _, err := time.Parse("15:04", req.CloseTime); err != nil {
+		return fmt.Errorf("close_time HH:MM formatida bo'lishi kerak")
+	}
+	if req.OpenTime == req.CloseTime {
+		return fmt.Errorf("open_time va close_time bir xil bo'lishi mumkin emas")
+	}
+	if req.LateAction != "reject" && req.LateAction != "defer" {
+		return fmt.Errorf("late_action faqat reject yoki defer bo'lishi mumkin")
+	}
+	return nil
+}
+
+// ============= CRUD =============
+func CreateOrderingWindow(req OrderingWindowRequest) (*OrderingWindow, error) {
+	if req.OpenTime == "" {
+		req.OpenTime = "00:00"
+	}
+	if req.LateAction == "" {
+		req.LateAction = "reject"
+	}
+	if err := validateOrderingWindow(req); err != nil {
+		return nil, err
+	}
+
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	window := OrderingWindow{
+		ID:         nextOrderingWindowID,
+		CategoryID: req.CategoryID,
+		FilialID:   req.FilialID,
+		OpenTime:   req.OpenTime,
+		CloseTime:  req.CloseTime,
+		LateAction: req.LateAction,
+		Version:    1,
+	}
+	orderingWindows = append(orderingWindows, window)
+	nextOrderingWindowID++
+	saveOrderingWindows()
+	return &window, nil
+}
+
+func GetAllOrderingWindows() []OrderingWindow {
+	return orderingWindows
+}
+
+func GetOrderingWindowByID(id uint) *OrderingWindow {
+	return findOrderingWindowByID(id)
+}
+
+func UpdateOrderingWindow(id uint, req OrderingWindowRequest, ifMatch string) (*OrderingWindow, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	window := findOrderingWindowByID(id)
+	if window == nil {
+		return nil, nil
+	}
+	if err := checkVersion(ifMatch, entityETag("ordering-window", window.ID, window.Version), *window); err != nil {
+		return nil, err
+	}
+	if req.OpenTime == "" {
+		req.OpenTime = "00:00"
+	}
+	if req.LateAction == "" {
+		req.LateAction = "reject"
+	}
+	if err := validateOrderingWindow(req); err != nil {
+		return nil, err
+	}
+	window.CategoryID = req.CategoryID
+	window.FilialID = req.FilialID
+	window.OpenTime = req.OpenTime
+	window.CloseTime = req.CloseTime
+	window.LateAction = req.LateAction
+	window.Version++
+	saveOrderingWindows()
+
+	result := *window
+	return &result, nil
+}
+
+func DeleteOrderingWindow(id uint, ifMatch string) (bool, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	for i, w := range orderingWindows {
+		if w.ID == id {
+			if err := checkVersion(ifMatch, entityETag("ordering-window", w.ID, w.Version), w); err != nil {
+				return false, err
+			}
+			orderingWindows = append(orderingWindows[:i], orderingWindows[i+1:]...)
+			saveOrderingWindows()
+			return true, nil
+		}
+	}
+	return false, nil
+}
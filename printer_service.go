@@ -7,7 +7,6 @@ import (
 	"log"
 	"net/http"
 	"strings"
-	"time"
 )
 
 // Telegram message structure
@@ -30,9 +29,14 @@ func sendToTelegram(order *Order, categoryItems map[uint][]PrinterItem, printerS
 	message.WriteString(fmt.Sprintf("📋 *Заказ ID:* `%s`\n", order.OrderID))
 	message.WriteString(fmt.Sprintf("👤 *Клиент:* %s\n", order.Username))
 	message.WriteString(fmt.Sprintf("🏢 *Ветвь:* %s\n", order.FilialName))
-	loc := time.FixedZone("UTC+5", 5*60*60)
-	tashkentTime := time.Now().In(loc)
-	message.WriteString(fmt.Sprintf("⏰ *Время:* %s\n\n", tashkentTime.Format("2006-01-02 15:04:05")))
+	message.WriteString(fmt.Sprintf("⏰ *Время:* %s\n", order.Created.In(businessLocation).Format("2006-01-02 15:04:05")))
+	if delivery := deliveryLabel(order); delivery != "" {
+		message.WriteString(fmt.Sprintf("🚚 *Доставка:* %s\n", escapeMarkdown(delivery)))
+	}
+	if order.Comment != "" {
+		message.WriteString(fmt.Sprintf("💬 *Комментарий:* %s\n", escapeMarkdown(order.Comment)))
+	}
+	message.WriteString("\n")
 
 	// Printer status at the top
 	printerStatusText := "❌ *Невозможно отправить на принтер* @Baxtiyor0055"
@@ -49,27 +53,29 @@ func sendToTelegram(order *Order, categoryItems map[uint][]PrinterItem, printerS
 		if category != nil {
 			message.WriteString(fmt.Sprintf("\n🔸 *%s:*\n", category.Name))
 			for _, item := range items {
-				count := float64(item.Count)
-				var formattedCount string
-
-				// Agar butun son bo‘lsa
-				if count == float64(int64(count)) {
-					formattedCount = fmt.Sprintf("%d", int64(count))
-				} else {
-					// 3 ta kasr raqamgacha
-					formattedCount = fmt.Sprintf("%.3f", count)
-					// ortiqcha nol va nuqtani olib tashlash
-					formattedCount = strings.TrimRight(strings.TrimRight(formattedCount, "0"), ".")
+				message.WriteString(fmt.Sprintf("   • %s - %s\n", itemLabel(item.Product, item.Variant), item.Quantity))
+				if item.Note != "" {
+					message.WriteString(fmt.Sprintf("      📝 %s\n", escapeMarkdown(item.Note)))
 				}
-
-				message.WriteString(fmt.Sprintf("   • %s - %s %s\n", item.Product, formattedCount, item.Type))
 			}
 		}
 	}
 
+	if err := sendTelegramText(message.String()); err != nil {
+		return err
+	}
+	log.Printf("✅ Telegram ga yuborildi: %s", order.OrderID)
+	return nil
+}
+
+// Telegram sendMessage manzili (testlarda soxta server bilan almashtiriladi)
+var telegramSendMessageURL = "https://api.telegram.org/bot8157743798:AAELzxyyFLSMxbT-XL4l-3ZVmxVBXYOY0Ro/sendMessage"
+
+// Orderlar guruhiga Markdown xabar yuborish (order, ogohlantirishlar va h.k.)
+func sendTelegramText(text string) error {
 	telegramMsg := TelegramMessage{
 		ChatID:    "-4985547344",
-		Text:      message.String(),
+		Text:      text,
 		ParseMode: "Markdown",
 	}
 
@@ -79,18 +85,14 @@ func sendToTelegram(order *Order, categoryItems map[uint][]PrinterItem, printerS
 		return err
 	}
 
-	telegramURL := "https://api.telegram.org/bot8157743798:AAELzxyyFLSMxbT-XL4l-3ZVmxVBXYOY0Ro/sendMessage"
-
-	resp, err := http.Post(telegramURL, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := http.Post(telegramSendMessageURL, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
 		log.Printf("Telegram ga yuborishda xato: %v", err)
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == 200 {
-		log.Printf("✅ Telegram ga yuborildi: %s", order.OrderID)
-	} else {
+	if resp.StatusCode != 200 {
 		log.Printf("❌ Telegram ga yuborishda xato - Status: %d", resp.StatusCode)
 		return fmt.Errorf("telegram yuborishda xato: status %d", resp.StatusCode)
 	}
@@ -98,6 +100,22 @@ func sendToTelegram(order *Order, categoryItems map[uint][]PrinterItem, printerS
 	return nil
 }
 
+// Chek natijasi faqat hali oshxonada ishlanmagan orderning statusiga yoziladi
+var printableStatuses = []string{"pending", "confirmed"}
+
+// Yangi orderni printerga yuboradi va natijaga qarab saqlangan order statusini yangilaydi
+func dispatchOrder(order *Order) error {
+	order.Status = "confirmed"
+	printErr := sendToPrinter(order)
+
+	if printErr != nil {
+		SetOrderStatus(order.ID, "print_error", printableStatuses)
+	} else {
+		SetOrderStatus(order.ID, "sent_to_printer", printableStatuses)
+	}
+	return printErr
+}
+
 func sendToPrinter(order *Order) error {
 	user := findUserByID(order.UserID)
 	if user == nil {
@@ -116,9 +134,12 @@ func sendToPrinter(order *Order) error {
 		product := findProductByID(item.ProductID)
 		if product != nil {
 			categoryItems[product.CategoryID] = append(categoryItems[product.CategoryID], PrinterItem{
-				Product: item.Name,
-				Count:   item.Count,
-				Type:    item.Type,
+				Product:  item.Name,
+				Variant:  item.VariantName,
+				Count:    item.Count,
+				Type:     item.Type,
+				Quantity: formatQuantityWithUnit(item.Count, item.Type),
+				Note:     item.Note,
 			})
 		}
 	}
@@ -163,30 +184,17 @@ func sendToPrinter(order *Order) error {
 			Username: order.Username,
 			Filial:   order.FilialName,
 			Items:    items,
+			Comment:  order.Comment,
+			Delivery: deliveryLabel(order),
 		}
 
-		jsonData, err := json.Marshal(printRequest)
-		if err != nil {
-			log.Printf("JSON marshal xato: %v", err)
-			allSuccess = false
-			continue
-		}
-
-		resp, err := http.Post("https://marxabo1.javohir-jasmina.uz/print", "application/json", bytes.NewBuffer(jsonData))
-		if err != nil {
-			log.Printf("Printerga yuborishda xato (PrinterID %d): %v", printerID, err)
+		if err := postPrintRequest(printRequest); err != nil {
+			log.Printf("❌ %v", err)
 			allSuccess = false
 			continue
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode == 200 {
-			log.Printf("✅ Chek yuborildi: PrinterID %d - %s (%s) | Kategoriyalar: %s",
-				printerID, order.Username, order.FilialName, categoryList)
-		} else {
-			log.Printf("❌ Chek yuborishda xato: PrinterID %d - Status: %d", printerID, resp.StatusCode)
-			allSuccess = false
-		}
+		log.Printf("✅ Chek yuborildi: PrinterID %d - %s (%s) | Kategoriyalar: %s",
+			printerID, order.Username, order.FilialName, categoryList)
 	}
 
 	// Send to Telegram after processing all printers (eski versiya kabi)
@@ -203,3 +211,91 @@ func sendToPrinter(order *Order) error {
 	}
 	return nil
 }
+
+func postPrintRequest(printRequest PrinterRequest) error {
+	jsonData, err := json.Marshal(printRequest)
+	if err != nil {
+		return fmt.Errorf("JSON marshal xato: %v", err)
+	}
+
+	resp, err := http.Post("https://marxabo1.javohir-jasmina.uz/print", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("printerga yuborishda xato (PrinterID %d): %v", printRequest.Printer, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("chek yuborishda xato: PrinterID %d - Status: %d", printRequest.Printer, resp.StatusCode)
+	}
+	return nil
+}
+
+// O'zgarish (CHANGED / CANCELLED) chekini faqat o'zgargan mahsulotlar printerlariga yuboradi
+func sendChangeToPrinter(order *Order, change OrderChange) error {
+	title := "CHANGED"
+	if change.Type == "cancelled" {
+		title = "CANCELLED"
+	}
+
+	printerItems := make(map[uint][]PrinterItem)
+	printerCategories := make(map[uint]map[string]bool)
+
+	for _, item := range change.Items {
+		product := findProductByID(item.ProductID)
+		if product == nil {
+			continue
+		}
+		category := GetCategoryByID(product.CategoryID)
+		if category == nil {
+			log.Printf("Kategoriya topilmadi: %d", product.CategoryID)
+			continue
+		}
+
+		oldCount := item.OldCount
+		printerItems[category.Printer] = append(printerItems[category.Printer], PrinterItem{
+			Product:     item.Name,
+			Variant:     item.VariantName,
+			Count:       item.NewCount,
+			Type:        item.Type,
+			Quantity:    formatQuantityWithUnit(item.NewCount, item.Type),
+			OldCount:    &oldCount,
+			OldQuantity: formatQuantityWithUnit(oldCount, item.Type),
+			Note:        item.Note,
+		})
+		if printerCategories[category.Printer] == nil {
+			printerCategories[category.Printer] = make(map[string]bool)
+		}
+		printerCategories[category.Printer][category.Name] = true
+	}
+
+	allSuccess := true
+	for printerID, items := range printerItems {
+		var categoryNames []string
+		for name := range printerCategories[printerID] {
+			categoryNames = append(categoryNames, name)
+		}
+
+		printRequest := PrinterRequest{
+			Printer:  printerID,
+			Title:    title,
+			OrderID:  order.OrderID,
+			Category: strings.Join(categoryNames, ", "),
+			Username: change.Username,
+			Filial:   order.FilialName,
+			Items:    items,
+			Delivery: deliveryLabel(order),
+		}
+
+		if err := postPrintRequest(printRequest); err != nil {
+			log.Printf("❌ %v", err)
+			allSuccess = false
+			continue
+		}
+		log.Printf("✅ %s cheki yuborildi: PrinterID %d - %s", title, printerID, order.OrderID)
+	}
+
+	if !allSuccess {
+		return fmt.Errorf("ba'zi printerlarga yuborishda xatolik bo'ldi")
+	}
+	return nil
+}
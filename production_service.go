@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// Oshxona ishlab chiqarish rejasi: kun (yoki yetkazib berish sloti) bo'yicha barcha
+// orderlardagi mahsulotlar jami, printer -> kategoriya -> mahsulot ko'rinishida.
+// Order kuni - yetkazib berish sanasi, u bo'lmasa order berilgan biznes kun.
+func orderProductionDate(order *Order) string {
+	if order.DeliveryDate != "" {
+		return order.DeliveryDate
+	}
+	return order.BusinessDay
+}
+
+func productionOrderMatches(order *Order, filter ProductionPlanFilter) bool {
+	if order.Status == "cancelled" || orderProductionDate(order) != filter.Date {
+		return false
+	}
+	if len(filter.DeliverySlotIDs) > 0 && !slices.Contains(filter.DeliverySlotIDs, order.DeliverySlotID) {
+		return false
+	}
+	return len(filter.FilialIDs) == 0 || slices.Contains(filter.FilialIDs, order.FilialID)
+}
+
+func BuildProductionPlan(filter ProductionPlanFilter) ProductionPlan {
+	plan := ProductionPlan{
+		Date:            filter.Date,
+		DeliverySlotIDs: filter.DeliverySlotIDs,
+		Printers:        []ProductionPrinter{},
+	}
+
+	ordersMu.Lock()
+	var planOrders []Order
+	for _, o := range orders {
+		if productionOrderMatches(&o, filter) {
+			planOrders = append(planOrders, o)
+		}
+	}
+	ordersMu.Unlock()
+
+	type lineRef struct {
+		line      *ProductionLine
+		product   *Product
+		printer   uint
+		category  *Category
+		filialIdx map[uint]int
+	}
+	var refs []*lineRef
+	index := make(map[orderLineKey]*lineRef)
+	counted := make(map[uint]bool)
+
+	for _, order := range planOrders {
+		for _, item := range order.Items {
+			product := findProductByID(item.ProductID)
+			if product == nil {
+				continue
+			}
+			category := findCategoryByID(product.CategoryID)
+			if category == nil {
+				continue
+			}
+			if len(filter.CategoryIDs) > 0 && !slices.Contains(filter.CategoryIDs, category.ID) {
+				continue
+			}
+			if len(filter.Printers) > 0 && !slices.Contains(filter.Printers, category.Printer) {
+				continue
+			}
+			counted[order.ID] = true
+
+			key := lineKey(item.ProductID, item.VariantID)
+			ref := index[key]
+			if ref == nil {
+				ref = &lineRef{
+					line: &ProductionLine{
+						ProductID:   item.ProductID,
+						VariantID:   item.VariantID,
+						Name:        item.Name,
+						VariantName: item.VariantName,
+						Type:        item.Type,
+						Filials:     []ProductionFilialQty{},
+					},
+					product:   product,
+					printer:   category.Printer,
+					category:  category,
+					filialIdx: make(map[uint]int),
+				}
+				index[key] = ref
+				refs = append(refs, ref)
+			}
+
+			line := ref.line
+			line.Count = line.Count.Add(item.Count)
+			idx, ok := ref.filialIdx[order.FilialID]
+			if !ok {
+				idx = len(line.Filials)
+				ref.filialIdx[order.FilialID] = idx
+				line.Filials = append(line.Filials, ProductionFilialQty{FilialID: order.FilialID, FilialName: order.FilialName})
+			}
+			line.Filials[idx].Count = line.Filials[idx].Count.Add(item.Count)
+		}
+	}
+	plan.OrderCount = len(counted)
+
+	// Printer, kategoriya tartibi, mahsulot tartibi, variant bo'yicha
+	slices.SortStableFunc(refs, func(a, b *lineRef) int {
+		return cmp.Or(
+			cmp.Compare(a.printer, b.printer),
+			compareCategories(*a.category, *b.category),
+			compareProducts(*a.product, *b.product),
+			cmp.Compare(a.line.VariantID, b.line.VariantID),
+		)
+	})
+
+	for _, ref := range refs {
+		line := ref.line
+		line.Quantity = formatQuantityWithUnit(line.Count, line.Type)
+		for i := range line.Filials {
+			line.Filials[i].Quantity = formatQuantityWithUnit(line.Filials[i].Count, line.Type)
+		}
+		slices.SortStableFunc(line.Filials, func(a, b ProductionFilialQty) int { return cmp.Compare(a.FilialID, b.FilialID) })
+
+		if len(plan.Printers) == 0 || plan.Printers[len(plan.Printers)-1].Printer != ref.printer {
+			plan.Printers = append(plan.Printers, ProductionPrinter{Printer: ref.printer, Categories: []ProductionCategory{}})
+		}
+		printer := &plan.Printers[len(plan.Printers)-1]
+		if len(printer.Categories) == 0 || printer.Categories[len(printer.Categories)-1].CategoryID != ref.category.ID {
+			printer.Categories = append(printer.Categories, ProductionCategory{
+				CategoryID: ref.category.ID,
+				Name:       ref.category.Name,
+				Lines:      []ProductionLine{},
+			})
+		}
+		lastCategory := &printer.Categories[len(printer.Categories)-1]
+		lastCategory.Lines = append(lastCategory.Lines, *line)
+	}
+	return plan
+}
+
+// CSV: har bir mahsulot qatori, jami va har bir filial uchun alohida ustun.
+// Excel kirill/lotin harflarini to'g'ri ochishi uchun UTF-8 BOM bilan.
+func ProductionPlanCSV(plan ProductionPlan) []byte {
+	var filialIDs []uint
+	filialNames := make(map[uint]string)
+	for _, printer := range plan.Printers {
+		for _, category := range printer.Categories {
+			for _, line := range category.Lines {
+				for _, f := range line.Filials {
+					if _, ok := filialNames[f.FilialID]; !ok {
+						filialIDs = append(filialIDs, f.FilialID)
+						filialNames[f.FilialID] = f.FilialName
+					}
+				}
+			}
+		}
+	}
+	slices.Sort(filialIDs)
+
+	var buf bytes.Buffer
+	buf.WriteString("\ufeff")
+	writer := csv.NewWriter(&buf)
+	header := []string{"printer", "category", "product", "variant", "unit", "total"}
+	for _, id := range filialIDs {
+		header = append(header, filialNames[id])
+	}
+	writer.Write(csvSafeRow(header))
+
+	for _, printer := range plan.Printers {
+		for _, category := range printer.Categories {
+			for _, line := range category.Lines {
+				row := []string{
+					fmt.Sprint(printer.Printer),
+					category.Name,
+					line.Name,
+					line.VariantName,
+					line.Type,
+					formatQuantity(line.Count, line.Type),
+				}
+				for _, id := range filialIDs {
+					value := ""
+					for _, f := range line.Filials {
+						if f.FilialID == id {
+							value = formatQuantity(f.Count, line.Type)
+						}
+					}
+					row = append(row, value)
+				}
+				writer.Write(csvSafeRow(row))
+			}
+		}
+	}
+	writer.Flush()
+	return buf.Bytes()
+}
+
+// Excel/LibreOffice =, +, - yoki @ bilan boshlangan katakni formula deb bajaradi
+// (mahsulot yoki filial nomi orqali formula kiritish mumkin) - bunday kataklar ' bilan boshlanadi
+func csvSafeRow(row []string) []string {
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			row[i] = "'" + cell
+		}
+	}
+	return row
+}
+
+// Rejani har bir printerga alohida chek qilib yuboradi; filiallar bo'yicha taqsimot item izohida.
+// Qaytaradi: chek yuborilmagan printerlar.
+func PrintProductionPlan(plan ProductionPlan, username string) []uint {
+	title := "PRODUCTION PLAN"
+	planID := "PLAN " + plan.Date
+	if len(plan.DeliverySlotIDs) > 0 {
+		var slots []string
+		for _, id := range plan.DeliverySlotIDs {
+			if slot := findDeliverySlotByID(id); slot != nil {
+				slots = append(slots, slot.label())
+			}
+		}
+		planID += " " + strings.Join(slots, ", ")
+	}
+
+	var failed []uint
+	for _, printer := range plan.Printers {
+		var items []PrinterItem
+		var categoryNames []string
+		for _, category := range printer.Categories {
+			categoryNames = append(categoryNames, category.Name)
+			for _, line := range category.Lines {
+				var breakdown []string
+				for _, f := range line.Filials {
+					breakdown = append(breakdown, fmt.Sprintf("%s: %s", f.FilialName, formatQuantity(f.Count, line.Type)))
+				}
+				items = append(items, PrinterItem{
+					Product:  line.Name,
+					Variant:  line.VariantName,
+					Count:    line.Count,
+					Type:     line.Type,
+					Quantity: line.Quantity,
+					Note:     strings.Join(breakdown, "; "),
+				})
+			}
+		}
+
+		printRequest := PrinterRequest{
+			Printer:  printer.Printer,
+			Title:    title,
+			OrderID:  planID,
+			Category: strings.Join(categoryNames, ", "),
+			Username: username,
+			Filial:   fmt.Sprintf("%d ta order", plan.OrderCount),
+			Items:    items,
+		}
+		if err := postPrintRequest(printRequest); err != nil {
+			log.Printf("❌ %v", err)
+			failed = append(failed, printer.Printer)
+			continue
+		}
+		log.Printf("✅ Ishlab chiqarish rejasi yuborildi: PrinterID %d - %s", printer.Printer, planID)
+	}
+	return failed
+}
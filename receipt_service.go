@@ -0,0 +1,250 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Filialda tovarni qabul qilish: xodim har bir qator bo'yicha qabul qilingan miqdorni
+// tasdiqlaydi, yetishmagan va shikastlangan miqdorlarni (ixtiyoriy rasm bilan) belgilaydi.
+// Farq bo'lsa adminlarga Telegram xabar yuboriladi.
+
+// Qabul qilish mumkin bo'lgan order statuslari (tovar qisman yoki to'liq jo'natilgan yoki yetkazilgan)
+var receivableStatuses = []string{"partially_shipped", "shipped", "delivered"}
+
+// Filialga jo'natilgan miqdor: qisman jo'natilgan yoki jo'natmalar qayd qilingan bo'lsa
+// jo'natilgani, aks holda kamomadsiz miqdor
+func sentCount(order *Order, item OrderItem) Decimal {
+	if order.Status == "partially_shipped" || len(order.Shipments) > 0 {
+		return item.Fulfilled
+	}
+	return expectedCount(item)
+}
+
+// Rasm faqat /api/upload orqali yuklangan fayl bo'lishi kerak
+func validateReceiptPhoto(url string) (string, error) {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(url, "/static/") || strings.Contains(url, "..") || strings.ContainsAny(url, "?#") {
+		return "", fmt.Errorf("rasm manzili noto'g'ri: %s", url)
+	}
+	return url, nil
+}
+
+// So'rovda ko'rsatilmagan qatorlar to'liq qabul qilingan hisoblanadi
+func ConfirmOrderReceipt(orderID uint, actor *User, req ReceiptRequest, ifMatch string) (*Order, error) {
+	note, err := sanitizeNote(req.Note, maxOrderCommentLength)
+	if err != nil {
+		return nil, err
+	}
+
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+
+	order := findOrderByID(orderID)
+	if order == nil {
+		return nil, fmt.Errorf("order topilmadi")
+	}
+	if err := checkVersion(ifMatch, entityETag("order", order.ID, order.Version), *order); err != nil {
+		return nil, err
+	}
+	if order.Receipt != nil {
+		return nil, fmt.Errorf("order qabul qilinishi allaqachon tasdiqlangan")
+	}
+	if !slices.Contains(receivableStatuses, order.Status) {
+		return nil, fmt.Errorf("order \"%s\" holatida, uni hali qabul qilib bo'lmaydi", order.Status)
+	}
+
+	lines := make(map[orderLineKey]ReceiptLineRequest)
+	for _, line := range req.Items {
+		key := lineKey(line.ProductID, line.VariantID)
+		if _, ok := lines[key]; ok {
+			return nil, fmt.Errorf("mahsulot ID %d bir necha marta kiritilgan", line.ProductID)
+		}
+		if !slices.ContainsFunc(order.Items, func(item OrderItem) bool {
+			return lineKey(item.ProductID, item.VariantID) == key
+		}) {
+			return nil, fmt.Errorf("mahsulot ID %d orderda yo'q", line.ProductID)
+		}
+		lines[key] = line
+	}
+
+	receipt := OrderReceipt{
+		Items:    []ReceiptItem{},
+		Note:     note,
+		UserID:   actor.ID,
+		Username: actor.Name,
+		Created:  time.Now(),
+	}
+	for _, item := range order.Items {
+		expected := sentCount(order, item)
+		received := ReceiptItem{
+			ProductID:   item.ProductID,
+			VariantID:   item.VariantID,
+			Name:        item.Name,
+			VariantName: item.VariantName,
+			Type:        item.Type,
+			Expected:    expected,
+			Received:    expected,
+		}
+
+		if line, ok := lines[lineKey(item.ProductID, item.VariantID)]; ok {
+			label := itemLabel(item.Name, item.VariantName)
+			if line.Received < 0 || line.Damaged < 0 {
+				return nil, fmt.Errorf("%s: miqdor manfiy bo'lishi mumkin emas", label)
+			}
+			precision := unitPrecision(item.Type)
+			if !line.Received.IsMultipleOf(precision) || !line.Damaged.IsMultipleOf(precision) {
+				return nil, fmt.Errorf("%s: miqdor %s birligiga mos emas", label, item.Type)
+			}
+			if line.Received.Add(line.Damaged) > expected {
+				return nil, fmt.Errorf("%s: qabul qilingan miqdor jo'natilgan %s dan ko'p", label, formatQuantityWithUnit(expected, item.Type))
+			}
+			lineNote, err := sanitizeNote(line.Note, maxItemNoteLength)
+			if err != nil {
+				return nil, err
+			}
+			photo, err := validateReceiptPhoto(line.PhotoURL)
+			if err != nil {
+				return nil, err
+			}
+			received.Received = line.Received
+			received.Damaged = line.Damaged
+			received.Missing = expected.Sub(line.Received).Sub(line.Damaged)
+			received.Note = lineNote
+			received.PhotoURL = photo
+		}
+
+		if received.Missing > 0 || received.Damaged > 0 {
+			receipt.HasDiscrepancy = true
+		}
+		receipt.Items = append(receipt.Items, received)
+	}
+
+	order.Receipt = &receipt
+	order.Updated = receipt.Created
+	order.Version++
+	saveOrders()
+
+	result := *order
+	if receipt.HasDiscrepancy {
+		go notifyReceiptDiscrepancy(result)
+	}
+	return &result, nil
+}
+
+// Farqlar hisoboti: qabul qilingan sana bo'yicha (filter.From/To), filial, mahsulot va h.k. filtrlari bilan
+func GetReceiptDiscrepancies(filter OrderFilter) ReceiptDiscrepancyReport {
+	report := ReceiptDiscrepancyReport{Lines: []ReceiptDiscrepancy{}, Totals: []ReceiptDiscrepancyTotal{}}
+
+	from, to := filter.From, filter.To
+	filter.From, filter.To = time.Time{}, time.Time{}
+
+	ordersMu.Lock()
+	for i := range orders {
+		o := &orders[i]
+		if o.Receipt == nil || !o.Receipt.HasDiscrepancy || !orderMatchesFilter(*o, filter) {
+			continue
+		}
+		if !from.IsZero() && o.Receipt.Created.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !o.Receipt.Created.Before(to) {
+			continue
+		}
+
+		counted := false
+		for _, item := range o.Receipt.Items {
+			if item.Missing <= 0 && item.Damaged <= 0 {
+				continue
+			}
+			if !orderItemMatchesFilter(OrderItem{ProductID: item.ProductID}, filter) {
+				continue
+			}
+			counted = true
+			report.Lines = append(report.Lines, ReceiptDiscrepancy{
+				ID:          o.ID,
+				OrderID:     o.OrderID,
+				FilialID:    o.FilialID,
+				FilialName:  o.FilialName,
+				ReceivedAt:  o.Receipt.Created,
+				ReceivedBy:  o.Receipt.Username,
+				ReceiptItem: item,
+			})
+
+			idx := slices.IndexFunc(report.Totals, func(t ReceiptDiscrepancyTotal) bool {
+				return lineKey(t.ProductID, t.VariantID) == lineKey(item.ProductID, item.VariantID)
+			})
+			if idx < 0 {
+				idx = len(report.Totals)
+				report.Totals = append(report.Totals, ReceiptDiscrepancyTotal{
+					ProductID:   item.ProductID,
+					VariantID:   item.VariantID,
+					Name:        item.Name,
+					VariantName: item.VariantName,
+					Type:        item.Type,
+				})
+			}
+			report.Totals[idx].Missing = report.Totals[idx].Missing.Add(item.Missing)
+			report.Totals[idx].Damaged = report.Totals[idx].Damaged.Add(item.Damaged)
+		}
+		if counted {
+			report.OrderCount++
+		}
+	}
+	ordersMu.Unlock()
+
+	// Eng yangi qabul birinchi; jami - mahsulot nomi bo'yicha
+	slices.SortStableFunc(report.Lines, func(a, b ReceiptDiscrepancy) int {
+		return cmp.Or(b.ReceivedAt.Compare(a.ReceivedAt), cmp.Compare(a.ID, b.ID))
+	})
+	slices.SortStableFunc(report.Totals, func(a, b ReceiptDiscrepancyTotal) int {
+		return cmp.Or(compareFold(a.Name, b.Name), compareFold(a.VariantName, b.VariantName))
+	})
+	return report
+}
+
+func notifyReceiptDiscrepancy(order Order) {
+	receipt := order.Receipt
+
+	var text strings.Builder
+	text.WriteString("📦 *РАСХОЖДЕНИЕ ПРИ ПРИЁМКЕ*\n\n")
+	text.WriteString(fmt.Sprintf("📋 *Заказ:* `%s`\n", order.OrderID))
+	text.WriteString(fmt.Sprintf("🏢 *Ветвь:* %s\n", order.FilialName))
+	text.WriteString(fmt.Sprintf("👤 *Принял:* %s\n", escapeMarkdown(receipt.Username)))
+	for _, item := range receipt.Items {
+		if item.Missing <= 0 && item.Damaged <= 0 {
+			continue
+		}
+		text.WriteString(fmt.Sprintf("\n🔸 *%s* — получено %s из %s\n",
+			escapeMarkdown(itemLabel(item.Name, item.VariantName)),
+			formatQuantityWithUnit(item.Received, item.Type),
+			formatQuantityWithUnit(item.Expected, item.Type)))
+		if item.Missing > 0 {
+			text.WriteString(fmt.Sprintf("   ❌ Не хватает: %s\n", formatQuantityWithUnit(item.Missing, item.Type)))
+		}
+		if item.Damaged > 0 {
+			text.WriteString(fmt.Sprintf("   💥 Повреждено: %s\n", formatQuantityWithUnit(item.Damaged, item.Type)))
+		}
+		if item.Note != "" {
+			text.WriteString(fmt.Sprintf("   📝 %s\n", escapeMarkdown(item.Note)))
+		}
+		if item.PhotoURL != "" {
+			text.WriteString(fmt.Sprintf("   📷 %s\n", escapeMarkdown(item.PhotoURL)))
+		}
+	}
+	if receipt.Note != "" {
+		text.WriteString(fmt.Sprintf("\n💬 *Комментарий:* %s\n", escapeMarkdown(receipt.Note)))
+	}
+
+	log.Printf("📦 Qabulda farq: %s (%s)", order.OrderID, order.FilialName)
+	if err := sendTelegramText(text.String()); err != nil {
+		log.Printf("Telegram ga yuborishda xato: %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Telegram o'rniga soxta server: yuborilgan xabarlar kanalga tushadi
+func captureTelegram(t *testing.T) chan string {
+	messages := make(chan string, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg TelegramMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		messages <- msg.Text
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	old := telegramSendMessageURL
+	telegramSendMessageURL = server.URL
+	t.Cleanup(func() {
+		server.Close()
+		telegramSendMessageURL = old
+	})
+	return messages
+}
+
+func waitTelegram(t *testing.T, messages chan string) string {
+	t.Helper()
+	select {
+	case text := <-messages:
+		return text
+	case <-time.After(5 * time.Second):
+		t.Fatal("Telegram xabari yuborilmadi")
+		return ""
+	}
+}
+
+var receiptTestStaff = &User{ID: 1, Name: "qabul_qiluvchi"}
+
+// 1-filial orderi: Non 5 dona, Sut 2 dona, ikkalasi to'liq jo'natilgan
+func createShippedOrder(t *testing.T) *Order {
+	t.Helper()
+	order, err := CreateOrder(1, CreateOrderRequest{
+		Items: []CreateOrderItem{
+			{ProductID: 1, Count: NewDecimal(5)},
+			{ProductID: 2, Count: NewDecimal(2)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shipped, _, err := RecordShipment(order.ID, stockTestAdmin, ShipmentRequest{ShipRemaining: true}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return shipped
+}
+
+func setupReceiptTestData(t *testing.T) chan string {
+	setupOrderTestData(t, "{date}-{seq}")
+	products = []Product{
+		{ID: 1, Name: "Non", Type: "dona", Filials: []uint{1, 2}},
+		{ID: 2, Name: "Sut", Type: "dona", Filials: []uint{1, 2}},
+	}
+	return captureTelegram(t)
+}
+
+func receiptItem(t *testing.T, receipt *OrderReceipt, productID uint) ReceiptItem {
+	t.Helper()
+	for _, item := range receipt.Items {
+		if item.ProductID == productID {
+			return item
+		}
+	}
+	t.Fatalf("qabulda mahsulot ID %d yo'q", productID)
+	return ReceiptItem{}
+}
+
+func TestConfirmOrderReceipt(t *testing.T) {
+	type line struct {
+		productID                   uint
+		expected, received, damaged int64
+		missing                     int64
+	}
+	tests := []struct {
+		name        string
+		req         ReceiptRequest
+		wantErr     string
+		discrepancy bool
+		lines       []line
+	}{
+		{
+			name: "ko'rsatilmagan qatorlar to'liq qabul qilinadi",
+			req:  ReceiptRequest{},
+			lines: []line{
+				{productID: 1, expected: 5, received: 5},
+				{productID: 2, expected: 2, received: 2},
+			},
+		},
+		{
+			name: "qisman qabul va shikastlangan",
+			req: ReceiptRequest{Items: []ReceiptLineRequest{
+				{ProductID: 1, Received: NewDecimal(3), Damaged: NewDecimal(1), Note: "ezilgan"},
+			}},
+			discrepancy: true,
+			lines: []line{
+				{productID: 1, expected: 5, received: 3, damaged: 1, missing: 1},
+				{productID: 2, expected: 2, received: 2},
+			},
+		},
+		{
+			name: "hammasi yetishmagan",
+			req: ReceiptRequest{Items: []ReceiptLineRequest{
+				{ProductID: 2},
+			}},
+			discrepancy: true,
+			lines: []line{
+				{productID: 1, expected: 5, received: 5},
+				{productID: 2, expected: 2, missing: 2},
+			},
+		},
+		{
+			name: "jo'natilgandan ko'p",
+			req: ReceiptRequest{Items: []ReceiptLineRequest{
+				{ProductID: 1, Received: NewDecimal(5), Damaged: NewDecimal(1)},
+			}},
+			wantErr: "jo'natilgan",
+		},
+		{
+			name: "manfiy miqdor",
+			req: ReceiptRequest{Items: []ReceiptLineRequest{
+				{ProductID: 1, Received: NewDecimal(-1)},
+			}},
+			wantErr: "manfiy",
+		},
+		{
+			name: "birlikka mos emas",
+			req: ReceiptRequest{Items: []ReceiptLineRequest{
+				{ProductID: 1, Received: 2500},
+			}},
+			wantErr: "birligiga",
+		},
+		{
+			name: "orderda yo'q mahsulot",
+			req: ReceiptRequest{Items: []ReceiptLineRequest{
+				{ProductID: 9, Received: NewDecimal(1)},
+			}},
+			wantErr: "orderda yo'q",
+		},
+		{
+			name: "takroriy qator",
+			req: ReceiptRequest{Items: []ReceiptLineRequest{
+				{ProductID: 1, Received: NewDecimal(1)},
+				{ProductID: 1, Received: NewDecimal(1)},
+			}},
+			wantErr: "bir necha marta",
+		},
+		{
+			name: "rasm faqat yuklangan fayl",
+			req: ReceiptRequest{Items: []ReceiptLineRequest{
+				{ProductID: 1, Received: NewDecimal(4), PhotoURL: "http://example.com/a.jpg"},
+			}},
+			wantErr: "rasm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := setupReceiptTestData(t)
+			order := createShippedOrder(t)
+
+			result, err := ConfirmOrderReceipt(order.ID, receiptTestStaff, tt.req, "")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("xato %v, kutilgan %q", err, tt.wantErr)
+				}
+				if GetOrderByID(order.ID).Receipt != nil {
+					t.Fatal("xatoli qabul saqlandi")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			receipt := result.Receipt
+			if receipt.HasDiscrepancy != tt.discrepancy {
+				t.Fatalf("has_discrepancy = %v, kutilgan %v", receipt.HasDiscrepancy, tt.discrepancy)
+			}
+			for _, want := range tt.lines {
+				got := receiptItem(t, receipt, want.productID)
+				if got.Expected != NewDecimal(want.expected) || got.Received != NewDecimal(want.received) ||
+					got.Damaged != NewDecimal(want.damaged) || got.Missing != NewDecimal(want.missing) {
+					t.Fatalf("mahsulot %d: %+v, kutilgan %+v", want.productID, got, want)
+				}
+			}
+			if tt.discrepancy {
+				if text := waitTelegram(t, messages); !strings.Contains(text, `qabul\_qiluvchi`) {
+					t.Fatalf("ogohlantirish matni: %s", text)
+				}
+			}
+
+			// Qabul faqat bir marta tasdiqlanadi
+			if _, err := ConfirmOrderReceipt(order.ID, receiptTestStaff, ReceiptRequest{}, ""); err == nil {
+				t.Fatal("qabul ikkinchi marta tasdiqlandi")
+			}
+		})
+	}
+}
+
+// Kamomad bilan yopilgan qatorda faqat jo'natilgan miqdor kutiladi
+func TestConfirmOrderReceiptAfterShortShipment(t *testing.T) {
+	setupReceiptTestData(t)
+	order, err := CreateOrder(1, CreateOrderRequest{
+		Items: []CreateOrderItem{{ProductID: 1, Count: NewDecimal(5)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hali jo'natilmagan order qabul qilinmaydi
+	if _, err := ConfirmOrderReceipt(order.ID, receiptTestStaff, ReceiptRequest{}, ""); err == nil {
+		t.Fatal("jo'natilmagan order qabul qilindi")
+	}
+
+	if _, _, err := RecordShipment(order.ID, stockTestAdmin, ShipmentRequest{
+		Items: []ShipmentLineRequest{{ProductID: 1, Count: NewDecimal(4), Short: true, Reason: "yetmadi"}},
+	}, ""); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ConfirmOrderReceipt(order.ID, receiptTestStaff, ReceiptRequest{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := receiptItem(t, result.Receipt, 1); got.Expected != NewDecimal(4) || got.Missing != 0 || result.Receipt.HasDiscrepancy {
+		t.Fatalf("kamomaddan keyingi qabul: %+v", got)
+	}
+}
+
+func TestGetReceiptDiscrepanciesDateFilter(t *testing.T) {
+	messages := setupReceiptTestData(t)
+
+	day := time.Date(2026, 10, 1, 12, 0, 0, 0, businessLocation)
+	var ids []uint
+	for i := 0; i < 3; i++ {
+		order := createShippedOrder(t)
+		if _, err := ConfirmOrderReceipt(order.ID, receiptTestStaff, ReceiptRequest{Items: []ReceiptLineRequest{
+			{ProductID: 1, Received: NewDecimal(4)},
+		}}, ""); err != nil {
+			t.Fatal(err)
+		}
+		waitTelegram(t, messages)
+		// Qabul sanalari: 1, 2 va 3-oktyabr
+		GetOrderByID(order.ID).Receipt.Created = day.AddDate(0, 0, i)
+		ids = append(ids, order.ID)
+	}
+	// Farqsiz qabul hisobotga tushmaydi
+	clean := createShippedOrder(t)
+	if _, err := ConfirmOrderReceipt(clean.ID, receiptTestStaff, ReceiptRequest{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	GetOrderByID(clean.ID).Receipt.Created = day.AddDate(0, 0, 1)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []uint
+	}{
+		{name: "filtrsiz", want: []uint{ids[2], ids[1], ids[0]}},
+		{name: "from", from: day.AddDate(0, 0, 1), want: []uint{ids[2], ids[1]}},
+		{name: "to (kirmaydi)", to: day.AddDate(0, 0, 1), want: []uint{ids[0]}},
+		{name: "from va to", from: day.AddDate(0, 0, 1).Add(-time.Hour), to: day.AddDate(0, 0, 2), want: []uint{ids[1]}},
+		{name: "bo'sh oraliq", from: day.AddDate(0, 0, 5), want: []uint{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := GetReceiptDiscrepancies(OrderFilter{From: tt.from, To: tt.to})
+			var got []uint
+			for _, line := range report.Lines {
+				got = append(got, line.ID)
+			}
+			if len(got) != len(tt.want) || report.OrderCount != len(tt.want) {
+				t.Fatalf("qatorlar %v (orderlar %d), kutilgan %v", got, report.OrderCount, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("qatorlar %v, kutilgan %v", got, tt.want)
+				}
+			}
+			if len(tt.want) > 0 {
+				if len(report.Totals) != 1 || report.Totals[0].Missing != NewDecimal(int64(len(tt.want))) {
+					t.Fatalf("jami: %+v", report.Totals)
+				}
+			}
+		})
+	}
+
+	// Mahsulot filtri: farq faqat Non da
+	if report := GetReceiptDiscrepancies(OrderFilter{ProductIDs: []uint{2}}); len(report.Lines) != 0 {
+		t.Fatalf("Sut bo'yicha farq topildi: %+v", report.Lines)
+	}
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Yetkazib berish marshrutlari: markaziy oshxonadan filiallarga mashina yo'nalishlari.
+// Har bir filial ko'pi bilan bitta marshrutda bo'ladi.
+var (
+	deliveryRoutes      []DeliveryRoute
+	nextDeliveryRouteID uint = 1
+)
+
+const deliveryRoutesFile = "data/delivery_routes.json"
+
+func loadDeliveryRoutes() {
+	if data, err := ioutil.ReadFile(deliveryRoutesFile); err == nil {
+		json.Unmarshal(data, &deliveryRoutes)
+		for _, r := range deliveryRoutes {
+			if r.ID >= nextDeliveryRouteID {
+				nextDeliveryRouteID = r.ID + 1
+			}
+		}
+	}
+}
+
+func saveDeliveryRoutes() {
+	data, _ := json.MarshalIndent(deliveryRoutes, "", "  ")
+	ioutil.WriteFile(deliveryRoutesFile, data, 0644)
+}
+
+func findDeliveryRouteByID(id uint) *DeliveryRoute {
+	for i, r := range deliveryRoutes {
+		if r.ID == id {
+			return &deliveryRoutes[i]
+		}
+	}
+	return nil
+}
+
+// Filial qaysi marshrutda
+func routeForFilial(filialID uint) *DeliveryRoute {
+	for i, r := range deliveryRoutes {
+		if slices.Contains(r.FilialIDs, filialID) {
+			return &deliveryRoutes[i]
+		}
+	}
+	return nil
+}
+
+func validateDeliveryRoute(id uint, req DeliveryRouteRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("marshrut nomi majburiy")
+	}
+	if len(req.FilialIDs) == 0 {
+		return fmt.Errorf("marshrutda kamida bitta filial bo'lishi kerak")
+	}
+	seen := make(map[uint]bool)
+	for _, filialID := range req.FilialIDs {
+		filial := findFilialByID(filialID)
+		if filial == nil {
+			return fmt.Errorf("filial topilmadi: ID %d", filialID)
+		}
+		if seen[filialID] {
+			return fmt.Errorf("filial %s bir necha marta kiritilgan", filial.Name)
+		}
+		seen[filialID] = true
+		if other := routeForFilial(filialID); other != nil && other.ID != id {
+			return fmt.Errorf("filial %s allaqachon %s marshrutida", filial.Name, other.Name)
+		}
+	}
+	if req.DriverID != 0 {
+		if driver := findUserByID(req.DriverID); driver == nil || !driver.IsDriver {
+			return fmt.Errorf("haydovchi topilmadi: ID %d", req.DriverID)
+		}
+	}
+	return nil
+}
+
+// ============= CRUD =============
+func CreateDeliveryRoute(req DeliveryRouteRequest) (*DeliveryRoute, error) {
+	if err := validateDeliveryRoute(0, req); err != nil {
+		return nil, err
+	}
+
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	route := DeliveryRoute{
+		ID:        nextDeliveryRouteID,
+		Name:      strings.TrimSpace(req.Name),
+		FilialIDs: req.FilialIDs,
+		DriverID:  req.DriverID,
+		Vehicle:   strings.TrimSpace(req.Vehicle),
+		Version:   1,
+	}
+	deliveryRoutes = append(deliveryRoutes, route)
+	nextDeliveryRouteID++
+	saveDeliveryRoutes()
+	return &route, nil
+}
+
+func GetAllDeliveryRoutes() []DeliveryRoute {
+	return deliveryRoutes
+}
+
+func GetDeliveryRouteByID(id uint) *DeliveryRoute {
+	return findDeliveryRouteByID(id)
+}
+
+func UpdateDeliveryRoute(id uint, req DeliveryRouteRequest, ifMatch string) (*DeliveryRoute, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	route := findDeliveryRouteByID(id)
+	if route == nil {
+		return nil, nil
+	}
+	if err := checkVersion(ifMatch, entityETag("delivery-route", route.ID, route.Version), *route); err != nil {
+		return nil, err
+	}
+	if err := validateDeliveryRoute(id, req); err != nil {
+		return nil, err
+	}
+	route.Name = strings.TrimSpace(req.Name)
+	route.FilialIDs = req.FilialIDs
+	route.DriverID = req.DriverID
+	route.Vehicle = strings.TrimSpace(req.Vehicle)
+	route.Version++
+	saveDeliveryRoutes()
+
+	result := *route
+	return &result, nil
+}
+
+// Marshrut o'chirilsa hali yetkazilmagan orderlar marshrutdan chiqariladi
+func DeleteDeliveryRoute(id uint, ifMatch string) (bool, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	index := slices.IndexFunc(deliveryRoutes, func(r DeliveryRoute) bool { return r.ID == id })
+	if index < 0 {
+		return false, nil
+	}
+	route := deliveryRoutes[index]
+	if err := checkVersion(ifMatch, entityETag("delivery-route", route.ID, route.Version), route); err != nil {
+		return false, err
+	}
+	deliveryRoutes = slices.Delete(deliveryRoutes, index, index+1)
+	saveDeliveryRoutes()
+
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+	changed := false
+	for i := range orders {
+		o := &orders[i]
+		if o.RouteID == id && o.Status != "delivered" {
+			o.RouteID = 0
+			o.DriverID = 0
+			o.Version++
+			changed = true
+		}
+	}
+	if changed {
+		saveOrders()
+	}
+	return true, nil
+}
+
+// ============= ASSIGNMENT =============
+
+// Orderlarni sana bo'yicha marshrut va haydovchiga biriktiradi. OrderIDs bo'sh bo'lsa -
+// marshrut filiallarining shu kunga yetkaziladigan barcha faol orderlari.
+func AssignRouteOrders(routeID uint, req RouteAssignRequest) (*RouteManifest, error) {
+	route := findDeliveryRouteByID(routeID)
+	if route == nil {
+		return nil, fmt.Errorf("marshrut topilmadi")
+	}
+	if _, err := time.ParseInLocation("2006-01-02", req.Date, businessLocation); err != nil {
+		return nil, fmt.Errorf("noto'g'ri date formati (YYYY-MM-DD): %s", req.Date)
+	}
+	driverID := req.DriverID
+	if driverID == 0 {
+		driverID = route.DriverID
+	}
+	if driverID == 0 {
+		return nil, fmt.Errorf("haydovchi (driver_id) tanlanishi kerak")
+	}
+	if driver := findUserByID(driverID); driver == nil || !driver.IsDriver {
+		return nil, fmt.Errorf("haydovchi topilmadi: ID %d", driverID)
+	}
+
+	ordersMu.Lock()
+	var targets []*Order
+	// Sanasiz orderlarga sana va slot darhol yoziladi - shu so'rovdagi keyingi orderlar
+	// slot sig'imini hisoblaganda ularni ham ko'radi. Xato bo'lsa asli qaytariladi.
+	undated := make(map[*Order]Order)
+	fail := func(err error) (*RouteManifest, error) {
+		for o, original := range undated {
+			*o = original
+		}
+		ordersMu.Unlock()
+		return nil, err
+	}
+	if len(req.OrderIDs) == 0 {
+		for _, o := range ordersForFilials(route.FilialIDs) {
+			if o.DeliveryDate == req.Date && routeAssignable(o) {
+				targets = append(targets, o)
+			}
+		}
+	} else {
+		for _, id := range req.OrderIDs {
+			o := findOrderByID(id)
+			if o == nil {
+				return fail(fmt.Errorf("order topilmadi: ID %d", id))
+			}
+			if !slices.Contains(route.FilialIDs, o.FilialID) {
+				return fail(fmt.Errorf("order %s filiali (%s) marshrutda yo'q", o.OrderID, o.FilialName))
+			}
+			if !routeAssignable(o) {
+				return fail(fmt.Errorf("order %s \"%s\" holatida, marshrutga biriktirib bo'lmaydi", o.OrderID, o.Status))
+			}
+			// Bir order ikki marta berilsa slotda ikki joy egallamasin
+			if slices.Contains(targets, o) {
+				continue
+			}
+			if o.DeliveryDate != "" && o.DeliveryDate != req.Date {
+				return fail(fmt.Errorf("order %s yetkazib berish sanasi %s", o.OrderID, o.DeliveryDate))
+			}
+			if o.DeliveryDate == "" {
+				slot, err := validateRouteDeliveryDate(o, req.Date, req.DeliverySlotID)
+				if err != nil {
+					return fail(fmt.Errorf("order %s: %w", o.OrderID, err))
+				}
+				undated[o] = *o
+				o.DeliveryDate = req.Date
+				if slot != nil {
+					o.DeliverySlotID = slot.ID
+					o.DeliverySlot = slot.displayName()
+				}
+			}
+			targets = append(targets, o)
+		}
+	}
+	if len(targets) == 0 {
+		return fail(fmt.Errorf("%s sanasi uchun biriktiriladigan order yo'q", req.Date))
+	}
+
+	now := time.Now()
+	for _, o := range targets {
+		o.DeliveryDate = req.Date
+		o.RouteID = route.ID
+		o.DriverID = driverID
+		o.Updated = now
+		o.Version++
+	}
+	saveOrders()
+	ordersMu.Unlock()
+
+	manifest := BuildRouteManifest(route, req.Date, 0)
+	return &manifest, nil
+}
+
+// Bekor qilingan va yetkazilgan orderlar marshrutga biriktirilmaydi
+func routeAssignable(o *Order) bool {
+	return o.Status != "cancelled" && o.Status != "delivered"
+}
+
+// Sanasiz orderga beriladigan sana (va so'rovdagi slot) tekshiruvi (ordersMu ostida chaqiriladi).
+// Slot ixtiyoriy: slotlar paydo bo'lishidan oldin yaratilgan orderlar ham biriktirilishi kerak.
+func validateRouteDeliveryDate(o *Order, date string, slotID uint) (*DeliverySlot, error) {
+	if slotID == 0 {
+		_, _, err := validateDeliveryDate(date, time.Now())
+		return nil, err
+	}
+	slot, err := validateDelivery(date, slotID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSlotCapacity(slot, date, o.FilialID); err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// Faqat tayyor yoki jo'natilgan (qisman ham) orderni yetkazildi deb belgilash mumkin.
+// Qisman jo'natilgan orderda filialga faqat jo'natilgan miqdor yetadi.
+var deliverableStatuses = []string{"ready", "partially_shipped", "shipped"}
+
+// ============= MANIFEST =============
+
+// Marshrut bo'yicha yuk xati: to'xtash joylari marshrut tartibida, har birida orderlar va
+// mahsulotlarning jami miqdori. driverID > 0 bo'lsa faqat shu haydovchi orderlari.
+func BuildRouteManifest(route *DeliveryRoute, date string, driverID uint) RouteManifest {
+	manifest := RouteManifest{
+		RouteID:   route.ID,
+		RouteName: route.Name,
+		Vehicle:   route.Vehicle,
+		Date:      date,
+		Stops:     []ManifestStop{},
+		Totals:    []ManifestItem{},
+	}
+
+	ordersMu.Lock()
+	var routeOrders []Order
+	for _, o := range orders {
+		if o.RouteID == route.ID && o.DeliveryDate == date && o.Status != "cancelled" && (driverID == 0 || o.DriverID == driverID) {
+			routeOrders = append(routeOrders, o)
+		}
+	}
+	ordersMu.Unlock()
+
+	var driverNames []string
+	for position, filialID := range route.FilialIDs {
+		stop := ManifestStop{
+			Position: position + 1,
+			FilialID: filialID,
+			Orders:   []ManifestOrder{},
+			Items:    []ManifestItem{},
+		}
+		if filial := findFilialByID(filialID); filial != nil {
+			stop.FilialName = filial.Name
+			stop.Location = filial.Location
+		}
+
+		delivered := 0
+		for _, o := range routeOrders {
+			if o.FilialID != filialID {
+				continue
+			}
+			stop.Orders = append(stop.Orders, ManifestOrder{
+				ID:           o.ID,
+				OrderID:      o.OrderID,
+				Status:       o.Status,
+				DeliverySlot: o.DeliverySlot,
+				Comment:      o.Comment,
+				DeliveredAt:  o.DeliveredAt,
+			})
+			stop.Items = addManifestItems(stop.Items, &o)
+			manifest.Totals = addManifestItems(manifest.Totals, &o)
+			if o.Status == "delivered" {
+				delivered++
+				if stop.DeliveredAt == nil || o.DeliveredAt.After(*stop.DeliveredAt) {
+					stop.DeliveredAt = o.DeliveredAt
+				}
+			}
+			if driver := findUserByID(o.DriverID); driver != nil && !slices.Contains(driverNames, driver.Name) {
+				driverNames = append(driverNames, driver.Name)
+			}
+		}
+		if len(stop.Orders) == 0 {
+			continue
+		}
+		stop.Delivered = delivered == len(stop.Orders)
+		if !stop.Delivered {
+			stop.DeliveredAt = nil
+		}
+		manifest.OrderCount += len(stop.Orders)
+		manifest.Stops = append(manifest.Stops, stop)
+	}
+	manifest.Driver = strings.Join(driverNames, ", ")
+	return manifest
+}
+
+// Mahsulot + variant bo'yicha miqdorlarni qo'shadi, qator izohlari yig'iladi.
+// Jo'natma qayd qilingan orderda mashinada faqat jo'natilgan miqdor bo'ladi.
+func addManifestItems(rows []ManifestItem, order *Order) []ManifestItem {
+	for _, item := range order.Items {
+		count := sentCount(order, item)
+		if count <= 0 {
+			continue // to'liq kamomad yoki hali jo'natilmagan
+		}
+		idx := slices.IndexFunc(rows, func(row ManifestItem) bool {
+			return lineKey(row.ProductID, row.VariantID) == lineKey(item.ProductID, item.VariantID)
+		})
+		if idx < 0 {
+			idx = len(rows)
+			rows = append(rows, ManifestItem{
+				ProductID:   item.ProductID,
+				VariantID:   item.VariantID,
+				Name:        item.Name,
+				VariantName: item.VariantName,
+				Type:        item.Type,
+			})
+		}
+		rows[idx].Count = rows[idx].Count.Add(count)
+		rows[idx].Quantity = formatQuantityWithUnit(rows[idx].Count, rows[idx].Type)
+		if item.Note != "" {
+			rows[idx].Notes = append(rows[idx].Notes, item.Note)
+		}
+	}
+	slices.SortStableFunc(rows, func(a, b ManifestItem) int {
+		return cmp.Or(compareFold(a.Name, b.Name), compareFold(a.VariantName, b.VariantName))
+	})
+	return rows
+}
+
+// Haydovchining shu kundagi marshrutlari
+func GetDriverManifests(driverID uint, date string) []RouteManifest {
+	routeIDs := []uint{}
+	ordersMu.Lock()
+	for _, o := range orders {
+		if o.DriverID == driverID && o.DeliveryDate == date && o.RouteID != 0 && !slices.Contains(routeIDs, o.RouteID) {
+			routeIDs = append(routeIDs, o.RouteID)
+		}
+	}
+	ordersMu.Unlock()
+
+	manifests := []RouteManifest{}
+	for _, routeID := range routeIDs {
+		if route := findDeliveryRouteByID(routeID); route != nil {
+			manifests = append(manifests, BuildRouteManifest(route, date, driverID))
+		}
+	}
+	return manifests
+}
+
+// To'xtash joyidagi (filial) orderlarni yetkazildi deb belgilaydi. Haydovchi faqat o'ziga
+// biriktirilgan orderlarni, admin esa marshrutdagi barcha orderlarni belgilaydi.
+func MarkStopDelivered(routeID, filialID uint, date string, actor *User) (*ManifestStop, error) {
+	route := findDeliveryRouteByID(routeID)
+	if route == nil {
+		return nil, fmt.Errorf("marshrut topilmadi")
+	}
+	if !slices.Contains(route.FilialIDs, filialID) {
+		return nil, fmt.Errorf("filial marshrutda yo'q")
+	}
+
+	ordersMu.Lock()
+	var pending []*Order
+	found := false
+	for _, o := range ordersForFilials([]uint{filialID}) {
+		if o.RouteID != routeID || o.DeliveryDate != date || o.Status == "cancelled" {
+			continue
+		}
+		if !actor.IsAdmin && o.DriverID != actor.ID {
+			continue
+		}
+		found = true
+		if o.Status == "delivered" {
+			continue
+		}
+		// Hali tayyor bo'lmagan order bo'lsa to'xtash joyi butunlay belgilanmaydi
+		if !slices.Contains(deliverableStatuses, o.Status) {
+			ordersMu.Unlock()
+			return nil, fmt.Errorf("order %s \"%s\" holatida, hali jo'natilmagan", o.OrderID, o.Status)
+		}
+		pending = append(pending, o)
+	}
+
+	now := time.Now()
+	var marked []*Order
+	for _, o := range pending {
+		o.Status = "delivered"
+		o.DeliveredAt = &now
+		o.DeliveredBy = actor.ID
+		o.Updated = now
+		o.Version++
+		marked = append(marked, o)
+	}
+	if !found {
+		ordersMu.Unlock()
+		return nil, fmt.Errorf("bu to'xtash joyida sizga biriktirilgan order yo'q")
+	}
+	if len(marked) > 0 {
+		saveOrders()
+		for _, o := range marked {
+			syncOrderStock(o)
+		}
+	}
+	ordersMu.Unlock()
+
+	driverID := actor.ID
+	if actor.IsAdmin {
+		driverID = 0
+	}
+	manifest := BuildRouteManifest(route, date, driverID)
+	for i, stop := range manifest.Stops {
+		if stop.FilialID == filialID {
+			return &manifest.Stops[i], nil
+		}
+	}
+	return nil, fmt.Errorf("to'xtash joyi topilmadi")
+}
+
+// Query dagi sana (YYYY-MM-DD); bo'sh bo'lsa bugungi sana
+func deliveryDateOrToday(value string) (string, error) {
+	if value == "" {
+		return time.Now().In(businessLocation).Format("2006-01-02"), nil
+	}
+	if _, err := time.ParseInLocation("2006-01-02", value, businessLocation); err != nil {
+		return "", fmt.Errorf("noto'g'ri date formati (YYYY-MM-DD): %s", value)
+	}
+	return value, nil
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -33,6 +36,158 @@ func healthCheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ================= LIST PARAMS =================
+
+const maxPageLimit = 200
+
+// Query: ?page=1&limit=20&sort=created&order=desc&q=...
+// limit berilmasa ro'yxat to'liq qaytadi (eski clientlar uchun)
+func parseListParams(r *http.Request, defaultSort string, defaultDesc bool) (ListParams, error) {
+	query := r.URL.Query()
+	params := ListParams{
+		Page:   1,
+		Sort:   defaultSort,
+		Desc:   defaultDesc,
+		Search: strings.TrimSpace(query.Get("q")),
+	}
+
+	if pageStr := query.Get("page"); pageStr != "" {
+		page, err := strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			return params, fmt.Errorf("page musbat son bo'lishi kerak")
+		}
+		params.Page = page
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return params, fmt.Errorf("limit 1 dan %d gacha bo'lishi kerak", maxPageLimit)
+		}
+		params.Limit = limit
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		params.Sort = sort
+	}
+
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		params.Desc = false
+	case "desc":
+		params.Desc = true
+	default:
+		return params, fmt.Errorf("order faqat asc yoki desc bo'lishi mumkin")
+	}
+
+	return params, nil
+}
+
+// ================= ORDER FILTER =================
+
+// Query: ?filial_id=1,2&user_id=5&product_id=3&category_id=2&printer=1
+//
+//	&status=pending,confirmed&from=2025-01-01&to=2025-01-31
+//
+// Sanalar biznes kun bo'yicha (businessLocation + cutoff soat); "to" kuni ham kiradi.
+// RFC3339 ham qabul qilinadi.
+func parseOrderFilter(r *http.Request) (OrderFilter, error) {
+	query := r.URL.Query()
+	var filter OrderFilter
+	var err error
+
+	if filter.FilialIDs, err = parseUintList(query["filial_id"], "filial_id"); err != nil {
+		return filter, err
+	}
+	if filter.UserIDs, err = parseUintList(query["user_id"], "user_id"); err != nil {
+		return filter, err
+	}
+	if filter.ProductIDs, err = parseUintList(query["product_id"], "product_id"); err != nil {
+		return filter, err
+	}
+	if filter.CategoryIDs, err = parseUintList(query["category_id"], "category_id"); err != nil {
+		return filter, err
+	}
+	if filter.CategoryItemIDs, err = parseUintList(query["category_item_id"], "category_item_id"); err != nil {
+		return filter, err
+	}
+	if filter.Printers, err = parseUintList(query["printer"], "printer"); err != nil {
+		return filter, err
+	}
+	filter.Statuses = splitListValues(query["status"])
+	if filter.DeliverySlotIDs, err = parseUintList(query["delivery_slot_id"], "delivery_slot_id"); err != nil {
+		return filter, err
+	}
+	filter.DeliveryDates = splitListValues(query["delivery_date"])
+
+	// Eski "date" parametri - bitta kun
+	if date := query.Get("date"); date != "" {
+		day, err := time.ParseInLocation("2006-01-02", date, businessLocation)
+		if err != nil {
+			return filter, fmt.Errorf("noto'g'ri date formati (YYYY-MM-DD): %s", date)
+		}
+		filter.From = businessDayStart(day)
+		filter.To = businessDayStart(day.AddDate(0, 0, 1))
+	}
+
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = parseFilterTime(from, false); err != nil {
+			return filter, err
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = parseFilterTime(to, true); err != nil {
+			return filter, err
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("from sanasi to sanasidan oldin bo'lishi kerak")
+	}
+
+	return filter, nil
+}
+
+// "1,2" va takrorlangan parametrlarni (?status=a&status=b) bitta ro'yxatga yig'adi
+func splitListValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+func parseUintList(values []string, name string) ([]uint, error) {
+	var ids []uint
+	for _, part := range splitListValues(values) {
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("noto'g'ri %s: %s", name, part)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// YYYY-MM-DD (biznes kun) yoki RFC3339. endOfDay bo'lsa kunning oxirigacha oladi.
+func parseFilterTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, businessLocation)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("noto'g'ri sana formati (YYYY-MM-DD yoki RFC3339): %s", value)
+	}
+	if endOfDay {
+		return businessDayStart(day.AddDate(0, 0, 1)), nil
+	}
+	return businessDayStart(day), nil
+}
+
 // ================= CATEGORY ITEMS ROUTES =================
 
 // GET /api/category-items
@@ -61,6 +216,7 @@ func getCategoryItemHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", entityETag("category-item", item.ID, item.Version))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(Response{
 		Success: true,
@@ -129,12 +285,16 @@ func updateCategoryItemHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	item := UpdateCategoryItem(uint(id), req.Name)
+	item, err := UpdateCategoryItem(uint(id), req.Name, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
 	if item == nil {
 		http.Error(w, "Category item not found", http.StatusNotFound)
 		return
 	}
 
+	w.Header().Set("ETag", entityETag("category-item", item.ID, item.Version))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(Response{
 		Success: true,
@@ -152,7 +312,11 @@ func deleteCategoryItemHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if DeleteCategoryItem(uint(id)) {
+	deleted, err := DeleteCategoryItem(uint(id), r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if deleted {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(Response{
 			Success: true,
@@ -201,10 +365,12 @@ func login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userProfile := UserProfile{
-		ID:      user.ID,
-		Name:    user.Name,
-		Phone:   user.Phone,
-		IsAdmin: user.IsAdmin,
+		ID:        user.ID,
+		Name:      user.Name,
+		Phone:     user.Phone,
+		IsAdmin:   user.IsAdmin,
+		IsDriver:  user.IsDriver,
+		IsKitchen: user.IsKitchen,
 	}
 
 	if user.FilialID > 0 {
@@ -268,11 +434,13 @@ func register(w http.ResponseWriter, r *http.Request) {
 		Data: LoginResponse{
 			Token: token,
 			User: UserProfile{
-				ID:      user.ID,
-				Name:    user.Name,
-				Phone:   user.Phone,
-				IsAdmin: user.IsAdmin,
-				Filial:  *findFilialByID(user.FilialID),
+				ID:        user.ID,
+				Name:      user.Name,
+				Phone:     user.Phone,
+				IsAdmin:   user.IsAdmin,
+				IsDriver:  user.IsDriver,
+				IsKitchen: user.IsKitchen,
+				Filial:    *findFilialByID(user.FilialID),
 			},
 		},
 	})
@@ -317,6 +485,7 @@ func getFilialHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", entityETag("filial", filial.ID, filial.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Response{
@@ -375,7 +544,10 @@ func updateFilialHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filial := UpdateFilial(uint(id), req)
+	filial, err := UpdateFilial(uint(id), req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
 	if filial == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
@@ -386,6 +558,7 @@ func updateFilialHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", entityETag("filial", filial.ID, filial.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Response{
@@ -409,7 +582,11 @@ func deleteFilialHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if DeleteFilial(uint(id)) {
+	deleted, err := DeleteFilial(uint(id), r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if deleted {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(Response{
@@ -489,6 +666,7 @@ func getCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", entityETag("category", category.ID, category.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Response{
@@ -547,7 +725,10 @@ func updateCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	category := UpdateCategory(uint(id), req)
+	category, err := UpdateCategory(uint(id), req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
 	if category == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
@@ -558,6 +739,7 @@ func updateCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", entityETag("category", category.ID, category.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Response{
@@ -581,7 +763,11 @@ func deleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if DeleteCategory(uint(id)) {
+	deleted, err := DeleteCategory(uint(id), r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if deleted {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(Response{
@@ -621,80 +807,111 @@ func getProductsHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(GroupedProductsResponse{
 			Success: false,
 			Message: "Sizga filial belgilanmagan",
-			Data:    make(map[string][]ProductSimple),
+			Data:    []CatalogCategory{},
 		})
 		return
 	}
 
-	// 1️⃣ Ruxsat etilgan kategoriyalarni set (map) qilib olamiz
-	allowedCategories := make(map[uint]bool)
-	for _, catID := range user.CategoryID { // masalan, []uint{1,3,5}
-		allowedCategories[catID] = true
-	}
-
-	var filteredProducts []Product
-	for _, product := range products {
-		// Avvalo filial bo‘yicha filterlaymiz
-		for _, fId := range product.Filials {
-			if fId == user.FilialID {
-				// 2️⃣ Shu mahsulot kategoriyasi ruxsat etilganmi tekshiramiz
-				if len(allowedCategories) > 0 && !allowedCategories[product.CategoryID] {
-					// Ruxsat yo‘q — bu mahsulotni o‘tkazib yuboramiz
-					continue
-				}
-
-				filteredProducts = append(filteredProducts, product)
-				break
-			}
-		}
-	}
-
-	groupedData := make(map[string][]ProductSimple)
-	for _, product := range filteredProducts {
-		// category ni topamiz
-		category := findCategoryByID(product.CategoryID)
-		if category == nil || category.Name == "" {
-			// Agar category topilmasa yoki name bo'sh bo'lsa, umuman qo'shmaymiz
-			continue
-		}
-
-		groupedData[category.Name] = append(groupedData[category.Name], ProductSimple{
-			ID:          product.ID,
-			Type:        product.Type,
-			Name:        product.Name,
-			Ingredients: product.Ingredients,
-			ImageUrl:    product.ImageUrl,
+	// ?category_item_id= - faqat bitta subkategoriya mahsulotlari
+	categoryItemID, err := parseOptionalUintQuery(r, "category_item_id")
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
 		})
+		return
 	}
 
+	catalog := BuildCatalog(user, categoryItemID, time.Now())
+
 	message := "Mahsulotlar olindi"
 	if filial := findFilialByID(user.FilialID); filial != nil {
 		message = fmt.Sprintf("%s filiali mahsulotlari", filial.Name)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(GroupedProductsResponse{
+	// Katalog o'zgarmagan bo'lsa 304 qaytadi
+	writeJSONWithETag(w, r, GroupedProductsResponse{
 		Success: true,
 		Message: message,
-		Data:    groupedData,
+		Data:    catalog,
 	})
 }
 
 // GET /api/products/all (Admin uchun barcha mahsulotlar)
 func getAllProductsHandler(w http.ResponseWriter, r *http.Request) {
-	var productList []ProductDetails
+	params, err := parseListParams(r, "id", false)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// ?category_id= va ?category_item_id= bo'yicha filter
+	query := r.URL.Query()
+	categoryIDs, err := parseUintList(query["category_id"], "category_id")
+	var categoryItemIDs []uint
+	if err == nil {
+		categoryItemIDs, err = parseUintList(query["category_item_id"], "category_item_id")
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	source := products
+	if len(categoryIDs) > 0 || len(categoryItemIDs) > 0 {
+		source = []Product{}
+		for _, product := range products {
+			if len(categoryIDs) > 0 && !slices.Contains(categoryIDs, product.CategoryID) {
+				continue
+			}
+			if len(categoryItemIDs) > 0 && !slices.Contains(categoryItemIDs, product.CategoryItemID) {
+				continue
+			}
+			source = append(source, product)
+		}
+	}
+
+	page, pagination, err := QueryProducts(source, params)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
 
-	for _, product := range products {
+	productList := []ProductDetails{}
+	for _, product := range page {
 		details := ProductDetails{
-			ID:          product.ID,
-			Name:        product.Name,
-			Type:        product.Type,
-			CategoryID:  product.CategoryID,
-			Ingredients: product.Ingredients,
-			Filials:     product.Filials,
-			ImageUrl:    product.ImageUrl,
-			FilialNames: []string{},
+			ID:             product.ID,
+			Name:           product.Name,
+			Type:           product.Type,
+			CategoryID:     product.CategoryID,
+			Ingredients:    product.Ingredients,
+			Filials:        product.Filials,
+			ImageUrl:       product.ImageUrl,
+			FilialNames:    []string{},
+			Unit:           unitCode(product.Type),
+			CategoryItemID: product.CategoryItemID,
+			Decimals:       unitDecimals(product.Type),
+			MinQty:         product.MinQty,
+			MaxQty:         product.MaxQty,
+			Step:           product.Step,
+			Price:          product.Price,
+			Variants:       product.Variants,
 		}
 
 		if category := findCategoryByID(product.CategoryID); category != nil {
@@ -702,6 +919,9 @@ func getAllProductsHandler(w http.ResponseWriter, r *http.Request) {
 		} else {
 			details.CategoryName = "Unknown"
 		}
+		if categoryItem := findCategoryItemByID(product.CategoryItemID); categoryItem != nil {
+			details.CategoryItemName = categoryItem.Name
+		}
 
 		for _, filialID := range product.Filials {
 			if filial := findFilialByID(filialID); filial != nil {
@@ -712,12 +932,11 @@ func getAllProductsHandler(w http.ResponseWriter, r *http.Request) {
 		productList = append(productList, details)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(Response{
-		Success: true,
-		Message: fmt.Sprintf("Jami %d ta mahsulot", len(productList)),
-		Data:    productList,
+	writeJSONWithETag(w, r, PaginatedResponse{
+		Success:    true,
+		Message:    fmt.Sprintf("Jami %d ta mahsulot", pagination.Total),
+		Data:       productList,
+		Pagination: pagination,
 	})
 }
 
@@ -746,6 +965,7 @@ func getProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", entityETag("product", product.ID, product.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Response{
@@ -768,7 +988,43 @@ func addProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product := CreateProduct(req)
+	if err := validateQuantityRules(req.Type, req.MinQty, req.MaxQty, req.Step); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := validateProductCategoryItem(req.CategoryID, req.CategoryItemID); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if req.Price < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Narx manfiy bo'lishi mumkin emas",
+		})
+		return
+	}
+	product, err := CreateProduct(req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -804,7 +1060,48 @@ func updateProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product := UpdateProduct(uint(id), req)
+	if err := validateQuantityRules(req.Type, req.MinQty, req.MaxQty, req.Step); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := validateProductCategoryItem(req.CategoryID, req.CategoryItemID); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if req.Price < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Narx manfiy bo'lishi mumkin emas",
+		})
+		return
+	}
+
+	product, err := UpdateProduct(uint(id), req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
 	if product == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
@@ -815,6 +1112,7 @@ func updateProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", entityETag("product", product.ID, product.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Response{
@@ -838,7 +1136,11 @@ func deleteProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if DeleteProduct(uint(id)) {
+	deleted, err := DeleteProduct(uint(id), r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if deleted {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(Response{
@@ -859,13 +1161,37 @@ func deleteProductHandler(w http.ResponseWriter, r *http.Request) {
 
 // GET /api/users
 func getUsersHandler(w http.ResponseWriter, r *http.Request) {
-	var userList []UserProfile
-	for _, user := range users {
+	params, err := parseListParams(r, "id", false)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	page, pagination, err := QueryUsers(users, params)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	userList := []UserProfile{}
+	for _, user := range page {
 		profile := UserProfile{
-			ID:      user.ID,
-			Name:    user.Name,
-			Phone:   user.Phone,
-			IsAdmin: user.IsAdmin,
+			ID:        user.ID,
+			Name:      user.Name,
+			Phone:     user.Phone,
+			IsAdmin:   user.IsAdmin,
+			IsDriver:  user.IsDriver,
+			IsKitchen: user.IsKitchen,
 		}
 		if user.FilialID > 0 {
 			if filial := findFilialByID(user.FilialID); filial != nil {
@@ -877,10 +1203,11 @@ func getUsersHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(Response{
-		Success: true,
-		Message: "Foydalanuvchilar",
-		Data:    userList,
+	json.NewEncoder(w).Encode(PaginatedResponse{
+		Success:    true,
+		Message:    "Foydalanuvchilar",
+		Data:       userList,
+		Pagination: pagination,
 	})
 }
 
@@ -908,12 +1235,15 @@ func getUserHandler(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	w.Header().Set("ETag", entityETag("user", user.ID, user.Version))
 
 	profile := UserProfile{
-		ID:      user.ID,
-		Name:    user.Name,
-		Phone:   user.Phone,
-		IsAdmin: user.IsAdmin,
+		ID:        user.ID,
+		Name:      user.Name,
+		Phone:     user.Phone,
+		IsAdmin:   user.IsAdmin,
+		IsDriver:  user.IsDriver,
+		IsKitchen: user.IsKitchen,
 	}
 	if user.FilialID > 0 {
 		if filial := findFilialByID(user.FilialID); filial != nil {
@@ -956,7 +1286,10 @@ func updateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := UpdateUser(uint(id), req)
+	user, err := UpdateUser(uint(id), req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
 	if user == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
@@ -967,6 +1300,7 @@ func updateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", entityETag("user", user.ID, user.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Response{
@@ -990,7 +1324,11 @@ func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if DeleteUser(uint(id)) {
+	deleted, err := DeleteUser(uint(id), r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if deleted {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(Response{
@@ -1032,7 +1370,10 @@ func assignFilialHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := AssignUserFilial(uint(id), req.FilialID)
+	user, err := AssignUserFilial(uint(id), req.FilialID, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
 	if user == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
@@ -1043,6 +1384,7 @@ func assignFilialHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", entityETag("user", user.ID, user.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Response{
@@ -1059,6 +1401,17 @@ func getOrdersHandler(w http.ResponseWriter, r *http.Request) {
 	userID, _ := strconv.Atoi(userIDStr)
 	isAdmin := r.Header.Get("User-IsAdmin") == "true"
 
+	params, err := parseListParams(r, "created", true)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	var filteredOrders []Order
 
 	if isAdmin {
@@ -1067,12 +1420,24 @@ func getOrdersHandler(w http.ResponseWriter, r *http.Request) {
 		filteredOrders = GetOrdersByUserID(uint(userID))
 	}
 
+	page, pagination, err := QueryOrders(filteredOrders, params)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(Response{
-		Success: true,
-		Message: "Orderlar",
-		Data:    filteredOrders,
+	json.NewEncoder(w).Encode(PaginatedResponse{
+		Success:    true,
+		Message:    "Orderlar",
+		Data:       page,
+		Pagination: pagination,
 	})
 }
 
@@ -1116,6 +1481,7 @@ func getOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", entityETag("order", order.ID, order.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Response{
@@ -1151,44 +1517,220 @@ func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order, err := CreateOrder(uint(userID), req)
-	if err != nil {
+	key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if key == "" {
+		placeOrderAndRespond(w, uint(userID), req, "")
+		return
+	}
+	if len(key) > maxIdempotencyKeySize {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(Response{
 			Success: false,
-			Message: err.Error(),
+			Message: fmt.Sprintf("Idempotency-Key %d belgidan oshmasligi kerak", maxIdempotencyKeySize),
 		})
 		return
 	}
 
-	// Order yaratilganidan keyin printerga yuborish
-	order.Status = "confirmed"
-	printErr := sendToPrinter(order)
-
-	var response Response
-	var statusCode int
-
-	if printErr != nil {
-		if orderPtr := findOrderByID(order.ID); orderPtr != nil {
-			orderPtr.Status = "print_error"
-			orderPtr.Updated = time.Now()
-			saveData()
-		}
-
-		statusCode = http.StatusInternalServerError
-		response = Response{
+	// Shu kalit bilan avval javob berilgan bo'lsa - o'sha javobni qaytaramiz
+	record, inFlight, err := BeginIdempotentRequest(uint(userID), key, idempotencyRequestHash(req))
+	if errors.Is(err, ErrIdempotencyKeyReused) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(Response{
 			Success: false,
-			Message: fmt.Sprintf("Order yaratildi lekin chek yuborilmadi (%s - %s)", order.Username, order.FilialName),
+			Message: err.Error(),
+		})
+		return
+	}
+	if record != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(record.StatusCode)
+		w.Write(record.Response)
+		return
+	}
+	if inFlight {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Shu Idempotency-Key bilan so'rov hali bajarilmoqda",
+		})
+		return
+	}
+
+	// Javoblar fayli yo'qolgan, lekin order kalit bilan saqlangan
+	if order := FindOrderByIdempotencyKey(uint(userID), key); order != nil {
+		AbortIdempotentRequest(uint(userID), key)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(Response{
+			Success: true,
+			Message: fmt.Sprintf("Order avval yaratilgan - Order ID: %s", order.OrderID),
 			Data:    order,
+		})
+		return
+	}
+
+	req.IdempotencyKey = key
+	recorder := &recordingResponseWriter{ResponseWriter: w}
+	placeOrderAndRespond(recorder, uint(userID), req, "")
+
+	orderID := ""
+	if order := FindOrderByIdempotencyKey(uint(userID), key); order != nil {
+		orderID = order.OrderID
+	}
+	FinishIdempotentRequest(uint(userID), key, recorder.statusCode, recorder.body.Bytes(), orderID)
+}
+
+// Itemlar bo'yicha xatolar bo'lsa ular data da ro'yxat bo'lib qaytadi
+func orderErrorResponse(err error) Response {
+	response := Response{
+		Success: false,
+		Message: err.Error(),
+	}
+	var validationErr *OrderValidationError
+	if errors.As(err, &validationErr) {
+		response.Data = validationErr.Items
+	}
+	return response
+}
+
+// Order yaratish, printerga yuborish va javob qaytarish.
+// POST /orders, reorder va shablondan order uchun umumiy; note javob xabariga qo'shiladi.
+func placeOrderAndRespond(w http.ResponseWriter, userID uint, req CreateOrderRequest, note string) {
+	user := findUserByID(userID)
+	if user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User topilmadi",
+		})
+		return
+	}
+
+	// Hech narsa yaratish yoki rejalashtirishdan oldin butun orderni tekshiramiz
+	comment, err := sanitizeNote(req.Comment, maxOrderCommentLength)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	req.Comment = comment
+
+	if _, err := validateDelivery(req.DeliveryDate, req.DeliverySlotID, time.Now()); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	items, err := ValidateOrderItems(user.FilialID, req.Items, false)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(orderErrorResponse(err))
+		return
+	}
+
+	// Buyurtma oynasi yopiq kategoriyalar: rad etish yoki ochilish vaqtiga qoldirish
+	onTime, deferred, err := SplitLateOrderItems(user.FilialID, items, time.Now())
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if len(deferred) > 0 {
+		if err := ValidateDeferredOrderItems(user, deferred, req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
 		}
-	} else {
-		if orderPtr := findOrderByID(order.ID); orderPtr != nil {
-			orderPtr.Status = "sent_to_printer"
-			orderPtr.Updated = time.Now()
-			saveData()
+	}
+
+	if len(onTime) == 0 {
+		schedules, err := DeferOrderItems(user, deferred, req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(Response{
+			Success: true,
+			Message: "Buyurtma vaqti tugagan, order ochilish vaqtiga rejalashtirildi",
+			Data:    schedules,
+		})
+		return
+	}
+
+	req.Items = onTime
+	order, err := CreateOrder(userID, req)
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		var slotErr *SlotFullError
+		if errors.As(err, &slotErr) {
+			statusCode = http.StatusConflict
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(orderErrorResponse(err))
+		return
+	}
+
+	if len(deferred) > 0 {
+		deferredNote := "Buyurtma vaqti tugagan mahsulotlar ochilish vaqtiga rejalashtirildi"
+		if _, err := DeferOrderItems(user, deferred, req); err != nil {
+			deferredNote = fmt.Sprintf("Buyurtma vaqti tugagan mahsulotlarni rejalashtirib bo'lmadi: %v", err)
 		}
+		if note != "" {
+			note += ". "
+		}
+		note += deferredNote
+	}
 
+	// Bir xil order qisqa vaqt ichida qayta kelsa - Telegram ga ogohlantirish
+	go notifyPossibleDuplicateOrder(*order)
+
+	// Order yaratilganidan keyin printerga yuborish
+	printErr := dispatchOrder(order)
+
+	var response Response
+	var statusCode int
+
+	if printErr != nil {
+		statusCode = http.StatusInternalServerError
+		response = Response{
+			Success: false,
+			Message: fmt.Sprintf("Order yaratildi lekin chek yuborilmadi (%s - %s)", order.Username, order.FilialName),
+			Data:    order,
+		}
+	} else {
 		statusCode = http.StatusOK
 		response = Response{
 			Success: true,
@@ -1196,6 +1738,9 @@ func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 			Data:    order,
 		}
 	}
+	if note != "" {
+		response.Message += ". " + note
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -1227,7 +1772,10 @@ func updateOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order := UpdateOrder(uint(id), req)
+	order, err := UpdateOrder(uint(id), req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
 	if order == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
@@ -1238,6 +1786,7 @@ func updateOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", entityETag("order", order.ID, order.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Response{
@@ -1247,6 +1796,180 @@ func updateOrderHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Admin, order egasi yoki shu filial xodimi
+func canAccessBranchOrder(user *User, order *Order) bool {
+	return user.IsAdmin || order.UserID == user.ID || order.FilialID == user.FilialID
+}
+
+// Filial orderini o'zgartirish/bekor qilishdan oldingi umumiy tekshiruvlar:
+// order mavjud, user shu filialdan (yoki admin), If-Match va o'zgartirish muddati
+
+func loadOrderForBranchEdit(w http.ResponseWriter, r *http.Request) (*Order, *User, bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid order ID",
+		})
+		return nil, nil, false
+	}
+
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	user := findUserByID(uint(userID))
+	if user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User topilmadi",
+		})
+		return nil, nil, false
+	}
+
+	order := GetOrderByID(uint(id))
+	if order == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Order topilmadi",
+		})
+		return nil, nil, false
+	}
+
+	if !canAccessBranchOrder(user, order) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Bu orderni o'zgartirish huquqingiz yo'q",
+		})
+		return nil, nil, false
+	}
+
+	if err := CheckOrderEditable(order, user.IsAdmin); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return nil, nil, false
+	}
+
+	return order, user, true
+}
+
+// POST /api/orders/{id}/amend (filial o'z orderidagi mahsulotlarni o'zgartiradi)
+func amendOrderHandler(w http.ResponseWriter, r *http.Request) {
+	existing, user, ok := loadOrderForBranchEdit(w, r)
+	if !ok {
+		return
+	}
+
+	var req AmendOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	if len(req.Items) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "O'zgarishlar ro'yxati bo'sh",
+		})
+		return
+	}
+
+	order, change, err := AmendOrder(existing.ID, user, req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := "Order o'zgartirildi va chek yuborildi"
+	if err := sendChangeToPrinter(order, *change); err != nil {
+		message = "Order o'zgartirildi lekin chek yuborilmadi"
+	}
+
+	w.Header().Set("ETag", entityETag("order", order.ID, order.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: message,
+		Data:    order,
+	})
+}
+
+// POST /api/orders/{id}/cancel
+func cancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+	existing, user, ok := loadOrderForBranchEdit(w, r)
+	if !ok {
+		return
+	}
+
+	// Sabab ixtiyoriy, body bo'sh bo'lishi mumkin
+	var req CancelOrderRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: "Invalid JSON",
+			})
+			return
+		}
+	}
+
+	order, change, err := CancelOrder(existing.ID, user, req.Reason, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := "Order bekor qilindi va chek yuborildi"
+	if err := sendChangeToPrinter(order, *change); err != nil {
+		message = "Order bekor qilindi lekin chek yuborilmadi"
+	}
+
+	w.Header().Set("ETag", entityETag("order", order.ID, order.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: message,
+		Data:    order,
+	})
+}
+
 // DELETE /api/orders/{id}
 func deleteOrderHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -1261,7 +1984,11 @@ func deleteOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if DeleteOrder(uint(id)) {
+	deleted, err := DeleteOrder(uint(id), r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if deleted {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(Response{
@@ -1280,17 +2007,2175 @@ func deleteOrderHandler(w http.ResponseWriter, r *http.Request) {
 
 // GET /api/orderslist (Admin uchun filter bilan orderlarni ko'rish)
 func getOrdersListHandler(w http.ResponseWriter, r *http.Request) {
-	filialID := r.URL.Query().Get("filial_id")
-	status := r.URL.Query().Get("status")
-	date := r.URL.Query().Get("date")
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	params, err := parseListParams(r, "created", true)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	filteredOrders := GetFilteredOrders(filter)
+
+	page, pagination, err := QueryOrders(filteredOrders, params)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(PaginatedResponse{
+		Success:    true,
+		Message:    fmt.Sprintf("Jami %d ta order topildi", pagination.Total),
+		Data:       page,
+		Pagination: pagination,
+	})
+}
+
+// ================= REORDER / ORDER TEMPLATES ROUTES =================
+
+// POST /api/orders/{id}/reorder (oldingi orderni takrorlash)
+func reorderHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid order ID",
+		})
+		return
+	}
+
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	user := findUserByID(uint(userID))
+	if user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User topilmadi",
+		})
+		return
+	}
+
+	order := GetOrderByID(uint(id))
+	if order == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Order topilmadi",
+		})
+		return
+	}
+
+	if !user.IsAdmin && order.UserID != user.ID && order.FilialID != user.FilialID {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Bu orderni takrorlash huquqingiz yo'q",
+		})
+		return
+	}
+
+	submitItemsAndRespond(w, user, ReorderItems(order))
+}
+
+// Filialda mavjud bo'lmagan mahsulotlarni tashlab, qolganidan order yaratadi
+func submitItemsAndRespond(w http.ResponseWriter, user *User, items []CreateOrderItem) {
+	available, skipped := FilterAvailableItems(user.FilialID, items)
+	if len(available) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Mahsulotlarning hech biri hozir buyurtma qilib bo'lmaydi",
+			Data:    map[string]interface{}{"skipped": skipped},
+		})
+		return
+	}
+
+	note := ""
+	if len(skipped) > 0 {
+		note = fmt.Sprintf("Mavjud bo'lmagani uchun qo'shilmadi: %s", strings.Join(skipped, ", "))
+	}
+	placeOrderAndRespond(w, user.ID, CreateOrderRequest{Items: available}, note)
+}
+
+// Shablonni olish: admin yoki shu filial useri
+func loadOrderTemplateForUser(w http.ResponseWriter, r *http.Request) (*OrderTemplate, *User, bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid template ID",
+		})
+		return nil, nil, false
+	}
+
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	user := findUserByID(uint(userID))
+	if user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User topilmadi",
+		})
+		return nil, nil, false
+	}
+
+	template := GetOrderTemplateByID(uint(id))
+	if template == nil || (!user.IsAdmin && template.FilialID != user.FilialID) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Shablon topilmadi",
+		})
+		return nil, nil, false
+	}
+
+	return template, user, true
+}
+
+// GET /api/order-templates
+func getOrderTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	user := findUserByID(uint(userID))
+	if user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User topilmadi",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Order shablonlari",
+		Data:    GetOrderTemplatesForUser(user),
+	})
+}
+
+// POST /api/order-templates
+func addOrderTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	user := findUserByID(uint(userID))
+	if user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User topilmadi",
+		})
+		return
+	}
+
+	var req OrderTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	template, err := CreateOrderTemplate(user, req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("ETag", entityETag("order-template", template.ID, template.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Shablon saqlandi",
+		Data:    template,
+	})
+}
+
+// PUT /api/order-templates/{id}
+func updateOrderTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	current, _, ok := loadOrderTemplateForUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req OrderTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	template, err := UpdateOrderTemplate(current.ID, req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("ETag", entityETag("order-template", template.ID, template.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Shablon yangilandi",
+		Data:    template,
+	})
+}
+
+// DELETE /api/order-templates/{id}
+func deleteOrderTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	current, _, ok := loadOrderTemplateForUser(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := DeleteOrderTemplate(current.ID, r.Header.Get("If-Match")); writeVersionConflict(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Shablon o'chirildi",
+	})
+}
+
+// POST /api/order-templates/{id}/submit (shablondan bitta chaqiruvda order)
+func submitOrderTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, user, ok := loadOrderTemplateForUser(w, r)
+	if !ok {
+		return
+	}
+
+	submitItemsAndRespond(w, user, template.Items)
+}
+
+// ================= SCHEDULED ORDERS ROUTES =================
+
+// Rejani olish: admin yoki shu filial useri
+func loadScheduledOrderForUser(w http.ResponseWriter, r *http.Request) (*ScheduledOrder, *User, bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid schedule ID",
+		})
+		return nil, nil, false
+	}
+
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	user := findUserByID(uint(userID))
+	if user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User topilmadi",
+		})
+		return nil, nil, false
+	}
+
+	schedule := GetScheduledOrderByID(uint(id))
+	if schedule == nil || (!user.IsAdmin && schedule.FilialID != user.FilialID) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Reja topilmadi",
+		})
+		return nil, nil, false
+	}
+
+	return schedule, user, true
+}
+
+func writeScheduledOrderResult(w http.ResponseWriter, schedule *ScheduledOrder, err error, message string) {
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("ETag", entityETag("scheduled-order", schedule.ID, schedule.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: message,
+		Data:    schedule,
+	})
+}
+
+// GET /api/scheduled-orders
+func getScheduledOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	user := findUserByID(uint(userID))
+	if user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User topilmadi",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Rejalashtirilgan orderlar",
+		Data:    GetScheduledOrdersForUser(user),
+	})
+}
+
+// POST /api/scheduled-orders
+func addScheduledOrderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	user := findUserByID(uint(userID))
+	if user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User topilmadi",
+		})
+		return
+	}
+
+	var req ScheduledOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	schedule, err := CreateScheduledOrder(user, req)
+	writeScheduledOrderResult(w, schedule, err, "Reja saqlandi")
+}
+
+// PUT /api/scheduled-orders/{id}
+func updateScheduledOrderHandler(w http.ResponseWriter, r *http.Request) {
+	current, _, ok := loadScheduledOrderForUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req ScheduledOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	schedule, err := UpdateScheduledOrder(current.ID, req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	writeScheduledOrderResult(w, schedule, err, "Reja yangilandi")
+}
+
+// POST /api/scheduled-orders/{id}/pause
+func pauseScheduledOrderHandler(w http.ResponseWriter, r *http.Request) {
+	current, _, ok := loadScheduledOrderForUser(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := SetScheduledOrderPaused(current.ID, true, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	writeScheduledOrderResult(w, schedule, err, "Reja to'xtatildi")
+}
+
+// POST /api/scheduled-orders/{id}/resume
+func resumeScheduledOrderHandler(w http.ResponseWriter, r *http.Request) {
+	current, _, ok := loadScheduledOrderForUser(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := SetScheduledOrderPaused(current.ID, false, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	writeScheduledOrderResult(w, schedule, err, "Reja davom ettirildi")
+}
+
+// POST /api/scheduled-orders/{id}/skip
+func skipScheduledOrderHandler(w http.ResponseWriter, r *http.Request) {
+	current, _, ok := loadScheduledOrderForUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req SkipScheduledOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	schedule, err := SkipScheduledOrderDate(current.ID, req.Date, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	writeScheduledOrderResult(w, schedule, err, fmt.Sprintf("%s kuni o'tkazib yuboriladi", req.Date))
+}
+
+// DELETE /api/scheduled-orders/{id}
+func deleteScheduledOrderHandler(w http.ResponseWriter, r *http.Request) {
+	current, _, ok := loadScheduledOrderForUser(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := DeleteScheduledOrder(current.ID, r.Header.Get("If-Match")); writeVersionConflict(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Reja o'chirildi",
+	})
+}
+
+// ================= ORDERING WINDOWS ROUTES =================
+
+// GET /api/ordering-windows
+func getOrderingWindowsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Buyurtma oynalari",
+		Data:    GetAllOrderingWindows(),
+	})
+}
+
+// POST /api/ordering-windows
+func addOrderingWindowHandler(w http.ResponseWriter, r *http.Request) {
+	var req OrderingWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	window, err := CreateOrderingWindow(req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("ETag", entityETag("ordering-window", window.ID, window.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Buyurtma oynasi qo'shildi",
+		Data:    window,
+	})
+}
+
+// PUT /api/ordering-windows/{id}
+func updateOrderingWindowHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid window ID",
+		})
+		return
+	}
+
+	var req OrderingWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	window, err := UpdateOrderingWindow(uint(id), req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if window == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Buyurtma oynasi topilmadi",
+		})
+		return
+	}
+
+	w.Header().Set("ETag", entityETag("ordering-window", window.ID, window.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Buyurtma oynasi yangilandi",
+		Data:    window,
+	})
+}
+
+// DELETE /api/ordering-windows/{id}
+func deleteOrderingWindowHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid window ID",
+		})
+		return
+	}
+
+	deleted, err := DeleteOrderingWindow(uint(id), r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if deleted {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(Response{
+			Success: true,
+			Message: "Buyurtma oynasi o'chirildi",
+		})
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Buyurtma oynasi topilmadi",
+		})
+	}
+}
+
+// GET /api/units - o'lchov birliklari va ularning kasr xonalari
+func getUnitsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "O'lchov birliklari",
+		Data:    units,
+	})
+}
+
+// ================= STOCK ROUTES =================
+
+// Query dagi ixtiyoriy ID (?filial_id=0 - markaziy oshxona)
+func parseOptionalUintQuery(r *http.Request, key string) (*uint, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("noto'g'ri %s: %s", key, value)
+	}
+	id := uint(n)
+	return &id, nil
+}
+
+// GET /api/stock?filial_id=
+func getStockHandler(w http.ResponseWriter, r *http.Request) {
+	filialID, err := parseOptionalUintQuery(r, "filial_id")
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Ombor qoldiqlari",
+		Data:    GetStockLevels(filialID),
+	})
+}
+
+// GET /api/stock/movements?product_id=&filial_id=&limit=
+func getStockMovementsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := parseOptionalUintQuery(r, "product_id")
+	var filialID *uint
+	if err == nil {
+		filialID, err = parseOptionalUintQuery(r, "filial_id")
+	}
+	limit := 100
+	if value := r.URL.Query().Get("limit"); err == nil && value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxPageLimit {
+			err = fmt.Errorf("limit 1 dan %d gacha bo'lishi kerak", maxPageLimit)
+		}
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Ombor harakatlari",
+		Data:    GetStockMovements(productID, filialID, limit),
+	})
+}
+
+func writeStockResult(w http.ResponseWriter, level *StockLevel, err error, message string) {
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: message,
+		Data:    level,
+	})
+}
+
+// POST /api/stock/restock
+func restockHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+
+	var req RestockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	level, err := Restock(req, uint(userID))
+	writeStockResult(w, level, err, "Kirim qilindi")
+}
+
+// POST /api/stock/adjust
+func adjustStockHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+
+	var req StockAdjustRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	level, err := AdjustStock(req, uint(userID))
+	writeStockResult(w, level, err, "Qoldiq tuzatildi")
+}
+
+// PUT /api/stock/threshold
+func setStockThresholdHandler(w http.ResponseWriter, r *http.Request) {
+	var req StockThresholdRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	level, err := SetStockThreshold(req)
+	writeStockResult(w, level, err, "Ogohlantirish chegarasi saqlandi")
+}
+
+// DELETE /api/stock?product_id=&filial_id= - qoldiqni kuzatishni to'xtatish
+func deleteStockHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := parseOptionalUintQuery(r, "product_id")
+	if err != nil || productID == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "product_id majburiy",
+		})
+		return
+	}
+	filialID, err := parseOptionalUintQuery(r, "filial_id")
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	var filial uint
+	if filialID != nil {
+		filial = *filialID
+	}
+
+	if !DeleteStockLevel(*productID, filial) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Qoldiq yozuvi topilmadi",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Qoldiq kuzatuvi to'xtatildi",
+	})
+}
+
+// ================= STOP-LIST ROUTES =================
+
+// GET /api/stop-list?filial_id= - amaldagi stoplar
+func getStopListHandler(w http.ResponseWriter, r *http.Request) {
+	filialID, err := parseOptionalUintQuery(r, "filial_id")
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Stop-list",
+		Data:    GetActiveStopList(filialID),
+	})
+}
+
+// POST /api/stop-list
+func addStopListHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+
+	var req StopListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	entry, err := AddToStopList(req, uint(userID))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Mahsulot stop-listga qo'shildi",
+		Data:    entry,
+	})
+}
+
+// DELETE /api/stop-list/{id}
+func deleteStopListEntryHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid stop-list ID",
+		})
+		return
+	}
+
+	if !RemoveFromStopList(uint(id)) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Stop-list yozuvi topilmadi",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Stop-listdan olib tashlandi",
+	})
+}
+
+// DELETE /api/stop-list?product_id= - barcha (yoki mahsulotning) stoplarini tozalash
+func clearStopListHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := parseOptionalUintQuery(r, "product_id")
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	removed := ClearStopList(productID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: fmt.Sprintf("Stop-listdan %d ta yozuv olib tashlandi", removed),
+	})
+}
+
+// ================= REPORTS =================
+
+// GET /api/reports/category-items - orderslist bilan bir xil filterlar
+func getSubcategoryReportHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	filteredOrders := GetFilteredOrders(filter)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: fmt.Sprintf("%d ta order bo'yicha hisobot", len(filteredOrders)),
+		Data:    BuildSubcategoryReport(filteredOrders, filter),
+	})
+}
+
+// ================= CATALOG ORDER ROUTES =================
+
+func writeReorderResult(w http.ResponseWriter, data interface{}, err error) {
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Tartib saqlandi",
+		Data:    data,
+	})
+}
+
+// PUT /api/categories/reorder
+func reorderCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	result, err := ReorderCategories(req.IDs)
+	writeReorderResult(w, result, err)
+}
+
+// PUT /api/category-items/reorder
+func reorderCategoryItemsHandler(w http.ResponseWriter, r *http.Request) {
+	var req CategoryItemReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	result, err := ReorderCategoryItems(req)
+	writeReorderResult(w, result, err)
+}
+
+// PUT /api/products/reorder - guruh ichida tartiblash yoki boshqa kategoriya/subkategoriyaga ko'chirish
+func moveProductsHandler(w http.ResponseWriter, r *http.Request) {
+	var req ProductMoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	result, err := MoveProducts(req)
+	writeReorderResult(w, result, err)
+}
+
+// ================= DELIVERY SLOTS ROUTES =================
+
+// GET /api/delivery-slots
+func getDeliverySlotsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Yetkazib berish slotlari",
+		Data:    GetAllDeliverySlots(),
+	})
+}
+
+// POST /api/delivery-slots
+func addDeliverySlotHandler(w http.ResponseWriter, r *http.Request) {
+	var req DeliverySlotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	slot, err := CreateDeliverySlot(req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("ETag", entityETag("delivery-slot", slot.ID, slot.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Yetkazib berish sloti qo'shildi",
+		Data:    slot,
+	})
+}
+
+// PUT /api/delivery-slots/{id}
+func updateDeliverySlotHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid slot ID",
+		})
+		return
+	}
+
+	var req DeliverySlotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	slot, err := UpdateDeliverySlot(uint(id), req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if slot == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Yetkazib berish sloti topilmadi",
+		})
+		return
+	}
+
+	w.Header().Set("ETag", entityETag("delivery-slot", slot.ID, slot.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Yetkazib berish sloti yangilandi",
+		Data:    slot,
+	})
+}
+
+// DELETE /api/delivery-slots/{id}
+func deleteDeliverySlotHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid slot ID",
+		})
+		return
+	}
+
+	deleted, err := DeleteDeliverySlot(uint(id), r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if deleted {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(Response{
+			Success: true,
+			Message: "Yetkazib berish sloti o'chirildi",
+		})
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Yetkazib berish sloti topilmadi",
+		})
+	}
+}
+
+// GET /api/delivery-slots/available?date=YYYY-MM-DD - user filiali uchun slotlar va bo'sh joylar.
+// Admin boshqa filialni ?filial_id= bilan ko'ra oladi.
+func getAvailableDeliverySlotsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	user := findUserByID(uint(userID))
+	if user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User topilmadi",
+		})
+		return
+	}
+
+	filialID := user.FilialID
+	if user.IsAdmin {
+		requested, err := parseOptionalUintQuery(r, "filial_id")
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		if requested != nil {
+			filialID = *requested
+		}
+	}
+
+	slots, err := GetDeliverySlotAvailability(filialID, r.URL.Query().Get("date"), time.Now())
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Yetkazib berish slotlari",
+		Data:    slots,
+	})
+}
+
+// GET /api/delivery-slots/orders?delivery_date=&filial_id=&status= - orderlar slot bo'yicha guruhlangan
+func getDeliverySlotOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Yetkazib berish slotlari bo'yicha orderlar",
+		Data:    GroupOrdersByDeliverySlot(GetFilteredOrders(filter)),
+	})
+}
+
+// ================= DELIVERY ROUTES =================
+
+// GET /api/delivery-routes
+func getDeliveryRoutesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Marshrutlar",
+		Data:    GetAllDeliveryRoutes(),
+	})
+}
+
+// POST /api/delivery-routes
+func addDeliveryRouteHandler(w http.ResponseWriter, r *http.Request) {
+	var req DeliveryRouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	route, err := CreateDeliveryRoute(req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("ETag", entityETag("delivery-route", route.ID, route.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Marshrut qo'shildi",
+		Data:    route,
+	})
+}
+
+// PUT /api/delivery-routes/{id}
+func updateDeliveryRouteHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid route ID",
+		})
+		return
+	}
+
+	var req DeliveryRouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	route, err := UpdateDeliveryRoute(uint(id), req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if route == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Marshrut topilmadi",
+		})
+		return
+	}
+
+	w.Header().Set("ETag", entityETag("delivery-route", route.ID, route.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Marshrut yangilandi",
+		Data:    route,
+	})
+}
+
+// DELETE /api/delivery-routes/{id}
+func deleteDeliveryRouteHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid route ID",
+		})
+		return
+	}
+
+	deleted, err := DeleteDeliveryRoute(uint(id), r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if deleted {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(Response{
+			Success: true,
+			Message: "Marshrut o'chirildi",
+		})
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Marshrut topilmadi",
+		})
+	}
+}
+
+// POST /api/delivery-routes/{id}/assign - orderlarni marshrut va haydovchiga biriktirish
+func assignRouteOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid route ID",
+		})
+		return
+	}
+
+	var req RouteAssignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	manifest, err := AssignRouteOrders(uint(id), req)
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		var slotErr *SlotFullError
+		if errors.As(err, &slotErr) {
+			statusCode = http.StatusConflict
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: fmt.Sprintf("%d ta order marshrutga biriktirildi", manifest.OrderCount),
+		Data:    manifest,
+	})
+}
+
+// GET /api/delivery-routes/{id}/manifest?date= - marshrut yuk xati
+func getRouteManifestHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid route ID",
+		})
+		return
+	}
+
+	date, err := deliveryDateOrToday(r.URL.Query().Get("date"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	route := GetDeliveryRouteByID(uint(id))
+	if route == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Marshrut topilmadi",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Yuk xati",
+		Data:    BuildRouteManifest(route, date, 0),
+	})
+}
+
+// GET /api/driver/manifests?date= - haydovchiga biriktirilgan marshrutlar
+func getDriverManifestsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+
+	date, err := deliveryDateOrToday(r.URL.Query().Get("date"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Yuk xatlari",
+		Data:    GetDriverManifests(uint(userID), date),
+	})
+}
+
+// POST /api/driver/routes/{id}/stops/{filial_id}/delivered - to'xtash joyidagi orderlar yetkazildi
+func markStopDeliveredHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	routeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid route ID",
+		})
+		return
+	}
+	filialID, err := strconv.Atoi(vars["filial_id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid filial ID",
+		})
+		return
+	}
+
+	var req StopDeliveredRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: "Invalid JSON",
+			})
+			return
+		}
+	}
+	date, err := deliveryDateOrToday(req.Date)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	actor := findUserByID(uint(userID))
+
+	stop, err := MarkStopDelivered(uint(routeID), uint(filialID), date, actor)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Yetkazildi",
+		Data:    stop,
+	})
+}
+
+// ================= PRODUCTION PLAN ROUTES =================
+
+// ?date=YYYY-MM-DD (bo'sh - bugun)&delivery_slot_id=&filial_id=&category_id=&printer=
+func parseProductionPlanFilter(r *http.Request) (ProductionPlanFilter, error) {
+	query := r.URL.Query()
+	var filter ProductionPlanFilter
+	var err error
+
+	if filter.Date, err = deliveryDateOrToday(query.Get("date")); err != nil {
+		return filter, err
+	}
+	if filter.DeliverySlotIDs, err = parseUintList(query["delivery_slot_id"], "delivery_slot_id"); err != nil {
+		return filter, err
+	}
+	if filter.FilialIDs, err = parseUintList(query["filial_id"], "filial_id"); err != nil {
+		return filter, err
+	}
+	if filter.CategoryIDs, err = parseUintList(query["category_id"], "category_id"); err != nil {
+		return filter, err
+	}
+	if filter.Printers, err = parseUintList(query["printer"], "printer"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// GET /api/production-plan?date=&...&format=csv - mahsulotlar bo'yicha jami, filiallar bo'yicha taqsimot
+func getProductionPlanHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseProductionPlanFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	plan := BuildProductionPlan(filter)
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="production-plan-%s.csv"`, plan.Date))
+		w.WriteHeader(http.StatusOK)
+		w.Write(ProductionPlanCSV(plan))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: fmt.Sprintf("%d ta order bo'yicha ishlab chiqarish rejasi", plan.OrderCount),
+		Data:    plan,
+	})
+}
+
+// POST /api/production-plan/print?date=&... - rejani printerlarga yuborish
+func printProductionPlanHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseProductionPlanFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	plan := BuildProductionPlan(filter)
+	if len(plan.Printers) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Rejada mahsulot yo'q",
+		})
+		return
+	}
+
+	username := ""
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	if user := findUserByID(uint(userID)); user != nil {
+		username = user.Name
+	}
+
+	if failed := PrintProductionPlan(plan, username); len(failed) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: fmt.Sprintf("Reja ba'zi printerlarga yuborilmadi: %v", failed),
+			Data:    plan,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Ishlab chiqarish rejasi printerlarga yuborildi",
+		Data:    plan,
+	})
+}
+
+// ================= KDS ROUTES =================
+
+// /kds/stations/{printer}/...?category_id=1&category_id=2
+func parseKDSStation(r *http.Request) (kdsStation, error) {
+	var station kdsStation
+	printer, err := strconv.Atoi(mux.Vars(r)["printer"])
+	if err != nil || printer <= 0 {
+		return station, fmt.Errorf("Invalid printer")
+	}
+	station.Printer = uint(printer)
+	if station.CategoryIDs, err = parseUintList(r.URL.Query()["category_id"], "category_id"); err != nil {
+		return station, err
+	}
+	return station, nil
+}
+
+// GET /api/kds/stations - printerlar, kategoriyalari va navbatdagi qatorlar soni
+func getKDSStationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "KDS stansiyalari",
+		Data:    GetKDSStations(),
+	})
+}
+
+// GET /api/kds/stations/{printer}/queue?category_id=&include_bumped=true
+func getKDSQueueHandler(w http.ResponseWriter, r *http.Request) {
+	station, err := parseKDSStation(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	includeBumped := r.URL.Query().Get("include_bumped") == "true"
+
+	queue := GetKDSQueue(station, includeBumped)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: fmt.Sprintf("Navbatda %d ta order", len(queue.Orders)),
+		Data:    queue,
+	})
+}
+
+// POST /api/kds/stations/{printer}/orders/{id}/bump - qatorlar tayyor
+func bumpKDSItemsHandler(w http.ResponseWriter, r *http.Request) {
+	setKDSItemsStatus(w, r, true)
+}
+
+// POST /api/kds/stations/{printer}/orders/{id}/recall - qatorlar navbatga qaytadi
+func recallKDSItemsHandler(w http.ResponseWriter, r *http.Request) {
+	setKDSItemsStatus(w, r, false)
+}
+
+func setKDSItemsStatus(w http.ResponseWriter, r *http.Request, bump bool) {
+	station, err := parseKDSStation(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid order ID",
+		})
+		return
+	}
+
+	var req KDSActionRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: "Invalid JSON",
+			})
+			return
+		}
+	}
+
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	actor := findUserByID(uint(userID))
+	if actor == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User not found",
+		})
+		return
+	}
+
+	view, err := SetKitchenItemsStatus(uint(orderID), station, req.Items, actor, bump)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := "Qatorlar navbatga qaytarildi"
+	if bump {
+		message = "Qatorlar tayyor deb belgilandi"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: message,
+		Data:    view,
+	})
+}
+
+// POST /api/kds/stream-token - /kds/stream?token= uchun qisqa muddatli token
+func kdsStreamTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	user := findUserByID(uint(userID))
+	if user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User topilmadi",
+		})
+		return
+	}
+
+	token, err := generateKDSStreamToken(user)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Token yaratishda xatolik",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "KDS stream token",
+		Data:    token,
+	})
+}
+
+// GET /api/kds/stream?printer=1&token=... - Server-Sent Events; printer berilmasa barcha hodisalar
+func kdsStreamHandler(w http.ResponseWriter, r *http.Request) {
+	printerID, err := parseOptionalUintQuery(r, "printer")
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Streaming qo'llab-quvvatlanmaydi",
+		})
+		return
+	}
+
+	var printer uint
+	if printerID != nil {
+		printer = *printerID
+	}
+	sub := subscribeKDS(printer)
+	defer unsubscribeKDS(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	// Proksi ulanishni uzib qo'ymasligi uchun vaqti-vaqti bilan izoh qatori
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-sub.events:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// ================= FULFILMENT ROUTES =================
+
+// POST /api/orders/{id}/shipments - qismlab jo'natish va kamomadlarni qayd qilish (admin)
+func recordShipmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid order ID",
+		})
+		return
+	}
+
+	existing := GetOrderByID(uint(id))
+	if existing == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Order topilmadi",
+		})
+		return
+	}
+
+	var req ShipmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid JSON",
+		})
+		return
+	}
+
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	actor := findUserByID(uint(userID))
+	if actor == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User not found",
+		})
+		return
+	}
+
+	order, _, err := RecordShipment(existing.ID, actor, req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("ETag", entityETag("order", order.ID, order.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Jo'natma qayd qilindi",
+		Data:    BuildOrderFulfilment(order),
+	})
+}
+
+// GET /api/orders/{id}/fulfilment - buyurtma qilingan va yetkazilgan miqdorlar
+func getOrderFulfilmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid order ID",
+		})
+		return
+	}
+
+	order := GetOrderByID(uint(id))
+	if order == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Order topilmadi",
+		})
+		return
+	}
+
+	// Qabulni tasdiqlay oladigan har kim (admin, order egasi, shu filial) yetkazilishni ham ko'radi
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	user := findUserByID(uint(userID))
+	if user == nil || !canAccessBranchOrder(user, order) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Bu orderni ko'rish huquqingiz yo'q",
+		})
+		return
+	}
+
+	w.Header().Set("ETag", entityETag("order", order.ID, order.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: "Order yetkazilishi",
+		Data:    BuildOrderFulfilment(order),
+	})
+}
+
+// ================= RECEIPT ROUTES =================
+
+// POST /api/orders/{id}/receipt - filial tovar qabul qilinishini tasdiqlaydi
+func confirmReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Invalid order ID",
+		})
+		return
+	}
+
+	userID, _ := strconv.Atoi(r.Header.Get("User-ID"))
+	user := findUserByID(uint(userID))
+	if user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "User topilmadi",
+		})
+		return
+	}
+
+	existing := GetOrderByID(uint(id))
+	if existing == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Order topilmadi",
+		})
+		return
+	}
+
+	// Order egasi, shu filial xodimi yoki admin
+	if !canAccessBranchOrder(user, existing) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "Bu orderni qabul qilish huquqingiz yo'q",
+		})
+		return
+	}
+
+	// Body bo'sh bo'lsa hammasi to'liq qabul qilingan
+	var req ReceiptRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: "Invalid JSON",
+			})
+			return
+		}
+	}
+
+	order, err := ConfirmOrderReceipt(existing.ID, user, req, r.Header.Get("If-Match"))
+	if writeVersionConflict(w, err) {
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := "Tovar qabul qilindi"
+	if order.Receipt.HasDiscrepancy {
+		message = "Tovar farq bilan qabul qilindi, adminlarga xabar yuborildi"
+	}
+	w.Header().Set("ETag", entityETag("order", order.ID, order.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Message: message,
+		Data:    order,
+	})
+}
+
+// GET /api/receipts/discrepancies?from=&to=&filial_id=&product_id=... - qabuldagi farqlar hisoboti
+func getReceiptDiscrepanciesHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
 
-	filteredOrders := GetFilteredOrders(filialID, status, date)
+	report := GetReceiptDiscrepancies(filter)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Response{
 		Success: true,
-		Message: fmt.Sprintf("Jami %d ta order topildi", len(filteredOrders)),
-		Data:    filteredOrders,
+		Message: fmt.Sprintf("%d ta orderda farq", report.OrderCount),
+		Data:    report,
 	})
 }
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rejalashtirilgan orderlar
+var (
+	scheduledOrders      []ScheduledOrder
+	nextScheduledOrderID uint = 1
+	schedulesMu          sync.Mutex
+)
+
+const (
+	scheduledOrdersFile = "data/scheduled_orders.json"
+	schedulerInterval   = 30 * time.Second
+)
+
+func loadScheduledOrders() {
+	if data, err := ioutil.ReadFile(scheduledOrdersFile); err == nil {
+		json.Unmarshal(data, &scheduledOrders)
+		for i, s := range scheduledOrders {
+			if s.ID >= nextScheduledOrderID {
+				nextScheduledOrderID = s.ID + 1
+			}
+			if s.Status == "active" && s.NextRun == nil {
+				scheduledOrders[i].NextRun = nextScheduleRun(&scheduledOrders[i], time.Now())
+			}
+		}
+	}
+}
+
+func saveScheduledOrders() {
+	data, _ := json.MarshalIndent(scheduledOrders, "", "  ")
+	ioutil.WriteFile(scheduledOrdersFile, data, 0644)
+}
+
+func findScheduledOrderByID(id uint) *ScheduledOrder {
+	for i, s := range scheduledOrders {
+		if s.ID == id {
+			return &scheduledOrders[i]
+		}
+	}
+	return nil
+}
+
+// ISO hafta kuni: 1 - dushanba ... 7 - yakshanba
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+// after dan keyingi birinchi ishga tushish vaqti; nil - boshqa ishga tushmaydi
+func nextScheduleRun(s *ScheduledOrder, after time.Time) *time.Time {
+	if s.Type == "once" {
+		if s.RunAt.After(after) && !slices.Contains(s.SkipDates, s.RunAt.In(businessLocation).Format("2006-01-02")) {
+			runAt := s.RunAt
+			return &runAt
+		}
+		return nil
+	}
+
+	clock, err := time.Parse("15:04", s.TimeOfDay)
+	if err != nil {
+		return nil
+	}
+
+	start := after.In(businessLocation)
+	for i := 0; i <= 366; i++ {
+		day := time.Date(start.Year(), start.Month(), start.Day()+i, clock.Hour(), clock.Minute(), 0, 0, businessLocation)
+		if !day.After(after) {
+			continue
+		}
+		if s.Type == "weekly" && !slices.Contains(s.Weekdays, isoWeekday(day)) {
+			continue
+		}
+		if slices.Contains(s.SkipDates, day.Format("2006-01-02")) {
+			continue
+		}
+		return &day
+	}
+	return nil
+}
+
+func validateScheduledOrder(req ScheduledOrderRequest) error {
+	if len(req.Items) == 0 {
+		return fmt.Errorf("order bo'sh bo'lishi mumkin emas")
+	}
+	if err := sanitizeItemNotes(req.Items); err != nil {
+		return err
+	}
+	if _, err := sanitizeNote(req.Comment, maxOrderCommentLength); err != nil {
+		return err
+	}
+	for _, item := range req.Items {
+		product := findProductByID(item.ProductID)
+		if product == nil {
+			return fmt.Errorf("mahsulot topilmadi: ID %d", item.ProductID)
+		}
+		variant, err := resolveVariant(product, item.VariantID)
+		if err != nil {
+			return err
+		}
+		if err := validateQuantity(variantRules(product, variant), item.Count); err != nil {
+			return err
+		}
+	}
+
+	switch req.Type {
+	case "once":
+		if !req.RunAt.After(time.Now()) {
+			return fmt.Errorf("run_at kelajakdagi vaqt bo'lishi kerak")
+		}
+		// Yetkazib berish vaqti order yaratiladigan paytga nisbatan tekshiriladi
+		if _, err := validateDelivery(req.DeliveryDate, req.DeliverySlotID, req.RunAt); err != nil {
+			return err
+		}
+	case "daily", "weekly":
+		if req.DeliveryDate != "" || req.DeliverySlotID != 0 {
+			return fmt.Errorf("yetkazib berish sanasi faqat bir martalik reja uchun beriladi")
+		}
+		if _, err := time.Parse("15:04", req.TimeOfDay); err != nil {
+			return fmt.Errorf("time_of_day HH:MM formatida bo'lishi kerak")
+		}
+		if req.Type == "weekly" {
+			if len(req.Weekdays) == 0 {
+				return fmt.Errorf("weekly uchun weekdays majburiy")
+			}
+			for _, d := range req.Weekdays {
+				if d < 1 || d > 7 {
+					return fmt.Errorf("weekdays 1 (dushanba) dan 7 (yakshanba) gacha bo'lishi kerak")
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("type faqat once, daily yoki weekly bo'lishi mumkin")
+	}
+	return nil
+}
+
+// ============= CRUD =============
+func CreateScheduledOrder(user *User, req ScheduledOrderRequest) (*ScheduledOrder, error) {
+	if user.FilialID == 0 {
+		return nil, fmt.Errorf("sizga filial belgilanmagan")
+	}
+	if err := validateScheduledOrder(req); err != nil {
+		return nil, err
+	}
+
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+
+	now := time.Now()
+	schedule := ScheduledOrder{
+		ID:       nextScheduledOrderID,
+		Name:     strings.TrimSpace(req.Name),
+		UserID:   user.ID,
+		FilialID: user.FilialID,
+		Status:   "active",
+		Created:  now,
+		Updated:  now,
+		Version:  1,
+	}
+	applyScheduledOrderRequest(&schedule, req)
+	schedule.NextRun = nextScheduleRun(&schedule, now)
+
+	scheduledOrders = append(scheduledOrders, schedule)
+	nextScheduledOrderID++
+	saveScheduledOrders()
+	return &schedule, nil
+}
+
+func applyScheduledOrderRequest(s *ScheduledOrder, req ScheduledOrderRequest) {
+	s.Name = strings.TrimSpace(req.Name)
+	s.Items = req.Items
+	s.Comment, _ = sanitizeNote(req.Comment, maxOrderCommentLength)
+	s.Type = req.Type
+	s.RunAt = time.Time{}
+	s.TimeOfDay = ""
+	s.Weekdays = nil
+	s.DeliveryDate = ""
+	s.DeliverySlotID = 0
+	switch req.Type {
+	case "once":
+		s.RunAt = req.RunAt
+		s.DeliveryDate = req.DeliveryDate
+		s.DeliverySlotID = req.DeliverySlotID
+	case "daily":
+		s.TimeOfDay = req.TimeOfDay
+	case "weekly":
+		s.TimeOfDay = req.TimeOfDay
+		s.Weekdays = req.Weekdays
+	}
+}
+
+// Admin hammasini, user esa o'z filiali rejalarini ko'radi
+func GetScheduledOrdersForUser(user *User) []ScheduledOrder {
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+
+	result := []ScheduledOrder{}
+	for _, s := range scheduledOrders {
+		if user.IsAdmin || s.FilialID == user.FilialID {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func GetScheduledOrderByID(id uint) *ScheduledOrder {
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+
+	if s := findScheduledOrderByID(id); s != nil {
+		result := *s
+		return &result
+	}
+	return nil
+}
+
+func UpdateScheduledOrder(id uint, req ScheduledOrderRequest, ifMatch string) (*ScheduledOrder, error) {
+	if err := validateScheduledOrder(req); err != nil {
+		return nil, err
+	}
+
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+
+	schedule := findScheduledOrderByID(id)
+	if schedule == nil {
+		return nil, fmt.Errorf("reja topilmadi")
+	}
+	if err := checkVersion(ifMatch, entityETag("scheduled-order", schedule.ID, schedule.Version), *schedule); err != nil {
+		return nil, err
+	}
+	applyScheduledOrderRequest(schedule, req)
+	if schedule.Status == "completed" {
+		schedule.Status = "active"
+	}
+	if schedule.Status == "active" {
+		schedule.NextRun = nextScheduleRun(schedule, time.Now())
+	}
+	schedule.Updated = time.Now()
+	schedule.Version++
+	saveScheduledOrders()
+
+	result := *schedule
+	return &result, nil
+}
+
+// Pauza / davom ettirish
+func SetScheduledOrderPaused(id uint, paused bool, ifMatch string) (*ScheduledOrder, error) {
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+
+	schedule := findScheduledOrderByID(id)
+	if schedule == nil {
+		return nil, fmt.Errorf("reja topilmadi")
+	}
+	if err := checkVersion(ifMatch, entityETag("scheduled-order", schedule.ID, schedule.Version), *schedule); err != nil {
+		return nil, err
+	}
+	if schedule.Status == "completed" {
+		return nil, fmt.Errorf("reja allaqachon bajarilgan")
+	}
+
+	if paused {
+		schedule.Status = "paused"
+		schedule.NextRun = nil
+	} else {
+		schedule.Status = "active"
+		schedule.NextRun = nextScheduleRun(schedule, time.Now())
+	}
+	schedule.Updated = time.Now()
+	schedule.Version++
+	saveScheduledOrders()
+
+	result := *schedule
+	return &result, nil
+}
+
+// Bitta kunni o'tkazib yuborish (masalan bayram kuni)
+func SkipScheduledOrderDate(id uint, date string, ifMatch string) (*ScheduledOrder, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, businessLocation)
+	if err != nil {
+		return nil, fmt.Errorf("noto'g'ri sana formati (YYYY-MM-DD): %s", date)
+	}
+	if day.Before(businessDay(time.Now())) {
+		return nil, fmt.Errorf("o'tgan kunni o'tkazib bo'lmaydi")
+	}
+
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+
+	schedule := findScheduledOrderByID(id)
+	if schedule == nil {
+		return nil, fmt.Errorf("reja topilmadi")
+	}
+	if err := checkVersion(ifMatch, entityETag("scheduled-order", schedule.ID, schedule.Version), *schedule); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(schedule.SkipDates, date) {
+		schedule.SkipDates = append(schedule.SkipDates, date)
+	}
+	if schedule.Status == "active" {
+		schedule.NextRun = nextScheduleRun(schedule, time.Now())
+	}
+	schedule.Updated = time.Now()
+	schedule.Version++
+	saveScheduledOrders()
+
+	result := *schedule
+	return &result, nil
+}
+
+func DeleteScheduledOrder(id uint, ifMatch string) (bool, error) {
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+
+	for i, s := range scheduledOrders {
+		if s.ID == id {
+			if err := checkVersion(ifMatch, entityETag("scheduled-order", s.ID, s.Version), s); err != nil {
+				return false, err
+			}
+			scheduledOrders = append(scheduledOrders[:i], scheduledOrders[i+1:]...)
+			saveScheduledOrders()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//////////////////////////////////////////////////////
+// SCHEDULER SERVICE
+//////////////////////////////////////////////////////
+
+// Scheduler - vaqti kelgan rejalardan order yaratadi
+func startSchedulerService() {
+	go func() {
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+		for {
+			runDueScheduledOrders(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+func runDueScheduledOrders(now time.Time) {
+	// Vaqti kelganlarni olib, keyingi vaqtini darhol suramiz - ikki marta ishlamasligi uchun
+	schedulesMu.Lock()
+	var due []ScheduledOrder
+	for i := range scheduledOrders {
+		s := &scheduledOrders[i]
+		if s.Status != "active" || s.NextRun == nil || s.NextRun.After(now) {
+			continue
+		}
+		due = append(due, *s)
+		s.NextRun = nextScheduleRun(s, now)
+		if s.NextRun == nil && s.Type == "once" {
+			s.Status = "completed"
+		}
+	}
+	if len(due) > 0 {
+		saveScheduledOrders()
+	}
+	schedulesMu.Unlock()
+
+	for _, s := range due {
+		orderID, err := materializeScheduledOrder(s)
+
+		schedulesMu.Lock()
+		if schedule := findScheduledOrderByID(s.ID); schedule != nil {
+			runAt := now
+			schedule.LastRun = &runAt
+			schedule.LastOrderID = orderID
+			schedule.LastError = ""
+			if err != nil {
+				schedule.LastError = err.Error()
+			}
+			schedule.Updated = now
+			schedule.Version++
+			saveScheduledOrders()
+		}
+		schedulesMu.Unlock()
+	}
+}
+
+// Reja asosida oddiy CreateOrder orqali order yaratib printerga yuboradi
+func materializeScheduledOrder(s ScheduledOrder) (string, error) {
+	user := findUserByID(s.UserID)
+	if user == nil || user.FilialID != s.FilialID {
+		err := fmt.Errorf("reja egasi topilmadi yoki filiali o'zgargan")
+		notifyScheduledOrderFailed(s, err)
+		return "", err
+	}
+
+	available, skipped := FilterAvailableItems(s.FilialID, s.Items)
+	if len(available) == 0 {
+		err := fmt.Errorf("mahsulotlarning hech biri hozir mavjud emas")
+		notifyScheduledOrderFailed(s, err)
+		return "", err
+	}
+
+	order, err := CreateOrder(s.UserID, CreateOrderRequest{
+		Items:          available,
+		Comment:        s.Comment,
+		DeliveryDate:   s.DeliveryDate,
+		DeliverySlotID: s.DeliverySlotID,
+	})
+	if err != nil {
+		notifyScheduledOrderFailed(s, err)
+		return "", err
+	}
+
+	log.Printf("🗓 Rejalashtirilgan order yaratildi: %s (reja #%d)", order.OrderID, s.ID)
+	if len(skipped) > 0 {
+		log.Printf("⚠️ Reja #%d: mavjud bo'lmagan mahsulotlar tashlab ketildi: %s", s.ID, strings.Join(skipped, ", "))
+	}
+
+	// sendToPrinter Telegram ga ham order xabarini yuboradi
+	if err := dispatchOrder(order); err != nil {
+		return order.OrderID, err
+	}
+	return order.OrderID, nil
+}
+
+func notifyScheduledOrderFailed(s ScheduledOrder, reason error) {
+	log.Printf("❌ Reja #%d bo'yicha order yaratilmadi: %v", s.ID, reason)
+
+	filialName := ""
+	if filial := findFilialByID(s.FilialID); filial != nil {
+		filialName = filial.Name
+	}
+	text := fmt.Sprintf("🗓 *ЗАПЛАНИРОВАННЫЙ ЗАКАЗ НЕ СОЗДАН*\n\n📋 *План:* #%d %s\n🏢 *Ветвь:* %s\n❗ %s",
+		s.ID, escapeMarkdown(s.Name), escapeMarkdown(filialName), escapeMarkdown(reason.Error()))
+	if err := sendTelegramText(text); err != nil {
+		log.Printf("Telegram ga yuborishda xato: %v", err)
+	}
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ombor qoldiqlari va harakatlar tarixi
+var (
+	stockLevels         []StockLevel
+	stockMovements      []StockMovement
+	nextStockMovementID uint = 1
+	stockMu             sync.Mutex
+
+	// Order ID -> mahsulot ID -> shu order bo'yicha yechilgan miqdor (harakatlar tarixidan).
+	// Har bir order o'zgarishida butun tarixni qayta o'qimaslik uchun.
+	orderStockConsumed = make(map[uint]map[uint]orderConsumption)
+)
+
+// Order bo'yicha bitta mahsulotdan yechilgan miqdor va qaysi qoldiqdan (FilialID, 0 - markaziy)
+type orderConsumption struct {
+	quantity Decimal
+	filialID uint
+}
+
+const (
+	stockFile          = "data/stock.json"
+	stockMovementsFile = "data/stock_movements.json"
+	maxStockReasonSize = 500
+)
+
+// Bu statusda order qoldiqdan yechilmagan (qaytarilgan) hisoblanadi.
+// Qoldiq order yaratilganda band qilinadi, shuning uchun "pending" ham yechilgan hisoblanadi.
+var stockReleasedStatuses = []string{"cancelled"}
+
+func loadStock() {
+	if data, err := ioutil.ReadFile(stockFile); err == nil {
+		json.Unmarshal(data, &stockLevels)
+	}
+	if data, err := ioutil.ReadFile(stockMovementsFile); err == nil {
+		json.Unmarshal(data, &stockMovements)
+		for _, m := range stockMovements {
+			if m.ID >= nextStockMovementID {
+				nextStockMovementID = m.ID + 1
+			}
+			indexOrderMovement(m)
+		}
+	}
+}
+
+func saveStock() {
+	data, _ := json.MarshalIndent(stockLevels, "", "  ")
+	ioutil.WriteFile(stockFile, data, 0644)
+	data, _ = json.MarshalIndent(stockMovements, "", "  ")
+	ioutil.WriteFile(stockMovementsFile, data, 0644)
+}
+
+// Order harakatini orderStockConsumed ga qo'shadi (stockMu ostida yoki yuklashda)
+func indexOrderMovement(m StockMovement) {
+	if m.Type != "order" || m.OrderID == 0 {
+		return
+	}
+	consumed := orderStockConsumed[m.OrderID]
+	if consumed == nil {
+		consumed = make(map[uint]orderConsumption)
+		orderStockConsumed[m.OrderID] = consumed
+	}
+	entry := consumed[m.ProductID]
+	entry.quantity = entry.quantity.Sub(m.Change)
+	entry.filialID = m.FilialID
+	consumed[m.ProductID] = entry
+}
+
+func findStockLevel(productID, filialID uint) *StockLevel {
+	for i, level := range stockLevels {
+		if level.ProductID == productID && level.FilialID == filialID {
+			return &stockLevels[i]
+		}
+	}
+	return nil
+}
+
+// Filial orderi qaysi qoldiqdan yechiladi: filialning o'z qoldig'i, bo'lmasa markaziy oshxona.
+// nil - mahsulot qoldig'i kuzatilmaydi (cheklanmagan).
+func stockLevelFor(productID, filialID uint) *StockLevel {
+	if level := findStockLevel(productID, filialID); level != nil {
+		return level
+	}
+	return findStockLevel(productID, 0)
+}
+
+// Mahsulot qoldig'i biror joyda kuzatiladimi
+func productStockTracked(productID uint) bool {
+	stockMu.Lock()
+	defer stockMu.Unlock()
+
+	return slices.ContainsFunc(stockLevels, func(level StockLevel) bool { return level.ProductID == productID })
+}
+
+// Filial uchun mavjud qoldiq; tracked = false bo'lsa cheklov yo'q
+func AvailableStock(productID, filialID uint) (quantity Decimal, tracked bool) {
+	stockMu.Lock()
+	defer stockMu.Unlock()
+
+	level := stockLevelFor(productID, filialID)
+	if level == nil {
+		return 0, false
+	}
+	return level.Quantity, true
+}
+
+func checkStock(product *Product, filialID uint, count Decimal) error {
+	available, tracked := AvailableStock(product.ID, filialID)
+	if !tracked || available >= count {
+		return nil
+	}
+	return stockShortageError(product, available)
+}
+
+func stockShortageError(product *Product, available Decimal) error {
+	if available <= 0 {
+		return fmt.Errorf("%s omborda qolmagan", product.Name)
+	}
+	return fmt.Errorf("%s omborda yetarli emas (qoldiq %s)", product.Name, formatQuantityWithUnit(available, product.Type))
+}
+
+type lowStockAlert struct {
+	level     StockLevel
+	before    Decimal
+	orderName string
+}
+
+// Qoldiqni o'zgartirib harakatni yozadi (stockMu ostida chaqiriladi).
+// Chegaradan pastga tushsa ogohlantirish qaytaradi.
+func applyStockChange(level *StockLevel, movement StockMovement) *lowStockAlert {
+	before := level.Quantity
+	level.Quantity = level.Quantity.Add(movement.Change)
+	level.Updated = time.Now()
+	level.Version++
+
+	movement.ID = nextStockMovementID
+	movement.ProductID = level.ProductID
+	movement.FilialID = level.FilialID
+	movement.Balance = level.Quantity
+	movement.Created = level.Updated
+	stockMovements = append(stockMovements, movement)
+	nextStockMovementID++
+	indexOrderMovement(movement)
+
+	crossedThreshold := level.LowThreshold > 0 && before > level.LowThreshold && level.Quantity <= level.LowThreshold
+	ranOut := before > 0 && level.Quantity <= 0
+	if crossedThreshold || ranOut {
+		return &lowStockAlert{level: *level, before: before}
+	}
+	return nil
+}
+
+// Order bo'yicha bitta mahsulot qoldig'idagi o'zgarish
+type orderStockChange struct {
+	productID uint
+	level     *StockLevel
+	diff      Decimal // musbat - yechiladi, manfiy - qaytariladi
+}
+
+// Order holatiga qarab qoldiq qancha o'zgarishi kerak: tasdiqlangan order itemlari yechiladi,
+// tahrirlangan order farqi qo'shiladi/ayiriladi, bekor qilinganda (yoki kamomad bo'lsa) qaytariladi.
+// stockMu ostida chaqiriladi.
+func planOrderStock(order *Order) []orderStockChange {
+	desired := make(map[uint]Decimal)
+	if !slices.Contains(stockReleasedStatuses, order.Status) {
+		for _, item := range order.Items {
+			desired[item.ProductID] = desired[item.ProductID].Add(expectedCount(item))
+		}
+	}
+
+	// Shu order bo'yicha avval yechilgan miqdor va qaysi qoldiqdan
+	consumed := orderStockConsumed[order.ID]
+
+	productIDs := make([]uint, 0, len(desired)+len(consumed))
+	for productID := range desired {
+		productIDs = append(productIDs, productID)
+	}
+	for productID := range consumed {
+		if _, ok := desired[productID]; !ok {
+			productIDs = append(productIDs, productID)
+		}
+	}
+	slices.Sort(productIDs)
+
+	var changes []orderStockChange
+	for _, productID := range productIDs {
+		used, ok := consumed[productID]
+		diff := desired[productID].Sub(used.quantity)
+		if diff.IsZero() {
+			continue
+		}
+
+		var level *StockLevel
+		if ok {
+			level = findStockLevel(productID, used.filialID)
+		} else {
+			level = stockLevelFor(productID, order.FilialID)
+		}
+		if level == nil {
+			continue
+		}
+		changes = append(changes, orderStockChange{productID: productID, level: level, diff: diff})
+	}
+	return changes
+}
+
+// Yechiladigan miqdorlar uchun qoldiq yetarlimi (stockMu ostida)
+func checkOrderStockChanges(changes []orderStockChange) error {
+	for _, c := range changes {
+		if c.diff <= 0 || c.level.Quantity >= c.diff {
+			continue
+		}
+		product := findProductByID(c.productID)
+		if product == nil {
+			return fmt.Errorf("mahsulot ID %d omborda yetarli emas", c.productID)
+		}
+		return stockShortageError(product, c.level.Quantity)
+	}
+	return nil
+}
+
+// Rejalashtirilgan o'zgarishlarni qoldiqqa yozadi (stockMu ostida)
+func applyOrderStockChanges(order *Order, changes []orderStockChange) {
+	var alerts []lowStockAlert
+	for _, c := range changes {
+		alert := applyStockChange(c.level, StockMovement{
+			Type:    "order",
+			Change:  -c.diff,
+			Reason:  fmt.Sprintf("Order %s (%s)", order.OrderID, order.Status),
+			OrderID: order.ID,
+			UserID:  order.UserID,
+		})
+		if alert != nil {
+			alert.orderName = order.OrderID
+			alerts = append(alerts, *alert)
+		}
+	}
+
+	if len(changes) > 0 {
+		saveStock()
+	}
+	if len(alerts) > 0 {
+		// Telegram so'rovi order lockini ushlab turmasligi uchun alohida
+		go notifyLowStock(alerts)
+	}
+}
+
+// Order holati o'zgargandan keyin qoldiqni moslaydi (yetishmasa ham yechiladi)
+func syncOrderStock(order *Order) {
+	stockMu.Lock()
+	defer stockMu.Unlock()
+
+	applyOrderStockChanges(order, planOrderStock(order))
+}
+
+// Qoldiqni tekshirish va band qilish bitta stockMu ostida - parallel orderlar
+// qoldiqdan ortiq sotolmaydi. Qoldiq yetmasa hech narsa o'zgarmaydi.
+func reserveOrderStock(order *Order) error {
+	stockMu.Lock()
+	defer stockMu.Unlock()
+
+	changes := planOrderStock(order)
+	if err := checkOrderStockChanges(changes); err != nil {
+		return err
+	}
+	applyOrderStockChanges(order, changes)
+	return nil
+}
+
+func notifyLowStock(alerts []lowStockAlert) {
+	var text strings.Builder
+	text.WriteString("📉 *МАЛО ТОВАРА НА СКЛАДЕ*\n")
+	for _, alert := range alerts {
+		productName := fmt.Sprintf("ID %d", alert.level.ProductID)
+		productType := ""
+		if product := findProductByID(alert.level.ProductID); product != nil {
+			productName = product.Name
+			productType = product.Type
+		}
+		location := "Центральная кухня"
+		if filial := findFilialByID(alert.level.FilialID); filial != nil {
+			location = filial.Name
+		}
+
+		text.WriteString(fmt.Sprintf("\n🔸 *%s* (%s)\n", productName, location))
+		if alert.level.Quantity <= 0 {
+			text.WriteString("   ❌ Закончился\n")
+		} else {
+			text.WriteString(fmt.Sprintf("   Остаток: %s (порог %s)\n",
+				formatQuantityWithUnit(alert.level.Quantity, productType),
+				formatQuantityWithUnit(alert.level.LowThreshold, productType)))
+		}
+		if alert.orderName != "" {
+			text.WriteString(fmt.Sprintf("   📋 Заказ: `%s`\n", alert.orderName))
+		}
+		log.Printf("📉 Qoldiq kam: %s (%s) - %s", productName, location, alert.level.Quantity)
+	}
+
+	if err := sendTelegramText(text.String()); err != nil {
+		log.Printf("Telegram ga yuborishda xato: %v", err)
+	}
+}
+
+func validateStockTarget(productID, filialID uint) (*Product, error) {
+	product := findProductByID(productID)
+	if product == nil {
+		return nil, fmt.Errorf("mahsulot topilmadi")
+	}
+	if filialID != 0 && findFilialByID(filialID) == nil {
+		return nil, fmt.Errorf("filial topilmadi")
+	}
+	if err := checkVariantUnitsForStock(product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// ============= KIRIM / TUZATISH =============
+
+// Kirim: qoldiq yozuvi bo'lmasa yaratiladi (shu paytdan boshlab kuzatiladi)
+func Restock(req RestockRequest, userID uint) (*StockLevel, error) {
+	product, err := validateStockTarget(req.ProductID, req.FilialID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Quantity <= 0 {
+		return nil, fmt.Errorf("kirim miqdori 0 dan katta bo'lishi kerak")
+	}
+	if !req.Quantity.IsMultipleOf(unitPrecision(product.Type)) {
+		return nil, fmt.Errorf("miqdor %s birligiga mos emas", product.Type)
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > maxStockReasonSize {
+		return nil, fmt.Errorf("sabab %d belgidan oshmasligi kerak", maxStockReasonSize)
+	}
+
+	stockMu.Lock()
+	defer stockMu.Unlock()
+
+	level := findStockLevel(req.ProductID, req.FilialID)
+	if level == nil {
+		stockLevels = append(stockLevels, StockLevel{ProductID: req.ProductID, FilialID: req.FilialID})
+		level = &stockLevels[len(stockLevels)-1]
+	}
+	applyStockChange(level, StockMovement{
+		Type:   "restock",
+		Change: req.Quantity,
+		Reason: reason,
+		UserID: userID,
+	})
+	saveStock()
+
+	result := *level
+	return &result, nil
+}
+
+// Tuzatish (inventarizatsiya, buzilgan mahsulot va h.k.) - sabab majburiy
+func AdjustStock(req StockAdjustRequest, userID uint) (*StockLevel, error) {
+	product, err := validateStockTarget(req.ProductID, req.FilialID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Change.IsZero() {
+		return nil, fmt.Errorf("change 0 bo'lishi mumkin emas")
+	}
+	if !req.Change.IsMultipleOf(unitPrecision(product.Type)) {
+		return nil, fmt.Errorf("miqdor %s birligiga mos emas", product.Type)
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, fmt.Errorf("tuzatish sababi majburiy")
+	}
+	if len(reason) > maxStockReasonSize {
+		return nil, fmt.Errorf("sabab %d belgidan oshmasligi kerak", maxStockReasonSize)
+	}
+
+	stockMu.Lock()
+	defer stockMu.Unlock()
+
+	level := findStockLevel(req.ProductID, req.FilialID)
+	if level == nil {
+		return nil, fmt.Errorf("bu mahsulot qoldig'i kuzatilmaydi, avval kirim qiling")
+	}
+	if level.Quantity.Add(req.Change) < 0 {
+		return nil, fmt.Errorf("qoldiq manfiy bo'lib qoladi (hozir %s)", formatQuantityWithUnit(level.Quantity, product.Type))
+	}
+
+	alert := applyStockChange(level, StockMovement{
+		Type:   "adjust",
+		Change: req.Change,
+		Reason: reason,
+		UserID: userID,
+	})
+	saveStock()
+	if alert != nil {
+		go notifyLowStock([]lowStockAlert{*alert})
+	}
+
+	result := *level
+	return &result, nil
+}
+
+func SetStockThreshold(req StockThresholdRequest) (*StockLevel, error) {
+	if _, err := validateStockTarget(req.ProductID, req.FilialID); err != nil {
+		return nil, err
+	}
+	if req.LowThreshold < 0 {
+		return nil, fmt.Errorf("low_threshold manfiy bo'lishi mumkin emas")
+	}
+
+	stockMu.Lock()
+	defer stockMu.Unlock()
+
+	level := findStockLevel(req.ProductID, req.FilialID)
+	if level == nil {
+		return nil, fmt.Errorf("bu mahsulot qoldig'i kuzatilmaydi, avval kirim qiling")
+	}
+	level.LowThreshold = req.LowThreshold
+	level.Updated = time.Now()
+	level.Version++
+	saveStock()
+
+	result := *level
+	return &result, nil
+}
+
+// Qoldiqni kuzatishni to'xtatish - mahsulot yana cheklanmagan bo'ladi
+func DeleteStockLevel(productID, filialID uint) bool {
+	stockMu.Lock()
+	defer stockMu.Unlock()
+
+	for i, level := range stockLevels {
+		if level.ProductID == productID && level.FilialID == filialID {
+			stockLevels = slices.Delete(stockLevels, i, i+1)
+			saveStock()
+			return true
+		}
+	}
+	return false
+}
+
+// filialID nil - barcha qoldiqlar
+func GetStockLevels(filialID *uint) []StockLevelDetails {
+	stockMu.Lock()
+	defer stockMu.Unlock()
+
+	result := []StockLevelDetails{}
+	for _, level := range stockLevels {
+		if filialID != nil && level.FilialID != *filialID {
+			continue
+		}
+		details := StockLevelDetails{
+			StockLevel:  level,
+			FilialName:  "Markaziy oshxona",
+			ProductName: fmt.Sprintf("ID %d", level.ProductID),
+			Low:         level.Quantity <= 0 || (level.LowThreshold > 0 && level.Quantity <= level.LowThreshold),
+		}
+		if product := findProductByID(level.ProductID); product != nil {
+			details.ProductName = product.Name
+			details.Type = product.Type
+		}
+		if filial := findFilialByID(level.FilialID); filial != nil {
+			details.FilialName = filial.Name
+		}
+		result = append(result, details)
+	}
+	return result
+}
+
+// Eng yangilari birinchi; productID/filialID nil - filter yo'q
+func GetStockMovements(productID, filialID *uint, limit int) []StockMovement {
+	stockMu.Lock()
+	defer stockMu.Unlock()
+
+	result := []StockMovement{}
+	for i := len(stockMovements) - 1; i >= 0 && len(result) < limit; i-- {
+		m := stockMovements[i]
+		if productID != nil && m.ProductID != *productID {
+			continue
+		}
+		if filialID != nil && m.FilialID != *filialID {
+			continue
+		}
+		result = append(result, m)
+	}
+	return result
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+)
+
+// Markaziy oshxonada 1-mahsulotdan qoldiq bilan test ma'lumotlari
+func setupStockTestData(t *testing.T, quantity int64) {
+	setupOrderTestData(t, "{date}-{seq}")
+	stockLevels = []StockLevel{{ProductID: 1, FilialID: 0, Quantity: NewDecimal(quantity)}}
+	stockMovements = nil
+	nextStockMovementID = 1
+	orderStockConsumed = make(map[uint]map[uint]orderConsumption)
+	t.Cleanup(func() {
+		stockLevels, stockMovements = nil, nil
+		orderStockConsumed = make(map[uint]map[uint]orderConsumption)
+	})
+}
+
+func assertStock(t *testing.T, want int64) {
+	t.Helper()
+	if got, _ := AvailableStock(1, 1); got != NewDecimal(want) {
+		t.Fatalf("qoldiq %s, kutilgan %d", got, want)
+	}
+}
+
+func createStockTestOrder(t *testing.T, count int64) *Order {
+	t.Helper()
+	order, err := CreateOrder(1, CreateOrderRequest{
+		Items: []CreateOrderItem{{ProductID: 1, Count: NewDecimal(count)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+var stockTestAdmin = &User{ID: 1, Name: "admin", IsAdmin: true}
+
+func TestOrderStockReservedOnCreate(t *testing.T) {
+	setupStockTestData(t, 10)
+
+	createStockTestOrder(t, 4)
+	assertStock(t, 6)
+
+	// Qoldiqdan ko'p - order yaratilmaydi va qoldiq o'zgarmaydi
+	if _, err := CreateOrder(1, CreateOrderRequest{
+		Items: []CreateOrderItem{{ProductID: 1, Count: NewDecimal(7)}},
+	}); err == nil {
+		t.Fatal("qoldiqdan ko'p order qabul qilindi")
+	}
+	assertStock(t, 6)
+	if len(orders) != 1 {
+		t.Fatalf("%d ta order, kutilgan 1", len(orders))
+	}
+}
+
+func TestOrderStockAmendDeltas(t *testing.T) {
+	setupStockTestData(t, 10)
+	order := createStockTestOrder(t, 4)
+
+	amend := func(count int64) error {
+		_, _, err := AmendOrder(order.ID, stockTestAdmin, AmendOrderRequest{
+			Items: []AmendOrderItem{{ProductID: 1, Count: NewDecimal(count)}},
+		}, "")
+		return err
+	}
+
+	if err := amend(6); err != nil {
+		t.Fatal(err)
+	}
+	assertStock(t, 4)
+
+	if err := amend(2); err != nil {
+		t.Fatal(err)
+	}
+	assertStock(t, 8)
+
+	// Ko'paytirish qoldiqdan oshsa rad etiladi, order va qoldiq o'zgarmaydi
+	if err := amend(11); err == nil {
+		t.Fatal("qoldiqdan ko'p o'zgartirish qabul qilindi")
+	}
+	assertStock(t, 8)
+	if got := GetOrderByID(order.ID).Items[0].Count; got != NewDecimal(2) {
+		t.Fatalf("order miqdori %s, kutilgan 2", got)
+	}
+}
+
+func TestOrderStockReleasedOnCancel(t *testing.T) {
+	setupStockTestData(t, 10)
+	order := createStockTestOrder(t, 4)
+
+	if _, _, err := CancelOrder(order.ID, stockTestAdmin, "test", ""); err != nil {
+		t.Fatal(err)
+	}
+	assertStock(t, 10)
+
+	// Qayta sinxronlash ikkinchi marta qaytarmaydi
+	syncOrderStock(GetOrderByID(order.ID))
+	assertStock(t, 10)
+}
+
+func TestOrderStockShortageReturned(t *testing.T) {
+	setupStockTestData(t, 10)
+	order := createStockTestOrder(t, 5)
+	assertStock(t, 5)
+
+	_, _, err := RecordShipment(order.ID, stockTestAdmin, ShipmentRequest{
+		Items: []ShipmentLineRequest{{ProductID: 1, Count: NewDecimal(3), Short: true, Reason: "yetmadi"}},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2 dona kamomad qoldiqqa qaytadi
+	assertStock(t, 7)
+}
+
+// Yuklashda harakatlar tarixidan qurilgan indeks ish vaqtidagisi bilan bir xil
+func TestOrderStockConsumedIndexRebuilt(t *testing.T) {
+	setupStockTestData(t, 10)
+	order := createStockTestOrder(t, 4)
+	if _, _, err := AmendOrder(order.ID, stockTestAdmin, AmendOrderRequest{
+		Items: []AmendOrderItem{{ProductID: 1, Count: NewDecimal(3)}},
+	}, ""); err != nil {
+		t.Fatal(err)
+	}
+	saveStock()
+
+	stockLevels, stockMovements = nil, nil
+	orderStockConsumed = make(map[uint]map[uint]orderConsumption)
+	loadStock()
+
+	if got := orderStockConsumed[order.ID][1].quantity; got != NewDecimal(3) {
+		t.Fatalf("indeksdagi yechilgan miqdor %s, kutilgan 3", got)
+	}
+	stockMu.Lock()
+	changes := planOrderStock(GetOrderByID(order.ID))
+	stockMu.Unlock()
+	if len(changes) != 0 {
+		t.Fatalf("qayta yuklangandan keyin keraksiz o'zgarishlar: %+v", changes)
+	}
+	assertStock(t, 7)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stop-list: vaqtincha mavjud bo'lmagan mahsulotlar. Muddati o'tgan yozuvlar
+// avtomatik kuchini yo'qotadi va keyingi saqlashda o'chiriladi.
+var (
+	stopList       []StopListEntry
+	nextStopListID uint = 1
+	stopListMu     sync.Mutex
+)
+
+const (
+	stopListFile          = "data/stop_list.json"
+	maxStopListReasonSize = 500
+)
+
+func loadStopList() {
+	if data, err := ioutil.ReadFile(stopListFile); err == nil {
+		json.Unmarshal(data, &stopList)
+		for _, entry := range stopList {
+			if entry.ID >= nextStopListID {
+				nextStopListID = entry.ID + 1
+			}
+		}
+	}
+}
+
+// Muddati o'tganlarni tashlab saqlaydi (stopListMu ostida chaqiriladi)
+func saveStopList() {
+	now := time.Now()
+	stopList = slices.DeleteFunc(stopList, func(entry StopListEntry) bool {
+		return !entry.Until.After(now)
+	})
+	data, _ := json.MarshalIndent(stopList, "", "  ")
+	ioutil.WriteFile(stopListFile, data, 0644)
+}
+
+// Mahsulot filial uchun hozir stop-listdami; bir nechta bo'lsa eng uzog'i
+func ActiveStop(productID, filialID uint, now time.Time) *StopListEntry {
+	stopListMu.Lock()
+	defer stopListMu.Unlock()
+
+	var active *StopListEntry
+	for i, entry := range stopList {
+		if entry.ProductID != productID || (entry.FilialID != 0 && entry.FilialID != filialID) {
+			continue
+		}
+		if !entry.Until.After(now) {
+			continue
+		}
+		if active == nil || entry.Until.After(active.Until) {
+			found := stopList[i]
+			active = &found
+		}
+	}
+	return active
+}
+
+func checkStopList(product *Product, filialID uint, now time.Time) error {
+	stop := ActiveStop(product.ID, filialID, now)
+	if stop == nil {
+		return nil
+	}
+	return fmt.Errorf("%s vaqtincha mavjud emas (%s gacha)", product.Name, stop.Until.In(businessLocation).Format("02.01.2006 15:04"))
+}
+
+func AddToStopList(req StopListRequest, userID uint) (*StopListEntry, error) {
+	if findProductByID(req.ProductID) == nil {
+		return nil, fmt.Errorf("mahsulot topilmadi")
+	}
+	if req.FilialID != 0 && findFilialByID(req.FilialID) == nil {
+		return nil, fmt.Errorf("filial topilmadi")
+	}
+
+	now := time.Now()
+	until := req.Until
+	if until.IsZero() {
+		// Default - joriy biznes kun oxirigacha
+		until = businessDayStart(businessDay(now).AddDate(0, 0, 1))
+	}
+	if !until.After(now) {
+		return nil, fmt.Errorf("until kelajakdagi vaqt bo'lishi kerak")
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > maxStopListReasonSize {
+		return nil, fmt.Errorf("sabab %d belgidan oshmasligi kerak", maxStopListReasonSize)
+	}
+
+	stopListMu.Lock()
+	defer stopListMu.Unlock()
+
+	entry := StopListEntry{
+		ID:        nextStopListID,
+		ProductID: req.ProductID,
+		FilialID:  req.FilialID,
+		Until:     until,
+		Reason:    reason,
+		CreatedBy: userID,
+		Created:   now,
+		Version:   1,
+	}
+	stopList = append(stopList, entry)
+	nextStopListID++
+	saveStopList()
+	return &entry, nil
+}
+
+// Faqat amaldagi yozuvlar; filialID nil - barchasi
+func GetActiveStopList(filialID *uint) []StopListEntryDetails {
+	stopListMu.Lock()
+	defer stopListMu.Unlock()
+
+	now := time.Now()
+	result := []StopListEntryDetails{}
+	for _, entry := range stopList {
+		if !entry.Until.After(now) {
+			continue
+		}
+		if filialID != nil && entry.FilialID != *filialID {
+			continue
+		}
+		details := StopListEntryDetails{
+			StopListEntry: entry,
+			ProductName:   fmt.Sprintf("ID %d", entry.ProductID),
+			FilialName:    "Barcha filiallar",
+		}
+		if product := findProductByID(entry.ProductID); product != nil {
+			details.ProductName = product.Name
+		}
+		if filial := findFilialByID(entry.FilialID); filial != nil {
+			details.FilialName = filial.Name
+		}
+		result = append(result, details)
+	}
+	return result
+}
+
+func RemoveFromStopList(id uint) bool {
+	stopListMu.Lock()
+	defer stopListMu.Unlock()
+
+	for i, entry := range stopList {
+		if entry.ID == id {
+			stopList = slices.Delete(stopList, i, i+1)
+			saveStopList()
+			return true
+		}
+	}
+	return false
+}
+
+// Stop-listni tozalash; productID nil - hammasi. O'chirilganlar sonini qaytaradi.
+func ClearStopList(productID *uint) int {
+	stopListMu.Lock()
+	defer stopListMu.Unlock()
+
+	before := len(stopList)
+	stopList = slices.DeleteFunc(stopList, func(entry StopListEntry) bool {
+		return productID == nil || entry.ProductID == *productID
+	})
+	removed := before - len(stopList)
+	saveStopList()
+	return removed
+}
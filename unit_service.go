@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// O'lchov birliklari: Product.Type qiymati shu ro'yxatdagi nom yoki taxalluslardan biri bo'ladi
+type Unit struct {
+	Code     string   `json:"code"`
+	Name     string   `json:"name"`
+	Decimals int      `json:"decimals"` // ruxsat etilgan kasr xonalar soni
+	Aliases  []string `json:"aliases"`
+}
+
+var units = []Unit{
+	{Code: "kg", Name: "Kilogramm", Decimals: 3, Aliases: []string{"kg", "кг", "kilo", "kilogramm"}},
+	{Code: "g", Name: "Gramm", Decimals: 0, Aliases: []string{"g", "gr", "г", "гр", "gramm"}},
+	{Code: "l", Name: "Litr", Decimals: 3, Aliases: []string{"l", "л", "litr", "литр"}},
+	{Code: "ml", Name: "Millilitr", Decimals: 0, Aliases: []string{"ml", "мл"}},
+	{Code: "pcs", Name: "Dona", Decimals: 0, Aliases: []string{"pcs", "dona", "ta", "шт", "штук"}},
+	{Code: "box", Name: "Quti", Decimals: 0, Aliases: []string{"box", "quti", "коробка", "кор"}},
+	{Code: "pack", Name: "Paket", Decimals: 0, Aliases: []string{"pack", "paket", "упаковка", "уп"}},
+}
+
+// Noma'lum birlik uchun (eski mahsulotlar) - 3 xona kasrgacha
+const defaultUnitDecimals = 3
+
+func resolveUnit(productType string) *Unit {
+	key := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(productType)), ".")
+	for i, u := range units {
+		for _, alias := range u.Aliases {
+			if alias == key {
+				return &units[i]
+			}
+		}
+	}
+	return nil
+}
+
+func unitDecimals(productType string) int {
+	if unit := resolveUnit(productType); unit != nil {
+		return unit.Decimals
+	}
+	return defaultUnitDecimals
+}
+
+// Birlik kasr xonalari uchun eng kichik qadam: 0 xona -> 1, 3 xona -> 0.001
+func unitPrecision(productType string) Decimal {
+	return Decimal(math.Pow10(decimalPlaces - unitDecimals(productType)))
+}
+
+// Mahsulot birligi va min/max/step qoidalari bo'yicha miqdorni tekshirish
+func validateQuantity(product *Product, count Decimal) error {
+	if count <= 0 {
+		return fmt.Errorf("mahsulot soni 0 dan katta bo'lishi kerak")
+	}
+
+	if !count.IsMultipleOf(unitPrecision(product.Type)) {
+		decimals := unitDecimals(product.Type)
+		if decimals == 0 {
+			return fmt.Errorf("%s miqdori butun son bo'lishi kerak (%s)", product.Name, product.Type)
+		}
+		return fmt.Errorf("%s miqdori ko'pi bilan %d xona kasr bo'lishi mumkin", product.Name, decimals)
+	}
+
+	if product.MinQty > 0 && count < product.MinQty {
+		return fmt.Errorf("%s uchun eng kam miqdor %s", product.Name, formatQuantityWithUnit(product.MinQty, product.Type))
+	}
+	if product.MaxQty > 0 && count > product.MaxQty {
+		return fmt.Errorf("%s uchun eng ko'p miqdor %s", product.Name, formatQuantityWithUnit(product.MaxQty, product.Type))
+	}
+	if product.Step > 0 && !count.IsMultipleOf(product.Step) {
+		return fmt.Errorf("%s miqdori %s ga karrali bo'lishi kerak", product.Name, formatQuantityWithUnit(product.Step, product.Type))
+	}
+	return nil
+}
+
+func validateQuantityRules(productType string, minQty, maxQty, step Decimal) error {
+	if minQty < 0 || maxQty < 0 || step < 0 {
+		return fmt.Errorf("min_qty, max_qty va step manfiy bo'lishi mumkin emas")
+	}
+	if maxQty > 0 && minQty > maxQty {
+		return fmt.Errorf("min_qty max_qty dan katta bo'lishi mumkin emas")
+	}
+	if step > 0 && !step.IsMultipleOf(unitPrecision(productType)) {
+		return fmt.Errorf("step %s birligiga mos emas", productType)
+	}
+	return nil
+}
+
+// Miqdorni birlik kasr xonalari bo'yicha chiqarish: 3 -> "3", 1.500 -> "1.5"
+func formatQuantity(count Decimal, productType string) string {
+	return count.Round(unitDecimals(productType)).String()
+}
+
+// Chek va Telegram uchun: "1.5 kg"
+func formatQuantityWithUnit(count Decimal, productType string) string {
+	return strings.TrimSpace(formatQuantity(count, productType) + " " + productType)
+}
+
+func unitCode(productType string) string {
+	if unit := resolveUnit(productType); unit != nil {
+		return unit.Code
+	}
+	return ""
+}
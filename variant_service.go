@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mahsulot variantlari (o'lcham, nachinka va h.k.). Variantli mahsulotni faqat
+// variant tanlab buyurtma qilish mumkin; birlik va miqdor qoidalari variantda
+// berilmagan bo'lsa mahsulotnikidan olinadi.
+
+func findVariant(product *Product, variantID uint) *ProductVariant {
+	for i, v := range product.Variants {
+		if v.ID == variantID {
+			return &product.Variants[i]
+		}
+	}
+	return nil
+}
+
+// Order qatoridagi variantni tekshiradi: variantli mahsulotda variant_id majburiy,
+// variantsiz mahsulotda esa berilmasligi kerak
+func resolveVariant(product *Product, variantID uint) (*ProductVariant, error) {
+	if len(product.Variants) == 0 {
+		if variantID != 0 {
+			return nil, fmt.Errorf("mahsulot %s variantlarga ega emas", product.Name)
+		}
+		return nil, nil
+	}
+	if variantID == 0 {
+		return nil, fmt.Errorf("mahsulot %s uchun variant tanlanishi kerak", product.Name)
+	}
+	variant := findVariant(product, variantID)
+	if variant == nil {
+		return nil, fmt.Errorf("mahsulot %s uchun variant topilmadi: ID %d", product.Name, variantID)
+	}
+	return variant, nil
+}
+
+// Variant birligi va miqdor qoidalari qo'llangan mahsulot nusxasi (validateQuantity uchun)
+func variantRules(product *Product, variant *ProductVariant) *Product {
+	rules := *product
+	if variant == nil {
+		return &rules
+	}
+	rules.Name = itemLabel(product.Name, variant.Name)
+	if variant.Type != "" {
+		rules.Type = variant.Type
+		rules.MinQty, rules.MaxQty, rules.Step = 0, 0, 0
+	}
+	if variant.MinQty > 0 {
+		rules.MinQty = variant.MinQty
+	}
+	if variant.MaxQty > 0 {
+		rules.MaxQty = variant.MaxQty
+	}
+	if variant.Step > 0 {
+		rules.Step = variant.Step
+	}
+	return &rules
+}
+
+// Order qatori: variant bo'lsa uning birligi va narxi
+func newOrderItem(product *Product, variant *ProductVariant, count Decimal) OrderItem {
+	item := OrderItem{
+		ProductID: product.ID,
+		Name:      product.Name,
+		Type:      product.Type,
+		Count:     count,
+		Price:     product.Price,
+	}
+	if variant != nil {
+		item.VariantID = variant.ID
+		item.VariantName = variant.Name
+		item.Price = variant.Price
+		if variant.Type != "" {
+			item.Type = variant.Type
+		}
+	}
+	item.Subtotal = count.Mul(item.Price)
+	return item
+}
+
+func orderTotal(items []OrderItem) Decimal {
+	var total Decimal
+	for _, item := range items {
+		total = total.Add(item.Subtotal)
+	}
+	return total
+}
+
+// Chek va Telegram uchun: "Pishiriq (Katta)"
+func itemLabel(name, variantName string) string {
+	if variantName == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, variantName)
+}
+
+// Order qatorini mahsulot + variant bo'yicha aniqlash uchun kalit
+type orderLineKey struct {
+	ProductID uint
+	VariantID uint
+}
+
+func lineKey(productID, variantID uint) orderLineKey {
+	return orderLineKey{ProductID: productID, VariantID: variantID}
+}
+
+// So'rovdagi variantlarni tekshiradi va yangilariga product.NextVariantID dan ID beradi
+// (o'chirilgan variantlarning ID lari qayta ishlatilmaydi). Qaytgan nextID mahsulotga saqlanadi.
+// Qoldig'i kuzatiladigan mahsulot variantlari mahsulot birligida bo'lishi kerak -
+// qoldiq mahsulot bo'yicha yuritiladi va turli birliklar qo'shilib ketmasligi kerak.
+// catalogMu ostida chaqiriladi.
+func normalizeVariants(product *Product, productType string, incoming []ProductVariant) ([]ProductVariant, uint, error) {
+	nextID := max(product.NextVariantID, 1)
+	known := make(map[uint]bool)
+	for _, v := range product.Variants {
+		known[v.ID] = true
+		nextID = max(nextID, v.ID+1)
+	}
+	stockTracked := product.ID != 0 && productStockTracked(product.ID)
+
+	result := make([]ProductVariant, 0, len(incoming))
+	names := make(map[string]bool)
+	ids := make(map[uint]bool)
+	for _, v := range incoming {
+		v.Name = strings.TrimSpace(v.Name)
+		if v.Name == "" {
+			return nil, 0, fmt.Errorf("variant nomi majburiy")
+		}
+		if names[strings.ToLower(v.Name)] {
+			return nil, 0, fmt.Errorf("variant %s bir necha marta kiritilgan", v.Name)
+		}
+		names[strings.ToLower(v.Name)] = true
+
+		if v.ID != 0 {
+			if !known[v.ID] || ids[v.ID] {
+				return nil, 0, fmt.Errorf("variant ID %d noto'g'ri", v.ID)
+			}
+		} else {
+			v.ID = nextID
+			nextID++
+		}
+		ids[v.ID] = true
+
+		if v.Price < 0 {
+			return nil, 0, fmt.Errorf("variant %s narxi manfiy bo'lishi mumkin emas", v.Name)
+		}
+		if stockTracked && !sameUnit(v.Type, productType) {
+			return nil, 0, fmt.Errorf("variant %s: qoldig'i kuzatiladigan mahsulot variantlari mahsulot birligida (%s) bo'lishi kerak", v.Name, productType)
+		}
+		unitType := productType
+		if v.Type != "" {
+			unitType = v.Type
+		}
+		if err := validateQuantityRules(unitType, v.MinQty, v.MaxQty, v.Step); err != nil {
+			return nil, 0, fmt.Errorf("variant %s: %v", v.Name, err)
+		}
+		result = append(result, v)
+	}
+	return result, nextID, nil
+}
+
+// Eski mahsulotlarda NextVariantID yo'q: avval o'chirilgan variantlar orderlarda qolgan bo'lishi
+// mumkin, shuning uchun hisoblagich mavjud variantlar va orderlardagi eng katta ID dan davom etadi
+func backfillNextVariantIDs() {
+	used := make(map[uint]uint)
+	for _, o := range orders {
+		for _, item := range o.Items {
+			used[item.ProductID] = max(used[item.ProductID], item.VariantID)
+		}
+	}
+	for i := range products {
+		p := &products[i]
+		next := max(p.NextVariantID, used[p.ID]+1)
+		for _, v := range p.Variants {
+			next = max(next, v.ID+1)
+		}
+		if next > 1 {
+			p.NextVariantID = next
+		}
+	}
+}
+
+// Variant birligi mahsulotnikiga tengmi (bo'sh - mahsulot birligi)
+func sameUnit(variantType, productType string) bool {
+	if variantType == "" {
+		return true
+	}
+	if code := unitCode(variantType); code != "" {
+		return code == unitCode(productType)
+	}
+	return strings.EqualFold(variantType, productType)
+}
+
+// Boshqa birlikdagi varianti bor mahsulot qoldig'ini kuzatib bo'lmaydi
+func checkVariantUnitsForStock(product *Product) error {
+	for _, v := range product.Variants {
+		if !sameUnit(v.Type, product.Type) {
+			return fmt.Errorf("mahsulot %s varianti %s boshqa birlikda (%s), qoldig'ini kuzatib bo'lmaydi", product.Name, v.Name, v.Type)
+		}
+	}
+	return nil
+}
+
+// Katalog uchun variantlar: birlik va kasr xonalari variant bo'yicha
+func catalogVariants(product *Product) []VariantSimple {
+	if len(product.Variants) == 0 {
+		return nil
+	}
+	variants := make([]VariantSimple, 0, len(product.Variants))
+	for _, v := range product.Variants {
+		rules := variantRules(product, &v)
+		variants = append(variants, VariantSimple{
+			ID:       v.ID,
+			Name:     v.Name,
+			Type:     rules.Type,
+			Unit:     unitCode(rules.Type),
+			Decimals: unitDecimals(rules.Type),
+			Price:    v.Price,
+			MinQty:   rules.MinQty,
+			MaxQty:   rules.MaxQty,
+			Step:     rules.Step,
+		})
+	}
+	return variants
+}